@@ -6,8 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cloudinary/cloudinary-go/v2"
 	"github.com/go-playground/validator/v10"
@@ -17,9 +21,14 @@ import (
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/redis/go-redis/v9"
+	apperror "github.com/zulfikarrosadi/code_roast/internal/app-error"
 	"github.com/zulfikarrosadi/code_roast/internal/auth"
+	"github.com/zulfikarrosadi/code_roast/internal/comment"
+	"github.com/zulfikarrosadi/code_roast/internal/mailer"
 	"github.com/zulfikarrosadi/code_roast/internal/moderator"
 	"github.com/zulfikarrosadi/code_roast/internal/post"
+	"github.com/zulfikarrosadi/code_roast/internal/profile"
 	"github.com/zulfikarrosadi/code_roast/internal/subforum"
 	"github.com/zulfikarrosadi/code_roast/internal/user"
 )
@@ -34,6 +43,55 @@ type ErrorResponse struct {
 	Error  Error  `json:"error"`
 }
 
+// routes that can be called without access token
+var publicPaths = map[string]bool{
+	"/api/v1/signin":                   true,
+	"/api/v1/signup":                   true,
+	"/api/v1/refresh":                  true,
+	"/api/v1/signout":                  true,
+	"/api/v1/password/forgot":          true,
+	"/api/v1/password/reset":           true,
+	"/api/v1/email/verify":             true,
+	"/api/v1/signin/2fa":               true,
+	"/.well-known/jwks.json":           true,
+	"/api/v1/oauth/:provider":          true,
+	"/api/v1/oauth/:provider/callback": true,
+}
+
+// paths anyone can read, writing to the same path still need an access token e.g POST /posts.
+// access token is still checked when sent, so handlers can tailor the response to the viewer
+var publicReadPaths = map[string]bool{
+	"/api/v1/posts/:id":                true,
+	"/api/v1/posts/:id/revisions":      true,
+	"/api/v1/posts/:id/revisions/diff": true,
+	"/api/v1/reactions":                true,
+	"/api/v1/posts/:id/comments":       true,
+	"/api/v1/comments/:id/replies":     true,
+	"/api/v1/users/:handle":            true,
+	"/api/v1/posts":                    true,
+	"/api/v1/subforums/:id/posts":      true,
+}
+
+// endpoints of well known providers, each of them can still be overridden from env
+var defaultOAuthProviders = map[string]auth.OAuthProvider{
+	"github": {
+		AuthURL:     "https://github.com/login/oauth/authorize",
+		TokenURL:    "https://github.com/login/oauth/access_token",
+		UserInfoURL: "https://api.github.com/user",
+		EmailsURL:   "https://api.github.com/user/emails",
+		Scopes:      []string{"read:user", "user:email"},
+	},
+	"gitlab": {
+		AuthURL:     "https://gitlab.com/oauth/authorize",
+		TokenURL:    "https://gitlab.com/oauth/token",
+		UserInfoURL: "https://gitlab.com/oauth/userinfo",
+		Scopes:      []string{"openid", "profile", "email"},
+	},
+}
+
+// set from REQUIRE_2FA_FOR_PRIVILEGED_ROLES, when true privileged routes only accept session signed in with two-factor
+var requireTwoFactorForPrivilegedRoles bool
+
 const (
 	CLOUDINARY_API_KEY    = "CLOUDINARY_API_KEY"
 	CLOUDINARY_API_SECRET = "CLOUDINARY_API_SECRET"
@@ -56,8 +114,10 @@ func loadEnv() {
 func main() {
 	e := echo.New()
 	loadEnv()
+	e.IPExtractor = newIPExtractor()
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelDebug,
+		Level:       slog.LevelDebug,
+		ReplaceAttr: redactAuthorization,
 	}))
 	db := OpenDBConnection(logger)
 	if db == nil {
@@ -117,15 +177,41 @@ func main() {
 		},
 	}))
 	e.Use(middleware.Secure())
+	keySet, err := auth.LoadKeySet(os.Getenv("JWT_KEYS_DIR"), os.Getenv("JWT_ACTIVE_KID"))
+	if err != nil {
+		panic(fmt.Sprintf("jwt keys fail to load: %v", err))
+	}
+	requireTwoFactorForPrivilegedRoles = os.Getenv("REQUIRE_2FA_FOR_PRIVILEGED_ROLES") == "true"
+	v := validator.New()
+	userRepository := auth.NewUserRepository(logger, db)
+	sessionConfig := loadSessionConfig()
+	mail := newMailer()
+	userService := auth.NewUserService(userRepository, v, mail, newAttemptStore(), keySet, auth.Config{
+		Session:                    sessionConfig,
+		Lockout:                    loadLockoutConfig(),
+		AppURL:                     os.Getenv("APP_URL"),
+		PasswordResetLifetime:      parseDurationEnv("PASSWORD_RESET_LIFETIME"),
+		PasswordResetMaxPerEmail:   parseIntEnv("PASSWORD_RESET_MAX_PER_EMAIL"),
+		PasswordResetMaxPerIP:      parseIntEnv("PASSWORD_RESET_MAX_PER_IP"),
+		PasswordResetWindow:        parseDurationEnv("PASSWORD_RESET_WINDOW"),
+		EmailVerificationLifetime:  parseDurationEnv("EMAIL_VERIFICATION_LIFETIME"),
+		VerificationResendCooldown: parseDurationEnv("VERIFICATION_RESEND_COOLDOWN"),
+		OAuthProviders:             loadOAuthProviders(),
+		AccountDeletionPolicy:      os.Getenv("ACCOUNT_DELETION_POLICY"),
+		Password:                   loadPasswordConfig(),
+		PasswordPolicy:             loadPasswordPolicy(logger),
+		Logger:                     logger,
+	})
+	e.Use(personalAccessToken(userService))
 	e.Use(echojwt.WithConfig(echojwt.Config{
-		SigningKey:    []byte(os.Getenv("JWT_SECRETS")),
-		SigningMethod: echojwt.AlgorithmHS256,
+		KeyFunc: keySet.Keyfunc,
 		Skipper: func(c echo.Context) bool {
 			fmt.Println(c.Path())
-			if c.Path() == "/api/v1/signin" || c.Path() == "/api/v1/signup" || c.Path() == "/api/v1/refresh" {
+			if c.Request().Method == http.MethodGet && publicReadPaths[c.Path()] && c.Request().Header.Get(echo.HeaderAuthorization) == "" {
 				return true
 			}
-			return false
+			// user is set when the request is already authenticated by personal access token
+			return publicPaths[c.Path()] || c.Get("user") != nil
 		},
 		NewClaimsFunc: func(c echo.Context) jwt.Claims {
 			return &auth.CustomJWTClaims{}
@@ -179,9 +265,6 @@ func main() {
 	if err != nil {
 		panic("cloudnary fail to initiate")
 	}
-	v := validator.New()
-	userRepository := auth.NewUserRepository(logger, db)
-	userService := auth.NewUserService(userRepository, v)
 	userApi := auth.NewApiHandler(logger, userService)
 
 	subforumRepository := subforum.NewRepository(db)
@@ -189,27 +272,345 @@ func main() {
 	subforumApi := subforum.NewApi(subforumService, logger)
 
 	postRepository := post.NewRepository(db)
-	postService := post.NewService(postRepository, v, cld)
+	reactions := loadReactionCatalog()
+	postService := post.NewService(postRepository, v, cld, reactions, mail, os.Getenv("APP_URL"))
 	postApi := post.NewApi(postService, logger)
 
 	moderatorRepository := moderator.NewRepository(db)
 	moderatorService := moderator.NewService(moderatorRepository, v)
 	moderatorApi := moderator.NewApi(moderatorService, logger)
 
+	profileRepository := profile.NewRepository(db)
+	profileService := profile.NewService(profileRepository, v, cld)
+	profileApi := profile.NewApi(profileService, logger)
+
+	commentRepository := comment.NewRepository(db)
+	commentService := comment.NewService(commentRepository, v, reactions)
+	commentApi := comment.NewApi(commentService, logger)
+
+	e.GET("/.well-known/jwks.json", userApi.JWKS)
+
 	r := e.Group("/api/v1")
 	r.POST("/signup", userApi.Register)
 	r.POST("/signin", userApi.Login)
+	r.POST("/signin/2fa", userApi.LoginTwoFactor)
+	r.GET("/oauth/:provider", userApi.OAuthStart)
+	r.GET("/oauth/:provider/callback", userApi.OAuthCallback)
 	r.GET("/refresh", userApi.RefreshToken)
-	r.POST("/subforums", subforumApi.Create, roles([]int{user.ROLE_ID_CREATE_SUBFORUM}))
-	r.POST("/posts", postApi.Create)
-	r.POST("/posts/:id/likes", postApi.Like)
-	r.PUT("/moderators/posts/:postId/status", postApi.TakeDown, roles([]int{user.ROLE_ID_TAKE_DOWN_POST}))
-	r.POST("/moderators", moderatorApi.AddRoles)
+	r.POST("/signout", userApi.Signout)
+	r.POST("/signout/all", userApi.SignoutAll, signedIn)
+	r.GET("/me/sessions", userApi.ListSessions, signedIn)
+	r.DELETE("/me/sessions/:id", userApi.RevokeSession, signedIn)
+	r.POST("/password/forgot", userApi.ForgotPassword)
+	r.POST("/password/reset", userApi.ResetPassword)
+	r.GET("/email/verify", userApi.VerifyEmail)
+	r.POST("/email/verify/resend", userApi.ResendVerification)
+	r.POST("/me/2fa", userApi.EnrollTwoFactor, signedIn)
+	r.POST("/me/2fa/confirm", userApi.ConfirmTwoFactor, signedIn)
+	r.DELETE("/me/2fa", userApi.DisableTwoFactor, signedIn)
+	r.POST("/me/tokens", userApi.CreatePersonalToken, signedIn)
+	r.GET("/me/tokens", userApi.ListPersonalTokens, signedIn)
+	r.DELETE("/me/tokens/:id", userApi.RevokePersonalToken, signedIn)
+	r.PUT("/me/password", userApi.ChangePassword, signedIn)
+	r.PUT("/me/email", userApi.ChangeEmail, signedIn)
+	r.DELETE("/me", userApi.DeleteAccount, signedIn)
+	r.PATCH("/me", profileApi.Update, signedIn)
+	r.GET("/users/:handle", profileApi.FindByHandle)
+	r.POST("/subforums", subforumApi.Create, roles(userService, []int{user.ROLE_ID_CREATE_SUBFORUM}))
+	r.PUT("/subforums/:id/approval", subforumApi.UpdateApproval, roles(userService, []int{user.ROLE_ID_UPDATE_SUBFORUM}))
+	r.GET("/posts", postApi.Feed)
+	r.GET("/subforums/:id/posts", postApi.Feed)
+	r.GET("/posts/:id", postApi.FindById)
+	r.POST("/posts", postApi.Create, verifiedEmail)
+	r.PATCH("/posts/:id", postApi.Edit, verifiedEmail)
+	r.DELETE("/posts/:id", postApi.Delete, currentRoles(userService))
+	r.GET("/posts/:id/revisions", postApi.Revisions)
+	r.GET("/posts/:id/revisions/diff", postApi.RevisionDiff)
+	r.POST("/posts/:id/likes", postApi.Like, verifiedEmail)
+	r.DELETE("/posts/:id/likes", postApi.Unlike)
+	r.PUT("/posts/:id/vote", postApi.Vote, verifiedEmail)
+	r.GET("/reactions", postApi.ReactionCatalog)
+	r.PUT("/posts/:id/reaction", postApi.React, verifiedEmail)
+	r.DELETE("/posts/:id/reaction", postApi.Unreact)
+	r.GET("/posts/:id/comments", commentApi.List)
+	r.POST("/posts/:id/comments", commentApi.Create, verifiedEmail)
+	r.GET("/comments/:id/replies", commentApi.Replies)
+	r.PATCH("/comments/:id", commentApi.Update, currentRoles(userService))
+	r.DELETE("/comments/:id", commentApi.Delete, currentRoles(userService))
+	r.PUT("/comments/:id/vote", commentApi.Vote, verifiedEmail)
+	r.PUT("/comments/:id/reaction", commentApi.React, verifiedEmail)
+	r.DELETE("/comments/:id/reaction", commentApi.Unreact)
+	r.PUT("/moderators/posts/:postId/status", postApi.TakeDown, roles(userService, []int{user.ROLE_ID_TAKE_DOWN_POST}))
+	r.GET("/moderators/queue", postApi.Queue, roles(userService, []int{user.ROLE_ID_APPROVE_POST}))
+	r.POST("/moderators/queue/:id/approve", postApi.Approve, roles(userService, []int{user.ROLE_ID_APPROVE_POST}))
+	r.POST("/moderators/queue/:id/reject", postApi.Reject, roles(userService, []int{user.ROLE_ID_APPROVE_POST}))
+	r.POST("/moderators", moderatorApi.AddRoles, roles(userService, []int{user.ROLE_ID_MANAGE_USERS}))
+	r.DELETE("/moderators", moderatorApi.RemoveRoles, roles(userService, []int{user.ROLE_ID_MANAGE_USERS}))
+	r.POST("/moderators/unlock", userApi.Unlock, roles(userService, []int{user.ROLE_ID_MANAGE_USERS}))
+
+	sessionSweeper := auth.NewSessionSweeper(logger, userRepository, sessionConfig)
+	go sessionSweeper.Run(context.Background())
+	mediaCleaner := post.NewMediaCleaner(logger, postRepository, cld, loadMediaCleanupConfig())
+	go mediaCleaner.Run(context.Background())
 
 	e.Start("localhost:3000")
 }
 
-func roles(requiredRoles []int) func(echo.HandlerFunc) echo.HandlerFunc {
+// redactAuthorization keep only the scheme of authorization headers in the logs. personal access tokens are
+// long lived bearer secrets stored hashed, the logs must not keep them, nor the access tokens, in plaintext
+func redactAuthorization(groups []string, attr slog.Attr) slog.Attr {
+	if !strings.EqualFold(attr.Key, "authorization") {
+		return attr
+	}
+	switch value := attr.Value.Any().(type) {
+	case string:
+		return slog.String(attr.Key, redactCredential(value))
+	case map[string][]string:
+		redacted := map[string][]string{}
+		for name, values := range value {
+			for _, v := range values {
+				redacted[name] = append(redacted[name], redactCredential(v))
+			}
+		}
+		return slog.Any(attr.Key, redacted)
+	default:
+		return slog.String(attr.Key, "[REDACTED]")
+	}
+}
+
+// redactCredential turn "Bearer crpat_..." into "Bearer [REDACTED]"
+func redactCredential(value string) string {
+	if value == "" {
+		return ""
+	}
+	scheme, _, found := strings.Cut(value, " ")
+	if !found {
+		return "[REDACTED]"
+	}
+	return scheme + " [REDACTED]"
+}
+
+// TRUSTED_PROXIES is a comma separated list of cidr e.g "10.0.0.0/8,172.16.0.0/12". without it the api is
+// expected to face clients directly and X-Forwarded-For / X-Real-IP are ignored, anyone can forge them
+func newIPExtractor() echo.IPExtractor {
+	value := os.Getenv("TRUSTED_PROXIES")
+	if value == "" {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, cidr := range strings.Split(value, ",") {
+		_, ipRange, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			panic(fmt.Sprintf("TRUSTED_PROXIES is not a valid cidr list: %v", err))
+		}
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// MAIL_DRIVER pick where outgoing email goes: "smtp" for real delivery, anything else write them to MAIL_DIR
+func newMailer() mailer.Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if os.Getenv("MAIL_DRIVER") == "smtp" {
+		return mailer.NewSMTPMailer(
+			os.Getenv("SMTP_HOST"),
+			os.Getenv("SMTP_PORT"),
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			from,
+		)
+	}
+	dir := os.Getenv("MAIL_DIR")
+	if dir == "" {
+		dir = "mails"
+	}
+	return mailer.NewFileMailer(dir, from)
+}
+
+// LOGIN_ATTEMPT_STORE pick where failed sign in attempts are tracked: "redis" to share them between instances, anything else keep them in memory
+func newAttemptStore() auth.AttemptStore {
+	if os.Getenv("LOGIN_ATTEMPT_STORE") == "redis" {
+		return auth.NewRedisAttemptStore(redis.NewClient(&redis.Options{
+			Addr:     os.Getenv("REDIS_ADDR"),
+			Password: os.Getenv("REDIS_PASSWORD"),
+		}))
+	}
+	return auth.NewMemoryAttemptStore()
+}
+
+// OAUTH_PROVIDERS is comma separated provider names, every provider is configured with OAUTH_<NAME>_* env
+func loadOAuthProviders() map[string]auth.OAuthProvider {
+	providers := map[string]auth.OAuthProvider{}
+	for _, name := range strings.Split(os.Getenv("OAUTH_PROVIDERS"), ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OAUTH_" + strings.ToUpper(name) + "_"
+		provider := defaultOAuthProviders[name]
+		provider.ClientID = os.Getenv(prefix + "CLIENT_ID")
+		provider.ClientSecret = os.Getenv(prefix + "CLIENT_SECRET")
+		provider.RedirectURL = os.Getenv(prefix + "REDIRECT_URL")
+		if value := os.Getenv(prefix + "AUTH_URL"); value != "" {
+			provider.AuthURL = value
+		}
+		if value := os.Getenv(prefix + "TOKEN_URL"); value != "" {
+			provider.TokenURL = value
+		}
+		if value := os.Getenv(prefix + "USERINFO_URL"); value != "" {
+			provider.UserInfoURL = value
+		}
+		if value := os.Getenv(prefix + "EMAILS_URL"); value != "" {
+			provider.EmailsURL = value
+		}
+		if value := os.Getenv(prefix + "SCOPES"); value != "" {
+			provider.Scopes = strings.Fields(value)
+		}
+		provider.TrustEmail = os.Getenv(prefix+"TRUST_EMAIL") == "true"
+		if provider.ClientID == "" || provider.AuthURL == "" || provider.TokenURL == "" || provider.UserInfoURL == "" {
+			panic(fmt.Sprintf("oauth provider %s is not fully configured", name))
+		}
+		providers[name] = provider
+	}
+	return providers
+}
+
+func loadLockoutConfig() auth.LockoutConfig {
+	return auth.LockoutConfig{
+		MaxAccountAttempts: parseIntEnv("LOGIN_MAX_ACCOUNT_ATTEMPTS"),
+		MaxIPAttempts:      parseIntEnv("LOGIN_MAX_IP_ATTEMPTS"),
+		AttemptWindow:      parseDurationEnv("LOGIN_ATTEMPT_WINDOW"),
+		BaseLockout:        parseDurationEnv("LOGIN_BASE_LOCKOUT"),
+		MaxLockout:         parseDurationEnv("LOGIN_MAX_LOCKOUT"),
+	}
+}
+
+// raising any of these upgrade existing hashes on the next sign in of their owner
+func loadPasswordConfig() auth.PasswordConfig {
+	return auth.PasswordConfig{
+		Algorithm:     os.Getenv("PASSWORD_HASH_ALGORITHM"),
+		BcryptCost:    parseIntEnv("BCRYPT_COST"),
+		Argon2Time:    uint32(parseIntEnv("ARGON2_TIME")),
+		Argon2Memory:  uint32(parseIntEnv("ARGON2_MEMORY")),
+		Argon2Threads: uint8(parseIntEnv("ARGON2_THREADS")),
+	}
+}
+
+// BREACHED_PASSWORDS_DIR is optional, without it only length, personal info and strength are checked.
+// PASSWORD_MIN_SCORE="0" turn the strength check off, empty use the default
+func loadPasswordPolicy(logger *slog.Logger) auth.PasswordPolicy {
+	policy := auth.PasswordPolicy{
+		MinLength: parseIntEnv("PASSWORD_MIN_LENGTH"),
+		Logger:    logger,
+	}
+	if os.Getenv("PASSWORD_MIN_SCORE") != "" {
+		minScore := parseIntEnv("PASSWORD_MIN_SCORE")
+		policy.MinScore = &minScore
+	}
+	if dir := os.Getenv("BREACHED_PASSWORDS_DIR"); dir != "" {
+		breached, err := auth.NewBreachedPasswordDir(dir)
+		if err != nil {
+			panic(err.Error())
+		}
+		policy.Breached = breached
+	}
+	return policy
+}
+
+// REACTIONS is written as key:emoji pairs e.g "roast:🔥,laugh:😂", empty value use post.DEFAULT_REACTIONS
+func loadReactionCatalog() post.ReactionCatalog {
+	value := os.Getenv("REACTIONS")
+	if value == "" {
+		return post.DEFAULT_REACTIONS
+	}
+	catalog, err := post.ParseReactionCatalog(value)
+	if err != nil {
+		panic(fmt.Sprintf("REACTIONS is not a valid reaction catalog: %v", err))
+	}
+	return catalog
+}
+
+// lifetimes are written as go duration e.g "720h", empty value fallback to auth defaults
+func loadSessionConfig() auth.SessionConfig {
+	return auth.SessionConfig{
+		AbsoluteLifetime: parseDurationEnv("SESSION_ABSOLUTE_LIFETIME"),
+		IdleLifetime:     parseDurationEnv("SESSION_IDLE_LIFETIME"),
+		SweepInterval:    parseDurationEnv("SESSION_SWEEP_INTERVAL"),
+	}
+}
+
+// backoffs are written as go duration e.g "1m", empty value fallback to post defaults
+func loadMediaCleanupConfig() post.MediaCleanupConfig {
+	return post.MediaCleanupConfig{
+		Interval:    parseDurationEnv("MEDIA_CLEANUP_INTERVAL"),
+		BaseBackoff: parseDurationEnv("MEDIA_CLEANUP_BASE_BACKOFF"),
+		MaxBackoff:  parseDurationEnv("MEDIA_CLEANUP_MAX_BACKOFF"),
+		BatchSize:   parseIntEnv("MEDIA_CLEANUP_BATCH_SIZE"),
+	}
+}
+
+func parseDurationEnv(key string) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		panic(fmt.Sprintf("%s is not a valid duration: %v", key, err))
+	}
+	return duration
+}
+
+func parseIntEnv(key string) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		panic(fmt.Sprintf("%s is not a valid number: %v", key, err))
+	}
+	return number
+}
+
+type personalTokenAuthenticator interface {
+	AuthenticatePersonalToken(context.Context, string) (*auth.CustomJWTClaims, error)
+}
+
+// personalAccessToken accept "Authorization: Bearer crpat_..." for scripts and ci, the claims are put
+// where echojwt would put them so the rest of the middleware and handlers work the same
+func personalAccessToken(tokens personalTokenAuthenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok || !auth.IsPersonalToken(token) {
+				return next(c)
+			}
+			claims, err := tokens.AuthenticatePersonalToken(c.Request().Context(), token)
+			if err != nil {
+				var appError *apperror.AppError
+				if errors.As(err, &appError) {
+					return echo.NewHTTPError(appError.Code, appError.Message)
+				}
+				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or missing access token")
+			}
+			c.Set("user", &jwt.Token{Claims: claims, Valid: true})
+			return next(c)
+		}
+	}
+}
+
+type tokenVersionChecker interface {
+	CheckTokenVersion(context.Context, *auth.CustomJWTClaims) error
+}
+
+// roles also make sure the roles in the token are still current, token issued before the last
+// role change is rejected so revoked permission can't be used until the token expires
+func roles(versions tokenVersionChecker, requiredRoles []int) func(echo.HandlerFunc) echo.HandlerFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			token := c.Get("user").(*jwt.Token)
@@ -218,6 +619,10 @@ func roles(requiredRoles []int) func(echo.HandlerFunc) echo.HandlerFunc {
 			if !ok {
 				return echo.NewHTTPError(http.StatusForbidden, "you don't have perimission to do this operation")
 			}
+			err := checkTokenVersion(c, versions, claims)
+			if err != nil {
+				return err
+			}
 
 			roleSet := make(map[int]bool)
 			for _, role := range claims.Roles {
@@ -228,11 +633,84 @@ func roles(requiredRoles []int) func(echo.HandlerFunc) echo.HandlerFunc {
 					return echo.NewHTTPError(http.StatusForbidden, "you don't have permission to do this operation")
 				}
 			}
+			if requireTwoFactorForPrivilegedRoles && !claims.TwoFactor {
+				for _, reqRole := range requiredRoles {
+					if user.PRIVILEGED_ROLE_IDS[reqRole] {
+						return echo.NewHTTPError(http.StatusForbidden, "enable two-factor authentication and sign in again to do this operation")
+					}
+				}
+			}
 			return next(c)
 		}
 	}
 }
 
+func checkTokenVersion(c echo.Context, versions tokenVersionChecker, claims *auth.CustomJWTClaims) error {
+	err := versions.CheckTokenVersion(c.Request().Context(), claims)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.Is(err, auth.ErrStaleToken) {
+			return echo.NewHTTPError(http.StatusUnauthorized, "your permissions have changed, please refresh your access token")
+		} else if errors.As(err, &appError) {
+			return echo.NewHTTPError(appError.Code, appError.Message)
+		}
+		return err
+	}
+	return nil
+}
+
+// currentRoles is for routes open to everyone where roles only widen what the user can do, e.g the author
+// or a moderator can delete. roles of a stale token are rejected like in roles, privileged roles
+// are dropped when two-factor is required and the session didn't use it
+func currentRoles(versions tokenVersionChecker) func(echo.HandlerFunc) echo.HandlerFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, err := auth.GetUserFromContext(c)
+			if err != nil {
+				return echo.ErrUnauthorized
+			}
+			err = checkTokenVersion(c, versions, claims)
+			if err != nil {
+				return err
+			}
+			if requireTwoFactorForPrivilegedRoles && !claims.TwoFactor {
+				held := []user.Roles{}
+				for _, role := range claims.Roles {
+					if !user.PRIVILEGED_ROLE_IDS[role.Id] {
+						held = append(held, role)
+					}
+				}
+				claims.Roles = held
+			}
+			return next(c)
+		}
+	}
+}
+
+// signedIn reject personal access tokens, the claims are built by auth.AuthenticatePersonalToken
+func signedIn(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		claims, err := auth.GetUserFromContext(c)
+		if err == nil && claims.PersonalToken {
+			return echo.NewHTTPError(http.StatusForbidden, auth.PERSONAL_TOKEN_FORBIDDEN_MESSAGE)
+		}
+		return next(c)
+	}
+}
+
+// unverified accounts can sign in and browse, but can't create content
+func verifiedEmail(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token := c.Get("user").(*jwt.Token)
+
+		claims, ok := token.Claims.(*auth.CustomJWTClaims)
+		if !ok || !claims.EmailVerified {
+			return echo.NewHTTPError(http.StatusForbidden, "please verify your email address before doing this operation")
+		}
+		return next(c)
+	}
+}
+
 func OpenDBConnection(logger *slog.Logger) *sql.DB {
 	db, err := sql.Open("mysql", os.Getenv("DB_CONNECTION_STRING"))
 	if err != nil {
@@ -34,4 +34,278 @@ CREATE TABLE `subforums` (
   PRIMARY KEY (`id`),
   KEY `user_id` (`user_id`),
   CONSTRAINT `subforums_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+ALTER TABLE `authentication`
+  ADD COLUMN `family_id` varchar(36) NOT NULL AFTER `refresh_token`,
+  ADD COLUMN `replaced_by` varchar(36) DEFAULT NULL AFTER `family_id`,
+  ADD KEY `family_id` (`family_id`);
+
+-- sessions from before rotation each start their own family
+UPDATE `authentication` SET `family_id` = `id` WHERE `family_id` = '';
+
+ALTER TABLE `authentication`
+  ADD COLUMN `expires_at` bigint NOT NULL AFTER `last_login`,
+  ADD KEY `expires_at` (`expires_at`),
+  ADD KEY `last_login` (`last_login`);
+
+-- existing sessions get the default absolute lifetime (SESSION_ABSOLUTE_LIFETIME, 720h) from their last sign in
+UPDATE `authentication` SET `expires_at` = `last_login` + 2592000 WHERE `expires_at` = 0;
+
+ALTER TABLE `authentication`
+  MODIFY COLUMN `remote_ip` varchar(45) NOT NULL,
+  MODIFY COLUMN `agent` varchar(255) NOT NULL;
+
+CREATE TABLE IF NOT EXISTS `password_resets` (
+  `id` varchar(36) NOT NULL,
+  `user_id` varchar(36) NOT NULL,
+  `token_hash` char(64) NOT NULL,
+  `expires_at` bigint NOT NULL,
+  `used_at` bigint DEFAULT NULL,
+  `created_at` bigint NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `token_hash` (`token_hash`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `password_resets_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+ALTER TABLE `users`
+  ADD COLUMN `email_verified_at` bigint DEFAULT NULL AFTER `password`,
+  ADD COLUMN `verification_sent_at` bigint DEFAULT NULL AFTER `email_verified_at`;
+
+-- accounts from before verification keep working, run together with the ALTER above and never again
+UPDATE `users` SET `email_verified_at` = `created_at` WHERE `email_verified_at` IS NULL;
+
+ALTER TABLE `users`
+  ADD COLUMN `totp_secret` varchar(64) DEFAULT NULL AFTER `verification_sent_at`,
+  ADD COLUMN `totp_enabled_at` bigint DEFAULT NULL AFTER `totp_secret`;
+
+ALTER TABLE `users`
+  ADD COLUMN `totp_last_step` bigint DEFAULT NULL AFTER `totp_enabled_at`;
+
+ALTER TABLE `authentication`
+  ADD COLUMN `two_factor` tinyint(1) NOT NULL DEFAULT 0 AFTER `family_id`;
+
+CREATE TABLE IF NOT EXISTS `recovery_codes` (
+  `id` varchar(36) NOT NULL,
+  `user_id` varchar(36) NOT NULL,
+  `code_hash` char(64) NOT NULL,
+  `used_at` bigint DEFAULT NULL,
+  `created_at` bigint NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `recovery_codes_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `roles` (
+  `id` int NOT NULL,
+  `name` varchar(50) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `name` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `user_roles` (
+  `user_id` varchar(36) NOT NULL,
+  `role_id` int NOT NULL,
+  PRIMARY KEY (`user_id`, `role_id`),
+  KEY `role_id` (`role_id`),
+  CONSTRAINT `user_roles_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`),
+  CONSTRAINT `user_roles_ibfk_2` FOREIGN KEY (`role_id`) REFERENCES `roles` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ids must match the ROLE_ID_* constants in internal/user/role.go
+INSERT IGNORE INTO `roles` (`id`, `name`) VALUES
+  (1, 'create_subforum'),
+  (2, 'update_subforum'),
+  (3, 'delete_subforum'),
+  (4, 'member'),
+  (5, 'delete_post'),
+  (6, 'approve_post'),
+  (7, 'take_down_post'),
+  (8, 'manage_users');
+
+-- nobody can grant manage_users before someone hold it. once the whole script ran and the first admin signed up,
+-- give it to them by hand and have them sign in again so their access token carry it:
+-- INSERT IGNORE INTO `user_roles` (`user_id`, `role_id`) SELECT `id`, 8 FROM `users` WHERE `email` = 'admin@example.com';
+
+ALTER TABLE `users`
+  ADD COLUMN `token_version` bigint NOT NULL DEFAULT 0 AFTER `totp_enabled_at`;
+
+CREATE TABLE IF NOT EXISTS `user_identities` (
+  `id` varchar(36) NOT NULL,
+  `user_id` varchar(36) NOT NULL,
+  `provider` varchar(50) NOT NULL,
+  `subject` varchar(255) NOT NULL,
+  `email` varchar(255) NOT NULL,
+  `created_at` bigint NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `provider_subject` (`provider`, `subject`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `user_identities_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `personal_access_tokens` (
+  `id` varchar(36) NOT NULL,
+  `user_id` varchar(36) NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `token_hash` char(64) NOT NULL,
+  `last_used_at` bigint DEFAULT NULL,
+  `expires_at` bigint DEFAULT NULL,
+  `created_at` bigint NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `token_hash` (`token_hash`),
+  UNIQUE KEY `user_id_name` (`user_id`, `name`),
+  CONSTRAINT `personal_access_tokens_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `personal_access_token_roles` (
+  `token_id` varchar(36) NOT NULL,
+  `role_id` int NOT NULL,
+  PRIMARY KEY (`token_id`, `role_id`),
+  CONSTRAINT `personal_access_token_roles_ibfk_1` FOREIGN KEY (`token_id`) REFERENCES `personal_access_tokens` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+ALTER TABLE `users`
+  ADD COLUMN `deleted_at` bigint DEFAULT NULL AFTER `token_version`;
+
+ALTER TABLE `users`
+  ADD COLUMN `handle` varchar(30) DEFAULT NULL AFTER `email`,
+  ADD COLUMN `bio` varchar(500) DEFAULT NULL AFTER `handle`,
+  ADD COLUMN `avatar` varchar(255) DEFAULT NULL AFTER `bio`;
+
+UPDATE `users` SET `handle` = CONCAT('user_', RIGHT(REPLACE(`id`, '-', ''), 12)) WHERE `handle` IS NULL;
+
+ALTER TABLE `users`
+  MODIFY COLUMN `handle` varchar(30) NOT NULL,
+  ADD UNIQUE KEY `handle` (`handle`);
+
+CREATE TABLE IF NOT EXISTS `media_deletions` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `media_url` varchar(512) NOT NULL,
+  `attempts` int NOT NULL DEFAULT 0,
+  `last_error` text DEFAULT NULL,
+  `next_attempt_at` bigint NOT NULL,
+  `created_at` bigint NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `media_url` (`media_url`),
+  KEY `next_attempt_at` (`next_attempt_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `comments` (
+  `id` varchar(36) NOT NULL,
+  `post_id` varchar(36) NOT NULL,
+  `user_id` varchar(36) DEFAULT NULL,
+  `parent_id` varchar(36) DEFAULT NULL,
+  `path` varchar(512) NOT NULL,
+  `depth` int NOT NULL DEFAULT 0,
+  `content` text,
+  `reply_count` int NOT NULL DEFAULT 0,
+  `created_at` bigint NOT NULL,
+  `updated_at` bigint DEFAULT NULL,
+  `deleted_at` bigint DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `post_id_parent_id` (`post_id`, `parent_id`),
+  KEY `post_id_path` (`post_id`, `path`),
+  KEY `user_id` (`user_id`),
+  KEY `parent_id` (`parent_id`),
+  CONSTRAINT `comments_ibfk_1` FOREIGN KEY (`post_id`) REFERENCES `posts` (`id`),
+  CONSTRAINT `comments_ibfk_2` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`),
+  CONSTRAINT `comments_ibfk_3` FOREIGN KEY (`parent_id`) REFERENCES `comments` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+ALTER TABLE `likes`
+  ADD COLUMN `value` tinyint NOT NULL DEFAULT 1 AFTER `user_id`;
+
+ALTER TABLE `posts`
+  ADD COLUMN `upvotes` int NOT NULL DEFAULT 0,
+  ADD COLUMN `downvotes` int NOT NULL DEFAULT 0,
+  ADD COLUMN `score` int NOT NULL DEFAULT 0,
+  ADD KEY `status_score` (`status`, `score`);
+
+UPDATE `posts` p
+SET p.`upvotes` = (SELECT COUNT(l.`post_id`) FROM `likes` l WHERE l.`post_id` = p.`id` AND l.`value` = 1),
+  p.`downvotes` = (SELECT COUNT(l.`post_id`) FROM `likes` l WHERE l.`post_id` = p.`id` AND l.`value` = -1),
+  p.`score` = p.`upvotes` - p.`downvotes`;
+
+ALTER TABLE `comments`
+  ADD COLUMN `upvotes` int NOT NULL DEFAULT 0 AFTER `reply_count`,
+  ADD COLUMN `downvotes` int NOT NULL DEFAULT 0 AFTER `upvotes`,
+  ADD COLUMN `score` int NOT NULL DEFAULT 0 AFTER `downvotes`;
+
+CREATE TABLE IF NOT EXISTS `comment_votes` (
+  `comment_id` varchar(36) NOT NULL,
+  `user_id` varchar(36) NOT NULL,
+  `value` tinyint NOT NULL,
+  `created_at` bigint NOT NULL,
+  PRIMARY KEY (`comment_id`, `user_id`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `comment_votes_ibfk_1` FOREIGN KEY (`comment_id`) REFERENCES `comments` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `comment_votes_ibfk_2` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+ALTER TABLE `posts`
+  ADD COLUMN `comment_count` int NOT NULL DEFAULT 0 AFTER `score`,
+  ADD COLUMN `hot_rank` bigint GENERATED ALWAYS AS (ROUND((SIGN(`score`) * LOG10(GREATEST(ABS(`score`), 1)) + `created_at` / 45000) * 1000000)) STORED,
+  ADD COLUMN `controversial_rank` bigint GENERATED ALWAYS AS (ROUND(IF(`upvotes` > 0 AND `downvotes` > 0, POW(`upvotes` + `downvotes`, LEAST(`upvotes`, `downvotes`) / GREATEST(`upvotes`, `downvotes`)), 0) * 1000000)) STORED,
+  ADD COLUMN `best_rank` bigint GENERATED ALWAYS AS (ROUND(IF(`upvotes` + `downvotes` > 0, ((`upvotes` + 1.9208) / (`upvotes` + `downvotes`) - 1.96 * SQRT(`upvotes` * `downvotes` / (`upvotes` + `downvotes`) + 0.9604) / (`upvotes` + `downvotes`)) / (1 + 3.8416 / (`upvotes` + `downvotes`)), 0) * 1000000)) STORED,
+  ADD KEY `status_hot_rank` (`status`, `hot_rank`),
+  ADD KEY `status_controversial_rank` (`status`, `controversial_rank`),
+  ADD KEY `status_best_rank` (`status`, `best_rank`);
+
+UPDATE `posts` p
+SET p.`comment_count` = (SELECT COUNT(c.`id`) FROM `comments` c WHERE c.`post_id` = p.`id` AND c.`deleted_at` IS NULL);
+
+CREATE TABLE IF NOT EXISTS `post_reactions` (
+  `post_id` varchar(36) NOT NULL,
+  `user_id` varchar(36) NOT NULL,
+  `reaction` varchar(32) NOT NULL,
+  `created_at` bigint NOT NULL,
+  PRIMARY KEY (`post_id`, `user_id`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `post_reactions_ibfk_1` FOREIGN KEY (`post_id`) REFERENCES `posts` (`id`),
+  CONSTRAINT `post_reactions_ibfk_2` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `comment_reactions` (
+  `comment_id` varchar(36) NOT NULL,
+  `user_id` varchar(36) NOT NULL,
+  `reaction` varchar(32) NOT NULL,
+  `created_at` bigint NOT NULL,
+  PRIMARY KEY (`comment_id`, `user_id`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `comment_reactions_ibfk_1` FOREIGN KEY (`comment_id`) REFERENCES `comments` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `comment_reactions_ibfk_2` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+ALTER TABLE `posts`
+  ADD COLUMN `edited_at` bigint DEFAULT NULL AFTER `updated_at`;
+
+CREATE TABLE IF NOT EXISTS `post_revisions` (
+  `post_id` varchar(36) NOT NULL,
+  `revision` int NOT NULL,
+  `caption` text NOT NULL,
+  `media` json NOT NULL,
+  `created_at` bigint NOT NULL,
+  PRIMARY KEY (`post_id`, `revision`),
+  CONSTRAINT `post_revisions_ibfk_1` FOREIGN KEY (`post_id`) REFERENCES `posts` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+ALTER TABLE `subforums`
+  ADD COLUMN `require_approval` tinyint(1) NOT NULL DEFAULT 0 AFTER `banner`;
+
+ALTER TABLE `posts`
+  ADD KEY `status_id` (`status`, `id`);
+
+CREATE TABLE IF NOT EXISTS `post_reviews` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `post_id` varchar(36) NOT NULL,
+  `moderator_id` varchar(36) DEFAULT NULL,
+  `decision` varchar(20) NOT NULL,
+  `reason` varchar(1000) NOT NULL DEFAULT '',
+  `created_at` bigint NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `post_id` (`post_id`),
+  KEY `moderator_id` (`moderator_id`),
+  CONSTRAINT `post_reviews_ibfk_1` FOREIGN KEY (`post_id`) REFERENCES `posts` (`id`),
+  CONSTRAINT `post_reviews_ibfk_2` FOREIGN KEY (`moderator_id`) REFERENCES `users` (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -2,6 +2,7 @@ package apperror
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
@@ -41,12 +42,44 @@ func HandlerValidatorError(validationError validator.ValidationErrors) ErrorDeta
 		switch fieldError.Tag() {
 		case "required":
 			errorDetails[strings.ToLower(fieldError.Field())] = fieldError.Field() + " is required"
+		case "required_if":
+			errorDetails[strings.ToLower(fieldError.Field())] = fieldError.Field() + " is required here"
 		case "email":
 			errorDetails[strings.ToLower(fieldError.Field())] = "invalid email format"
 		case "eqfield":
 			if fieldError.Field() == "PasswordConfirmation" {
 				errorDetails["password"] = "password and password confirmation not match"
 			}
+		case "min":
+			if fieldError.Kind() == reflect.String {
+				errorDetails[strings.ToLower(fieldError.Field())] = fmt.Sprintf("%s must be at least %s characters", fieldError.Field(), fieldError.Param())
+			} else {
+				errorDetails[strings.ToLower(fieldError.Field())] = fmt.Sprintf("%s must be at least %s", fieldError.Field(), fieldError.Param())
+			}
+		case "max":
+			if fieldError.Kind() == reflect.String {
+				errorDetails[strings.ToLower(fieldError.Field())] = fmt.Sprintf("%s must be at most %s characters", fieldError.Field(), fieldError.Param())
+			} else {
+				errorDetails[strings.ToLower(fieldError.Field())] = fmt.Sprintf("%s must be at most %s", fieldError.Field(), fieldError.Param())
+			}
+		case "oneof":
+			errorDetails[strings.ToLower(fieldError.Field())] = fmt.Sprintf("%s must be one of %s", fieldError.Field(), fieldError.Param())
+		case "reaction":
+			errorDetails[strings.ToLower(fieldError.Field())] = "reaction is not one of the available reactions"
+		case "single_line":
+			errorDetails[strings.ToLower(fieldError.Field())] = fieldError.Field() + " must not contain line breaks or control characters"
+		case "handle":
+			errorDetails[strings.ToLower(fieldError.Field())] = "handle can only contain lowercase letters, numbers and underscore"
+		case "password_length":
+			errorDetails[strings.ToLower(fieldError.Field())] = "password must be at least " + fieldError.Param() + " characters"
+		case "password_too_long":
+			errorDetails[strings.ToLower(fieldError.Field())] = "password must be at most " + fieldError.Param() + " bytes, accented letters and emoji take more than one"
+		case "password_personal":
+			errorDetails[strings.ToLower(fieldError.Field())] = "password must not contain your name or email"
+		case "password_weak":
+			errorDetails[strings.ToLower(fieldError.Field())] = "password is too easy to guess, avoid sequences and repeated characters or make it longer"
+		case "password_breached":
+			errorDetails[strings.ToLower(fieldError.Field())] = "password has appeared in a data breach, please choose another one"
 		}
 	}
 	return errorDetails
@@ -2,9 +2,11 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -16,7 +18,29 @@ import (
 type Service interface {
 	register(context.Context, registrationRequest) (schema.Response[authResponse], error)
 	login(context.Context, loginRequest) (schema.Response[authResponse], error)
-	refreshToken(context.Context, string) (schema.Response[authResponse], error)
+	refreshToken(context.Context, refreshTokenRequest) (schema.Response[authResponse], error)
+	signout(context.Context, string) (schema.Response[signoutResponse], error)
+	signoutAll(context.Context, string) (schema.Response[signoutResponse], error)
+	listSessions(context.Context, string, string) (schema.Response[sessionsResponse], error)
+	revokeSession(context.Context, string, string) (schema.Response[sessionResponse], error)
+	forgotPassword(context.Context, forgotPasswordRequest) (schema.Response[passwordResponse], error)
+	resetPassword(context.Context, resetPasswordRequest) (schema.Response[passwordResponse], error)
+	verifyEmail(context.Context, verifyEmailRequest) (schema.Response[emailVerificationResponse], error)
+	resendVerification(context.Context, string) (schema.Response[emailVerificationResponse], error)
+	loginTwoFactor(context.Context, twoFactorLoginRequest) (schema.Response[authResponse], error)
+	enrollTwoFactor(context.Context, string, string) (schema.Response[twoFactorEnrollmentResponse], error)
+	confirmTwoFactor(context.Context, string, twoFactorCodeRequest) (schema.Response[twoFactorResponse], error)
+	disableTwoFactor(context.Context, string, twoFactorCodeRequest) (schema.Response[twoFactorResponse], error)
+	unlock(context.Context, unlockRequest) (schema.Response[unlockResponse], error)
+	jwks() jsonWebKeySet
+	startOAuth(context.Context, string) (schema.Response[oauthStartResponse], error)
+	oauthCallback(context.Context, oauthCallbackRequest) (schema.Response[authResponse], error)
+	createPersonalToken(context.Context, *CustomJWTClaims, personalTokenRequest) (schema.Response[personalTokenResponse], error)
+	listPersonalTokens(context.Context, string) (schema.Response[personalTokensResponse], error)
+	revokePersonalToken(context.Context, string, string) (schema.Response[personalTokenResponse], error)
+	changePassword(context.Context, string, changePasswordRequest) (schema.Response[accountResponse], error)
+	changeEmail(context.Context, string, changeEmailRequest) (schema.Response[accountResponse], error)
+	deleteAccount(context.Context, string, deleteAccountRequest) (schema.Response[accountResponse], error)
 }
 
 type ApiHandler struct {
@@ -32,8 +56,9 @@ func NewApiHandler(logger *slog.Logger, service Service) *ApiHandler {
 }
 
 func GetUserFromContext(c echo.Context) (*CustomJWTClaims, error) {
-	userData := c.Get("user").(*jwt.Token)
-	if userData == nil {
+	// nothing is set on public path requested without access token
+	userData, ok := c.Get("user").(*jwt.Token)
+	if !ok || userData == nil {
 		return nil, echo.NewHTTPError(401, "User not found in context")
 	}
 	claims, ok := userData.Claims.(*CustomJWTClaims)
@@ -48,6 +73,7 @@ const (
 	WEEK_IN_SECOND     = 604_800
 	REQUEST_ID_KEY     = "REQUEST_ID"
 	REFRESH_TOKEN_NAME = "refresh_token"
+	REFRESH_TOKEN_PATH = "/api/v1"
 )
 
 func (api *ApiHandler) RefreshToken(c echo.Context) error {
@@ -70,8 +96,15 @@ func (api *ApiHandler) RefreshToken(c echo.Context) error {
 		)
 		return echo.NewHTTPError(http.StatusUnauthorized, "something went wrong, refresh token extraction from cookie fails")
 	}
-	response, err := api.refreshToken(ctx, refreshToken.Value)
+	response, err := api.refreshToken(ctx, refreshTokenRequest{
+		token:    refreshToken.Value,
+		remoteIP: c.RealIP(),
+		agent:    c.Request().UserAgent(),
+	})
 	if err != nil {
+		if response.Code == http.StatusUnauthorized {
+			clearRefreshTokenCookie(c)
+		}
 		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
 			slog.Int("status", http.StatusInternalServerError),
 			slog.Group("request",
@@ -87,14 +120,7 @@ func (api *ApiHandler) RefreshToken(c echo.Context) error {
 		)
 		return echo.NewHTTPError(response.Code, response.Error.Message)
 	}
-	c.SetCookie(&http.Cookie{
-		Name:     REFRESH_TOKEN_NAME,
-		Value:    response.Data.RefreshToken,
-		Secure:   true,
-		MaxAge:   WEEK_IN_SECOND,
-		Path:     "/api/v1/refresh",
-		HttpOnly: true,
-	})
+	setRefreshTokenCookie(c, response.Data.RefreshToken)
 	if err := c.JSON(response.Code, response); err != nil {
 		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
 			slog.Int("status", http.StatusInternalServerError),
@@ -139,11 +165,12 @@ func (api *ApiHandler) Login(c echo.Context) error {
 	}
 	user.authentication = authentication{
 		lastLogin: time.Now().Unix(),
-		remoteIP:  c.Request().RemoteAddr,
+		remoteIP:  c.RealIP(),
 		agent:     c.Request().UserAgent(),
 	}
 	response, err := api.Service.login(ctx, *user)
 	if err != nil {
+		setRetryAfter(c, err)
 		if response.Error.Message == apperror.VALIDATION_ERROR {
 			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
 				slog.Int("status", response.Code),
@@ -193,14 +220,10 @@ func (api *ApiHandler) Login(c echo.Context) error {
 		return echo.NewHTTPError(response.Code, response.Error.Message)
 	}
 
-	c.SetCookie(&http.Cookie{
-		Name:     REFRESH_TOKEN_NAME,
-		Value:    response.Data.RefreshToken,
-		Secure:   true,
-		MaxAge:   WEEK_IN_SECOND,
-		Path:     "/api/v1/refresh",
-		HttpOnly: true,
-	})
+	// no session is created yet when user still need to present the second factor
+	if !response.Data.TwoFactorRequired {
+		setRefreshTokenCookie(c, response.Data.RefreshToken)
+	}
 	err = c.JSON(response.Code, response)
 	if err != nil {
 		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
@@ -254,7 +277,7 @@ func (api *ApiHandler) Register(c echo.Context) error {
 		Email:                user.Email,
 		Password:             user.Password,
 		Agent:                c.Request().UserAgent(),
-		RemoteIp:             c.Request().RemoteAddr,
+		RemoteIp:             c.RealIP(),
 	})
 	if err != nil {
 		if response.Error.Message == apperror.VALIDATION_ERROR {
@@ -292,16 +315,126 @@ func (api *ApiHandler) Register(c echo.Context) error {
 		)
 		return echo.NewHTTPError(response.Code, response.Error.Message)
 	}
+	setRefreshTokenCookie(c, response.Data.RefreshToken)
+	err = c.JSON(response.Code, response)
+	if err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(
+			http.StatusInternalServerError,
+			"something went wrong, please try again later",
+		)
+	}
+	return nil
+}
+
+// tell the client how long to wait when sign in is locked
+func setRetryAfter(c echo.Context, err error) {
+	var lockedOut *lockedOutError
+	if errors.As(err, &lockedOut) {
+		c.Response().Header().Set("Retry-After", strconv.FormatInt(lockedOut.retryAfterSeconds(), 10))
+	}
+}
+
+func setOAuthStateCookie(c echo.Context, value string, maxAge int) {
+	c.SetCookie(&http.Cookie{
+		Name:     OAUTH_STATE_COOKIE_NAME,
+		Value:    value,
+		Secure:   true,
+		MaxAge:   maxAge,
+		Path:     OAUTH_STATE_COOKIE_PATH,
+		HttpOnly: true,
+		// sent along the top level redirect coming back from the provider
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// the refresh token cookie used to be scoped to the refresh endpoint, browsers keep such cookie apart from
+// the current one and send it first on refresh, so it is expired whenever the cookie is set or cleared
+const LEGACY_REFRESH_TOKEN_PATH = "/api/v1/refresh"
+
+func setRefreshTokenCookie(c echo.Context, refreshToken string) {
+	expireRefreshTokenCookie(c, LEGACY_REFRESH_TOKEN_PATH)
 	c.SetCookie(&http.Cookie{
 		Name:     REFRESH_TOKEN_NAME,
-		Value:    response.Data.RefreshToken,
+		Value:    refreshToken,
 		Secure:   true,
 		MaxAge:   WEEK_IN_SECOND,
-		Path:     "/api/v1/refresh",
+		Path:     REFRESH_TOKEN_PATH,
 		HttpOnly: true,
+		// the path cover every endpoint of the api, so requests started by other sites must not carry it
+		SameSite: http.SameSiteStrictMode,
 	})
-	err = c.JSON(response.Code, response)
+}
+
+func expireRefreshTokenCookie(c echo.Context, path string) {
+	c.SetCookie(&http.Cookie{
+		Name:     REFRESH_TOKEN_NAME,
+		Value:    "",
+		Secure:   true,
+		MaxAge:   -1,
+		Path:     path,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// expire the refresh token cookie on the client side
+func clearRefreshTokenCookie(c echo.Context) {
+	expireRefreshTokenCookie(c, LEGACY_REFRESH_TOKEN_PATH)
+	expireRefreshTokenCookie(c, REFRESH_TOKEN_PATH)
+}
+
+func (api *ApiHandler) Signout(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	refreshToken, err := c.Request().Cookie(REFRESH_TOKEN_NAME)
+	clearRefreshTokenCookie(c)
+	if err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusUnauthorized),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusUnauthorized, "you are not signed in, refresh token is missing")
+	}
+
+	response, err := api.Service.signout(ctx, refreshToken.Value)
 	if err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
 		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
 			slog.Int("status", http.StatusInternalServerError),
 			slog.Group("request",
@@ -315,10 +448,1461 @@ func (api *ApiHandler) Register(c echo.Context) error {
 			slog.String("error", err.Error()),
 			slog.String("trace", string(debug.Stack())),
 		)
-		return echo.NewHTTPError(
-			http.StatusInternalServerError,
-			"something went wrong, please try again later",
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) SignoutAll(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	response, err := api.Service.signoutAll(ctx, user.Id)
+	if err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	clearRefreshTokenCookie(c)
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) ListSessions(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	// the cookie is optional here, without it no session is flagged as current
+	currentToken := ""
+	if refreshToken, err := c.Request().Cookie(REFRESH_TOKEN_NAME); err == nil {
+		currentToken = refreshToken.Value
+	}
+
+	response, err := api.Service.listSessions(ctx, user.Id, currentToken)
+	if err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) RevokeSession(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	response, err := api.Service.revokeSession(ctx, user.Id, c.Param("id"))
+	if err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) ForgotPassword(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	data := forgotPasswordRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
 		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	data.remoteIP = c.RealIP()
+	response, err := api.Service.forgotPassword(ctx, data)
+	if err != nil {
+		setRetryAfter(c, err)
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) ResetPassword(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	data := resetPasswordRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	response, err := api.Service.resetPassword(ctx, data)
+	if err != nil {
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	clearRefreshTokenCookie(c)
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) VerifyEmail(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	data := verifyEmailRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	response, err := api.Service.verifyEmail(ctx, data)
+	if err != nil {
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) ResendVerification(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	response, err := api.Service.resendVerification(ctx, user.Id)
+	if err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) LoginTwoFactor(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	data := twoFactorLoginRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	data.remoteIP = c.RealIP()
+	data.agent = c.Request().UserAgent()
+	response, err := api.Service.loginTwoFactor(ctx, data)
+	if err != nil {
+		setRetryAfter(c, err)
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	setRefreshTokenCookie(c, response.Data.RefreshToken)
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) EnrollTwoFactor(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	response, err := api.Service.enrollTwoFactor(ctx, user.Id, user.Email)
+	if err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) ConfirmTwoFactor(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	data := twoFactorCodeRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	response, err := api.Service.confirmTwoFactor(ctx, user.Id, data)
+	if err != nil {
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) DisableTwoFactor(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	data := twoFactorCodeRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	response, err := api.Service.disableTwoFactor(ctx, user.Id, data)
+	if err != nil {
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) Unlock(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	data := unlockRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	response, err := api.Service.unlock(ctx, data)
+	if err != nil {
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+// JWKS is served as is without our response envelope, jwt libraries expect the standard format
+func (api *ApiHandler) JWKS(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, api.Service.jwks())
+}
+
+func (api *ApiHandler) OAuthStart(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	response, err := api.Service.startOAuth(ctx, c.Param("provider"))
+	if err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	setOAuthStateCookie(c, response.Data.stateToken, int(OAUTH_STATE_LIFETIME.Seconds()))
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) OAuthCallback(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	data := oauthCallbackRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	// state can only be used once, whatever the outcome is
+	stateCookie, err := c.Cookie(OAUTH_STATE_COOKIE_NAME)
+	if err == nil {
+		data.stateToken = stateCookie.Value
+	}
+	setOAuthStateCookie(c, "", -1)
+	data.remoteIP = c.RealIP()
+	data.agent = c.Request().UserAgent()
+	response, err := api.Service.oauthCallback(ctx, data)
+	if err != nil {
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if !response.Data.TwoFactorRequired {
+		setRefreshTokenCookie(c, response.Data.RefreshToken)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) CreatePersonalToken(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	data := personalTokenRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+
+	response, err := api.Service.createPersonalToken(ctx, user, data)
+	if err != nil {
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) ListPersonalTokens(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	response, err := api.Service.listPersonalTokens(ctx, user.Id)
+	if err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) RevokePersonalToken(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	response, err := api.Service.revokePersonalToken(ctx, user.Id, c.Param("id"))
+	if err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) ChangePassword(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	data := changePasswordRequest{
+		email:    user.Email,
+		fullname: user.Fullname,
+	}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	// without the cookie every session is signed out, including this one
+	if refreshToken, err := c.Request().Cookie(REFRESH_TOKEN_NAME); err == nil {
+		data.refreshToken = refreshToken.Value
+	}
+	data.remoteIP = c.RealIP()
+
+	response, err := api.Service.changePassword(ctx, user.Id, data)
+	if err != nil {
+		setRetryAfter(c, err)
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) ChangeEmail(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	data := changeEmailRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	data.remoteIP = c.RealIP()
+
+	response, err := api.Service.changeEmail(ctx, user.Id, data)
+	if err != nil {
+		setRetryAfter(c, err)
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiHandler) DeleteAccount(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	data := deleteAccountRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	data.remoteIP = c.RealIP()
+
+	response, err := api.Service.deleteAccount(ctx, user.Id, data)
+	if err != nil {
+		setRetryAfter(c, err)
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	clearRefreshTokenCookie(c)
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
 	}
 	return nil
 }
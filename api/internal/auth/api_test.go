@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshTokenCookie(t *testing.T) {
+	tests := []struct {
+		name   string
+		set    func(c echo.Context)
+		expect map[string]string
+	}{
+		{
+			name: "Issuing expire the legacy cookie",
+			set: func(c echo.Context) {
+				setRefreshTokenCookie(c, "new-token")
+			},
+			expect: map[string]string{LEGACY_REFRESH_TOKEN_PATH: "", REFRESH_TOKEN_PATH: "new-token"},
+		},
+		{
+			name:   "Clearing expire both",
+			set:    clearRefreshTokenCookie,
+			expect: map[string]string{LEGACY_REFRESH_TOKEN_PATH: "", REFRESH_TOKEN_PATH: ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/api/v1/signout", nil), rec)
+			tt.set(c)
+
+			cookies := rec.Result().Cookies()
+			require.Len(t, cookies, len(tt.expect))
+			for _, cookie := range cookies {
+				assert.Equal(t, REFRESH_TOKEN_NAME, cookie.Name)
+				value, ok := tt.expect[cookie.Path]
+				require.True(t, ok, cookie.Path)
+				assert.Equal(t, value, cookie.Value)
+				assert.Equal(t, value == "", cookie.MaxAge < 0, cookie.Path)
+				assert.True(t, cookie.HttpOnly)
+				assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"log/slog"
+	"time"
+)
+
+const (
+	DEFAULT_PASSWORD_RESET_LIFETIME      = time.Minute * 30
+	DEFAULT_PASSWORD_RESET_MAX_PER_EMAIL = 3
+	DEFAULT_PASSWORD_RESET_MAX_PER_IP    = 20
+	DEFAULT_PASSWORD_RESET_WINDOW        = time.Hour
+	DEFAULT_EMAIL_VERIFICATION_LIFETIME  = time.Hour * 24
+	DEFAULT_VERIFICATION_RESEND_COOLDOWN = time.Minute
+)
+
+// what happen to the content of deleted account
+const (
+	// personal data is wiped but posts and likes stay, shown as written by "[deleted]"
+	ACCOUNT_DELETION_ANONYMIZE = "anonymize"
+	// posts, their media and likes are deleted together with the account
+	ACCOUNT_DELETION_HARD_DELETE = "hard_delete"
+)
+
+type Config struct {
+	Session SessionConfig
+	Lockout LockoutConfig
+	// base url of the web client, used to build links we send by email
+	AppURL                string
+	PasswordResetLifetime time.Duration
+	// reset emails one address and one ip can ask for inside PasswordResetWindow, past it they wait a whole window
+	PasswordResetMaxPerEmail int
+	PasswordResetMaxPerIP    int
+	PasswordResetWindow      time.Duration
+	// how long the link in verification email is valid
+	EmailVerificationLifetime time.Duration
+	// minimum gap between two verification emails sent to the same user
+	VerificationResendCooldown time.Duration
+	// keyed by the name used in the url e.g /oauth/github
+	OAuthProviders map[string]OAuthProvider
+	// ACCOUNT_DELETION_ANONYMIZE or ACCOUNT_DELETION_HARD_DELETE
+	AccountDeletionPolicy string
+	Password              PasswordConfig
+	PasswordPolicy        PasswordPolicy
+	// optional, failures hidden from the client e.g an undelivered reset email are logged here instead of slog.Default()
+	Logger *slog.Logger
+}
+
+func (config Config) passwordResetLifetime() time.Duration {
+	if config.PasswordResetLifetime <= 0 {
+		return DEFAULT_PASSWORD_RESET_LIFETIME
+	}
+	return config.PasswordResetLifetime
+}
+
+func (config Config) passwordResetMaxPerEmail() int64 {
+	if config.PasswordResetMaxPerEmail <= 0 {
+		return DEFAULT_PASSWORD_RESET_MAX_PER_EMAIL
+	}
+	return int64(config.PasswordResetMaxPerEmail)
+}
+
+func (config Config) passwordResetMaxPerIP() int64 {
+	if config.PasswordResetMaxPerIP <= 0 {
+		return DEFAULT_PASSWORD_RESET_MAX_PER_IP
+	}
+	return int64(config.PasswordResetMaxPerIP)
+}
+
+func (config Config) passwordResetWindow() time.Duration {
+	if config.PasswordResetWindow <= 0 {
+		return DEFAULT_PASSWORD_RESET_WINDOW
+	}
+	return config.PasswordResetWindow
+}
+
+func (config Config) logger() *slog.Logger {
+	if config.Logger == nil {
+		return slog.Default()
+	}
+	return config.Logger
+}
+
+func (config Config) emailVerificationLifetime() time.Duration {
+	if config.EmailVerificationLifetime <= 0 {
+		return DEFAULT_EMAIL_VERIFICATION_LIFETIME
+	}
+	return config.EmailVerificationLifetime
+}
+
+func (config Config) verificationResendCooldown() time.Duration {
+	if config.VerificationResendCooldown <= 0 {
+		return DEFAULT_VERIFICATION_RESEND_COOLDOWN
+	}
+	return config.VerificationResendCooldown
+}
+
+func (config Config) accountDeletionPolicy() string {
+	if config.AccountDeletionPolicy != ACCOUNT_DELETION_HARD_DELETE {
+		return ACCOUNT_DELETION_ANONYMIZE
+	}
+	return config.AccountDeletionPolicy
+}
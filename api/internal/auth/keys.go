@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one key of the key set, the kid is put in the token header so verifier
+// know which key to use. retired key only have the public half and is kept to verify
+// tokens signed before the rotation until they expire
+type SigningKey struct {
+	Id      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// NewSigningKey accept rsa or ed25519 key, either the private or only the public one
+func NewSigningKey(kid string, key interface{}) (SigningKey, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return SigningKey{Id: kid, Method: jwt.SigningMethodRS256, Private: k, Public: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return SigningKey{Id: kid, Method: jwt.SigningMethodRS256, Public: k}, nil
+	case ed25519.PrivateKey:
+		return SigningKey{Id: kid, Method: jwt.SigningMethodEdDSA, Private: k, Public: k.Public()}, nil
+	case ed25519.PublicKey:
+		return SigningKey{Id: kid, Method: jwt.SigningMethodEdDSA, Public: k}, nil
+	default:
+		return SigningKey{}, fmt.Errorf("key %s: unsupported key type %T, use rsa or ed25519", kid, key)
+	}
+}
+
+type KeySet struct {
+	active SigningKey
+	keys   map[string]SigningKey
+}
+
+// NewKeySet sign with activeKid and verify with every key given, active key must have its private half
+func NewKeySet(activeKid string, keys ...SigningKey) (*KeySet, error) {
+	keySet := &KeySet{
+		keys: map[string]SigningKey{},
+	}
+	for _, key := range keys {
+		if _, ok := keySet.keys[key.Id]; ok {
+			return nil, fmt.Errorf("duplicate key id %s", key.Id)
+		}
+		keySet.keys[key.Id] = key
+	}
+	active, ok := keySet.keys[activeKid]
+	if !ok {
+		return nil, fmt.Errorf("active key %s not found", activeKid)
+	}
+	if active.Private == nil {
+		return nil, fmt.Errorf("active key %s has no private key, it can't sign", activeKid)
+	}
+	keySet.active = active
+	return keySet, nil
+}
+
+// LoadKeySet read every .pem file in dir, the file name without extension is the kid.
+// files can contain PKCS#8 / PKCS#1 private key or PKIX public key (for retired keys)
+func LoadKeySet(dir string, activeKid string) (*KeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys in %s %w", dir, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .pem key found in %s", dir)
+	}
+	keys := []SigningKey{}
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s %w", file, err)
+		}
+		kid := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		key, err := parsePEMKey(kid, raw)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return NewKeySet(activeKid, keys...)
+}
+
+func parsePEMKey(kid string, raw []byte) (SigningKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return SigningKey{}, fmt.Errorf("key %s is not pem encoded", kid)
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return SigningKey{}, fmt.Errorf("key %s: unsupported pem block %s", kid, block.Type)
+	}
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("key %s: failed to parse %w", kid, err)
+	}
+	return NewSigningKey(kid, key)
+}
+
+// Sign the claims with the active key
+func (keySet *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(keySet.active.Method, claims)
+	token.Header["kid"] = keySet.active.Id
+	return token.SignedString(keySet.active.Private)
+}
+
+// Keyfunc pick the verification key by kid, it also make sure the token alg is the one
+// the key is meant for so token can't be forged by switching the algorithm
+func (keySet *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, errors.New("token has no kid")
+	}
+	key, ok := keySet.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %s", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for kid %s", token.Method.Alg(), kid)
+	}
+	return key.Public, nil
+}
+
+// ValidMethods list every algorithm used by the keys
+func (keySet *KeySet) ValidMethods() []string {
+	methods := map[string]bool{}
+	for _, key := range keySet.keys {
+		methods[key.Method.Alg()] = true
+	}
+	result := []string{}
+	for method := range methods {
+		result = append(result, method)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// jsonWebKey follow RFC 7517, only the fields needed for rsa and ed25519 public keys
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// JWKS publish the public half of every key so other services can verify our tokens
+func (keySet *KeySet) JWKS() jsonWebKeySet {
+	keys := []jsonWebKey{}
+	for _, key := range keySet.keys {
+		jwk := jsonWebKey{
+			Kid: key.Id,
+			Use: "sig",
+			Alg: key.Method.Alg(),
+		}
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		keys = append(keys, jwk)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Kid < keys[j].Kid
+	})
+	return jsonWebKeySet{Keys: keys}
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePEM(t *testing.T, dir string, name string, blockType string, der []byte) {
+	t.Helper()
+	err := os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600)
+	require.NoError(t, err)
+}
+
+func TestKeySet_rotation(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	writePEM(t, dir, "2025-01.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	writePEM(t, dir, "2026-01.pem", "PRIVATE KEY", der)
+
+	oldKeys, err := LoadKeySet(dir, "2025-01")
+	require.NoError(t, err)
+	claims := CustomJWTClaims{
+		Id: "user-id",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+	oldToken, err := oldKeys.Sign(claims)
+	require.NoError(t, err)
+
+	// rotate: new key sign, the old one is retired to public only but still verify
+	require.NoError(t, os.Remove(filepath.Join(dir, "2025-01.pem")))
+	publicDer, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	writePEM(t, dir, "2025-01.pem", "PUBLIC KEY", publicDer)
+	keys, err := LoadKeySet(dir, "2026-01")
+	require.NoError(t, err)
+	newToken, err := keys.Sign(claims)
+	require.NoError(t, err)
+
+	for _, token := range []string{oldToken, newToken} {
+		parsed := &CustomJWTClaims{}
+		_, err := jwt.ParseWithClaims(token, parsed, keys.Keyfunc, jwt.WithValidMethods(keys.ValidMethods()))
+		require.NoError(t, err)
+		assert.Equal(t, "user-id", parsed.Id)
+	}
+	assert.Equal(t, []string{"EdDSA", "RS256"}, keys.ValidMethods())
+
+	jwks := keys.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "2025-01", jwks.Keys[0].Kid)
+	assert.Equal(t, "RSA", jwks.Keys[0].Kty)
+	assert.Equal(t, "AQAB", jwks.Keys[0].E)
+	assert.Equal(t, "2026-01", jwks.Keys[1].Kid)
+	assert.Equal(t, "OKP", jwks.Keys[1].Kty)
+	assert.Equal(t, "Ed25519", jwks.Keys[1].Crv)
+
+	_, err = LoadKeySet(dir, "2025-01")
+	assert.Error(t, err, "retired key can't be the active one")
+}
+
+func TestKeySet_rejectForgedTokens(t *testing.T) {
+	claims := jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}
+
+	// HS256 signed with the public key as secret is the classic algorithm confusion attack
+	hsToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	hsToken.Header["kid"] = "test"
+	forged, err := hsToken.SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = jwt.Parse(forged, testKeySet.Keyfunc)
+	assert.Error(t, err)
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	unknown, err := NewSigningKey("unknown", otherKey)
+	require.NoError(t, err)
+	unknownKeys, err := NewKeySet("unknown", unknown)
+	require.NoError(t, err)
+	token, err := unknownKeys.Sign(claims)
+	require.NoError(t, err)
+	_, err = jwt.Parse(token, testKeySet.Keyfunc)
+	assert.Error(t, err)
+}
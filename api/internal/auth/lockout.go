@@ -0,0 +1,308 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DEFAULT_LOGIN_MAX_ACCOUNT_ATTEMPTS = 5
+	DEFAULT_LOGIN_MAX_IP_ATTEMPTS      = 20
+	DEFAULT_LOGIN_ATTEMPT_WINDOW       = time.Minute * 15
+	DEFAULT_LOGIN_BASE_LOCKOUT         = time.Second * 30
+	DEFAULT_LOGIN_MAX_LOCKOUT          = time.Hour
+)
+
+// LockoutConfig control how many failed sign in attempts are tolerated before the account or ip is locked.
+// every failure past the limit double the lockout, starting from BaseLockout up to MaxLockout.
+// failures are forgotten once AttemptWindow passed without a new one
+type LockoutConfig struct {
+	MaxAccountAttempts int
+	MaxIPAttempts      int
+	AttemptWindow      time.Duration
+	BaseLockout        time.Duration
+	MaxLockout         time.Duration
+}
+
+func (config LockoutConfig) maxAccountAttempts() int64 {
+	if config.MaxAccountAttempts <= 0 {
+		return DEFAULT_LOGIN_MAX_ACCOUNT_ATTEMPTS
+	}
+	return int64(config.MaxAccountAttempts)
+}
+
+func (config LockoutConfig) maxIPAttempts() int64 {
+	if config.MaxIPAttempts <= 0 {
+		return DEFAULT_LOGIN_MAX_IP_ATTEMPTS
+	}
+	return int64(config.MaxIPAttempts)
+}
+
+func (config LockoutConfig) attemptWindow() time.Duration {
+	if config.AttemptWindow <= 0 {
+		return DEFAULT_LOGIN_ATTEMPT_WINDOW
+	}
+	return config.AttemptWindow
+}
+
+func (config LockoutConfig) baseLockout() time.Duration {
+	if config.BaseLockout <= 0 {
+		return DEFAULT_LOGIN_BASE_LOCKOUT
+	}
+	return config.BaseLockout
+}
+
+func (config LockoutConfig) maxLockout() time.Duration {
+	if config.MaxLockout <= 0 {
+		return DEFAULT_LOGIN_MAX_LOCKOUT
+	}
+	return config.MaxLockout
+}
+
+// lockoutDuration return how long the key is locked after reaching failures, zero means not locked yet
+func (config LockoutConfig) lockoutDuration(failures int64, limit int64) time.Duration {
+	if failures < limit {
+		return 0
+	}
+	exponent := float64(failures - limit)
+	lockout := float64(config.baseLockout()) * math.Pow(2, exponent)
+	if lockout >= float64(config.maxLockout()) {
+		return config.maxLockout()
+	}
+	return time.Duration(lockout)
+}
+
+// AttemptStore keep track of failed sign in attempts, keys are either account or ip based
+type AttemptStore interface {
+	// Fail record one failure for key and return the amount of failures inside the window
+	Fail(ctx context.Context, key string, window time.Duration) (int64, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	// LockedUntil return zero time when key is not locked
+	LockedUntil(ctx context.Context, key string) (time.Time, error)
+	Reset(ctx context.Context, key string) error
+}
+
+func accountAttemptKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// password reset requests are counted apart from sign in failures, asking for resets never lock the sign in
+func passwordResetAttemptKey(key string) string {
+	return "password_reset:" + key
+}
+
+// lockedOutError is returned by the service so the handler can tell the client when to retry
+type lockedOutError struct {
+	retryAfter time.Duration
+}
+
+func (err *lockedOutError) Error() string {
+	return fmt.Sprintf("too many failed sign in attempts, locked for %s", err.retryAfter)
+}
+
+// retryAfterSeconds round up, telling client to retry too early just earn them another 429
+func (err *lockedOutError) retryAfterSeconds() int64 {
+	return int64(math.Ceil(err.retryAfter.Seconds()))
+}
+
+type memoryAttempt struct {
+	failures    int64
+	windowEnds  time.Time
+	lockedUntil time.Time
+}
+
+const (
+	// every key is an email or ip sent by the client, the cap keep a flood of them from eating the memory
+	MEMORY_ATTEMPT_STORE_MAX_KEYS = 100_000
+	// expired entries nobody ask for again are swept at most once per this interval
+	MEMORY_ATTEMPT_SWEEP_INTERVAL = time.Minute
+)
+
+// MemoryAttemptStore keep attempts in process memory, only suitable for single instance deployment
+type MemoryAttemptStore struct {
+	mu        sync.Mutex
+	attempts  map[string]*memoryAttempt
+	now       func() time.Time
+	maxKeys   int
+	nextSweep time.Time
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{
+		attempts: map[string]*memoryAttempt{},
+		now:      time.Now,
+		maxKeys:  MEMORY_ATTEMPT_STORE_MAX_KEYS,
+	}
+}
+
+func (attempt *memoryAttempt) expired(now time.Time) bool {
+	return now.After(attempt.windowEnds) && now.After(attempt.lockedUntil)
+}
+
+// add a new entry for key, expired entries are swept first and when the store is still full
+// an entry that isn't locked make room, so lockouts survive a flood of new keys
+func (store *MemoryAttemptStore) add(key string) *memoryAttempt {
+	now := store.now()
+	if now.After(store.nextSweep) || len(store.attempts) >= store.maxKeys {
+		for existing, attempt := range store.attempts {
+			if attempt.expired(now) {
+				delete(store.attempts, existing)
+			}
+		}
+		store.nextSweep = now.Add(MEMORY_ATTEMPT_SWEEP_INTERVAL)
+	}
+	if len(store.attempts) >= store.maxKeys {
+		victim := ""
+		for existing, attempt := range store.attempts {
+			victim = existing
+			if !now.Before(attempt.lockedUntil) {
+				break
+			}
+		}
+		delete(store.attempts, victim)
+	}
+	attempt := &memoryAttempt{}
+	store.attempts[key] = attempt
+	return attempt
+}
+
+// get the entry for key, dropping it when both the window and the lock already passed
+func (store *MemoryAttemptStore) get(key string) *memoryAttempt {
+	attempt, ok := store.attempts[key]
+	if !ok {
+		return nil
+	}
+	if attempt.expired(store.now()) {
+		delete(store.attempts, key)
+		return nil
+	}
+	return attempt
+}
+
+func (store *MemoryAttemptStore) Fail(ctx context.Context, key string, window time.Duration) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	attempt := store.get(key)
+	if attempt == nil {
+		attempt = store.add(key)
+	}
+	if store.now().After(attempt.windowEnds) {
+		attempt.failures = 0
+	}
+	attempt.failures++
+	attempt.windowEnds = store.now().Add(window)
+	return attempt.failures, nil
+}
+
+func (store *MemoryAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	attempt := store.get(key)
+	if attempt == nil {
+		attempt = store.add(key)
+	}
+	attempt.lockedUntil = until
+	return nil
+}
+
+func (store *MemoryAttemptStore) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	attempt := store.get(key)
+	if attempt == nil || !store.now().Before(attempt.lockedUntil) {
+		return time.Time{}, nil
+	}
+	return attempt.lockedUntil, nil
+}
+
+func (store *MemoryAttemptStore) Reset(ctx context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.attempts, key)
+	return nil
+}
+
+const REDIS_ATTEMPT_PREFIX = "login_attempt:"
+
+// RedisAttemptStore share attempts between every instance of the api
+type RedisAttemptStore struct {
+	client redis.UniversalClient
+}
+
+func NewRedisAttemptStore(client redis.UniversalClient) *RedisAttemptStore {
+	return &RedisAttemptStore{
+		client: client,
+	}
+}
+
+func (store *RedisAttemptStore) failuresKey(key string) string {
+	return REDIS_ATTEMPT_PREFIX + "failures:" + key
+}
+
+func (store *RedisAttemptStore) lockKey(key string) string {
+	return REDIS_ATTEMPT_PREFIX + "lock:" + key
+}
+
+func (store *RedisAttemptStore) Fail(ctx context.Context, key string, window time.Duration) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := store.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, store.failuresKey(key))
+		pipe.Expire(ctx, store.failuresKey(key), window)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("redis: failed to record sign in failure %w", err)
+	}
+	return incr.Val(), nil
+}
+
+func (store *RedisAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	err := store.client.Set(ctx, store.lockKey(key), until.UnixMilli(), ttl).Err()
+	if err != nil {
+		return fmt.Errorf("redis: failed to lock %s %w", key, err)
+	}
+	return nil
+}
+
+func (store *RedisAttemptStore) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	value, err := store.client.Get(ctx, store.lockKey(key)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("redis: failed to get lock of %s %w", key, err)
+	}
+	until, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("redis: lock of %s is corrupted %w", key, err)
+	}
+	return time.UnixMilli(until), nil
+}
+
+func (store *RedisAttemptStore) Reset(ctx context.Context, key string) error {
+	err := store.client.Del(ctx, store.failuresKey(key), store.lockKey(key)).Err()
+	if err != nil {
+		return fmt.Errorf("redis: failed to reset %s %w", key, err)
+	}
+	return nil
+}
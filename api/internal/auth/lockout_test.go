@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockoutConfig_lockoutDuration(t *testing.T) {
+	config := LockoutConfig{BaseLockout: time.Second * 30, MaxLockout: time.Minute * 5}
+
+	assert.Equal(t, time.Duration(0), config.lockoutDuration(4, 5))
+	assert.Equal(t, time.Second*30, config.lockoutDuration(5, 5))
+	assert.Equal(t, time.Minute, config.lockoutDuration(6, 5))
+	assert.Equal(t, time.Minute*2, config.lockoutDuration(7, 5))
+	assert.Equal(t, time.Minute*5, config.lockoutDuration(9, 5))
+	assert.Equal(t, time.Minute*5, config.lockoutDuration(200, 5))
+}
+
+func TestMemoryAttemptStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+	store := NewMemoryAttemptStore()
+	store.now = func() time.Time { return now }
+
+	failures, err := store.Fail(ctx, "account:a", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), failures)
+	failures, _ = store.Fail(ctx, "account:a", time.Minute)
+	assert.Equal(t, int64(2), failures)
+
+	// window slide on every failure, failures are forgotten after a quiet window
+	now = now.Add(time.Minute * 2)
+	failures, _ = store.Fail(ctx, "account:a", time.Minute)
+	assert.Equal(t, int64(1), failures)
+
+	require.NoError(t, store.Lock(ctx, "account:a", now.Add(time.Minute)))
+	lockedUntil, err := store.LockedUntil(ctx, "account:a")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Minute), lockedUntil)
+
+	now = now.Add(time.Minute)
+	lockedUntil, _ = store.LockedUntil(ctx, "account:a")
+	assert.True(t, lockedUntil.IsZero())
+
+	require.NoError(t, store.Lock(ctx, "ip:127.0.0.1", now.Add(time.Hour)))
+	require.NoError(t, store.Reset(ctx, "ip:127.0.0.1"))
+	lockedUntil, _ = store.LockedUntil(ctx, "ip:127.0.0.1")
+	assert.True(t, lockedUntil.IsZero())
+}
+
+func TestMemoryAttemptStore_bounded(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+	store := NewMemoryAttemptStore()
+	store.now = func() time.Time { return now }
+	store.maxKeys = 3
+
+	require.NoError(t, store.Lock(ctx, "account:victim", now.Add(time.Hour)))
+	for _, key := range []string{"ip:1", "ip:2", "ip:3", "ip:4"} {
+		_, err := store.Fail(ctx, key, time.Minute)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(store.attempts), 3)
+	}
+	// the flood of new keys never push a lockout out
+	lockedUntil, _ := store.LockedUntil(ctx, "account:victim")
+	assert.Equal(t, now.Add(time.Hour), lockedUntil)
+
+	// expired entries are swept once the interval passed
+	now = now.Add(MEMORY_ATTEMPT_SWEEP_INTERVAL * 2)
+	_, err := store.Fail(ctx, "ip:5", time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, store.attempts, 2)
+}
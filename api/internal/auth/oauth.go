@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	TOKEN_PURPOSE_OAUTH_STATE = "oauth_state"
+	OAUTH_STATE_COOKIE_NAME   = "oauth_state"
+	OAUTH_STATE_COOKIE_PATH   = "/api/v1/oauth"
+	// user has this long to finish the consent screen of the provider
+	OAUTH_STATE_LIFETIME = time.Minute * 10
+)
+
+// OAuthProvider describe an OAuth2 / OpenID Connect provider, every url is configurable
+// so it works with self hosted gitlab and with a stub provider in tests
+type OAuthProvider struct {
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	// optional, github only return public email from user info, the rest is listed here
+	EmailsURL   string
+	RedirectURL string
+	Scopes      []string
+	// provider that only hand out verified email (e.g github, gitlab) but doesn't say so in user info
+	TrustEmail bool
+}
+
+// oauthIdentity is the user as seen by the provider
+type oauthIdentity struct {
+	provider      string
+	subject       string
+	email         string
+	emailVerified bool
+	name          string
+}
+
+// oauthStateClaims is kept in a cookie between the redirect to the provider and the callback,
+// the jwt id is the state and the pkce verifier never leave the user browser and our api
+type oauthStateClaims struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"code_verifier"`
+	jwt.RegisteredClaims
+}
+
+var oauthHTTPClient = &http.Client{Timeout: time.Second * 10}
+
+func randomURLSafe(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random string %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// S256 code challenge as described in RFC 7636
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (provider OAuthProvider) authorizationURL(state string, verifier string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.ClientID)
+	query.Set("redirect_uri", provider.RedirectURL)
+	query.Set("scope", strings.Join(provider.Scopes, " "))
+	query.Set("state", state)
+	query.Set("code_challenge", pkceChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	separator := "?"
+	if strings.Contains(provider.AuthURL, "?") {
+		separator = "&"
+	}
+	return provider.AuthURL + separator + query.Encode()
+}
+
+func (provider OAuthProvider) exchangeCode(ctx context.Context, code string, verifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", provider.RedirectURL)
+	form.Set("client_id", provider.ClientID)
+	form.Set("client_secret", provider.ClientSecret)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("oauth: failed to build token request %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// github answer with form encoded body unless asked for json
+	req.Header.Set("Accept", "application/json")
+
+	token := struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}{}
+	err = doOAuthRequest(req, &token)
+	if err != nil {
+		return "", err
+	}
+	if token.Error != "" || token.AccessToken == "" {
+		return "", fmt.Errorf("oauth: provider rejected the code: %s", token.Error)
+	}
+	return token.AccessToken, nil
+}
+
+func (provider OAuthProvider) fetchIdentity(ctx context.Context, name string, accessToken string) (oauthIdentity, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.UserInfoURL, nil)
+	if err != nil {
+		return oauthIdentity{}, fmt.Errorf("oauth: failed to build user info request %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	info := map[string]interface{}{}
+	err = doOAuthRequest(req, &info)
+	if err != nil {
+		return oauthIdentity{}, err
+	}
+	identity := oauthIdentity{
+		provider: name,
+		// openid connect use "sub", github and gitlab use numeric "id"
+		subject: claimString(info, "sub", "id"),
+		email:   claimString(info, "email"),
+		name:    claimString(info, "name", "login", "preferred_username", "username"),
+	}
+	if verified, ok := info["email_verified"].(bool); ok {
+		identity.emailVerified = verified
+	} else {
+		identity.emailVerified = identity.email != "" && provider.TrustEmail
+	}
+	if identity.email == "" && provider.EmailsURL != "" {
+		identity.email, identity.emailVerified, err = provider.fetchPrimaryEmail(ctx, accessToken)
+		if err != nil {
+			return oauthIdentity{}, err
+		}
+	}
+	if identity.subject == "" {
+		return oauthIdentity{}, fmt.Errorf("oauth: user info of %s has no subject", name)
+	}
+	if identity.email == "" {
+		return oauthIdentity{}, fmt.Errorf("oauth: user info of %s has no email", name)
+	}
+	if identity.name == "" {
+		identity.name = strings.Split(identity.email, "@")[0]
+	}
+	return identity, nil
+}
+
+func (provider OAuthProvider) fetchPrimaryEmail(ctx context.Context, accessToken string) (string, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.EmailsURL, nil)
+	if err != nil {
+		return "", false, fmt.Errorf("oauth: failed to build emails request %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	emails := []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}{}
+	err = doOAuthRequest(req, &emails)
+	if err != nil {
+		return "", false, err
+	}
+	for _, email := range emails {
+		if email.Primary {
+			return email.Email, email.Verified, nil
+		}
+	}
+	return "", false, nil
+}
+
+func doOAuthRequest(req *http.Request, result interface{}) error {
+	resp, err := oauthHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("oauth: request to %s failed %w", req.URL.Host, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("oauth: failed to read response of %s %w", req.URL.Host, err)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("oauth: %s responded with %d", req.URL.Host, resp.StatusCode)
+	}
+	err = json.Unmarshal(body, result)
+	if err != nil {
+		return fmt.Errorf("oauth: invalid response of %s %w", req.URL.Host, err)
+	}
+	return nil
+}
+
+// claimString return the first non empty claim, numbers are converted since github id is numeric
+func claimString(claims map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch value := claims[key].(type) {
+		case string:
+			if value != "" {
+				return value
+			}
+		case float64:
+			return strconv.FormatFloat(value, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+func (service *ServiceImpl) signOAuthState(provider string, state string, verifier string) (string, error) {
+	token, err := service.keys.Sign(oauthStateClaims{
+		Provider:     provider,
+		CodeVerifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        state,
+			Audience:  jwt.ClaimStrings{TOKEN_PURPOSE_OAUTH_STATE},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(OAUTH_STATE_LIFETIME)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to sign oauth state %w", err)
+	}
+	return token, nil
+}
+
+func (service *ServiceImpl) parseOAuthState(token string) (*oauthStateClaims, error) {
+	claims := &oauthStateClaims{}
+	_, err := jwt.ParseWithClaims(
+		token,
+		claims,
+		service.keys.Keyfunc,
+		jwt.WithAudience(TOKEN_PURPOSE_OAUTH_STATE),
+		jwt.WithValidMethods(service.keys.ValidMethods()),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid oauth state %w", err)
+	}
+	return claims, nil
+}
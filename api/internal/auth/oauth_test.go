@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	apperror "github.com/zulfikarrosadi/code_roast/internal/app-error"
+	"github.com/zulfikarrosadi/code_roast/internal/user"
+)
+
+// stubProvider act as the authorization server, it remember the pkce challenge of the one code it issue
+type stubProvider struct {
+	*httptest.Server
+	challenge string
+	userInfo  map[string]interface{}
+}
+
+func newStubProvider(t *testing.T, userInfo map[string]interface{}) *stubProvider {
+	stub := &stubProvider{userInfo: userInfo}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		if r.Form.Get("code") != "stub-code" || pkceChallenge(r.Form.Get("code_verifier")) != stub.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "stub-access-token", "token_type": "bearer"})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer stub-access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(stub.userInfo)
+	})
+	stub.Server = httptest.NewServer(mux)
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func (stub *stubProvider) provider() OAuthProvider {
+	return OAuthProvider{
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		AuthURL:      stub.URL + "/authorize",
+		TokenURL:     stub.URL + "/token",
+		UserInfoURL:  stub.URL + "/userinfo",
+		RedirectURL:  "http://localhost/oauth/stub/callback",
+		Scopes:       []string{"openid", "email"},
+	}
+}
+
+// startFlow play the part of the browser: start, follow the consent screen and come back with code and state
+func startFlow(t *testing.T, service *ServiceImpl, stub *stubProvider) oauthCallbackRequest {
+	resp, err := service.startOAuth(context.Background(), "stub")
+	require.NoError(t, err)
+	authURL, err := url.Parse(resp.Data.AuthorizationURL)
+	require.NoError(t, err)
+	assert.Equal(t, "S256", authURL.Query().Get("code_challenge_method"))
+	assert.Equal(t, "client-id", authURL.Query().Get("client_id"))
+	stub.challenge = authURL.Query().Get("code_challenge")
+
+	return oauthCallbackRequest{
+		Provider:   "stub",
+		Code:       "stub-code",
+		State:      authURL.Query().Get("state"),
+		stateToken: resp.Data.stateToken,
+	}
+}
+
+func TestServiceImpl_oauthCallback(t *testing.T) {
+	stub := newStubProvider(t, map[string]interface{}{
+		"sub":            "stub-123",
+		"email":          "octo@example.com",
+		"email_verified": true,
+		"name":           "Octo Cat",
+	})
+	existing := user.User{Id: "user-id", Email: "octo@example.com", Fullname: "Octo Cat"}
+	notFound := apperror.New(http.StatusNotFound, "not found", nil)
+
+	tests := []struct {
+		name       string
+		mockRepo   func(*mockRepository)
+		tamper     func(*oauthCallbackRequest)
+		expectCode int
+	}{
+		{
+			name: "Linked identity sign in",
+			mockRepo: func(m *mockRepository) {
+				m.On("findUserByIdentity", mock.Anything, "stub", "stub-123").Return(existing, nil)
+				m.On("createAuthentication", mock.Anything, mock.Anything).Return(nil)
+			},
+			expectCode: http.StatusOK,
+		},
+		{
+			name: "Verified email is linked to existing account",
+			mockRepo: func(m *mockRepository) {
+				m.On("findUserByIdentity", mock.Anything, "stub", "stub-123").Return(user.User{}, notFound)
+				m.On("linkIdentity", mock.Anything, "octo@example.com", mock.MatchedBy(func(i userIdentity) bool {
+					return i.provider == "stub" && i.subject == "stub-123"
+				})).Return(existing, nil)
+				m.On("createAuthentication", mock.Anything, mock.Anything).Return(nil)
+			},
+			expectCode: http.StatusOK,
+		},
+		{
+			name: "Existing account with unverified email is not linked",
+			mockRepo: func(m *mockRepository) {
+				m.On("findUserByIdentity", mock.Anything, "stub", "stub-123").Return(user.User{}, notFound)
+				m.On("linkIdentity", mock.Anything, "octo@example.com", mock.Anything).Return(
+					user.User{},
+					apperror.New(http.StatusConflict, "an account with this email already exists", nil),
+				)
+			},
+			expectCode: http.StatusConflict,
+		},
+		{
+			name: "First sign in create member account",
+			mockRepo: func(m *mockRepository) {
+				m.On("findUserByIdentity", mock.Anything, "stub", "stub-123").Return(user.User{}, notFound)
+				m.On("linkIdentity", mock.Anything, "octo@example.com", mock.Anything).Return(user.User{}, notFound)
+				m.On("createOAuthUser", mock.Anything, mock.MatchedBy(func(u user.User) bool {
+					return u.Email == "octo@example.com" && u.Fullname == "Octo Cat" && u.EmailVerifiedAt != 0 && u.Password == ""
+				}), mock.Anything).Return(existing, nil)
+				m.On("createAuthentication", mock.Anything, mock.Anything).Return(nil)
+			},
+			expectCode: http.StatusOK,
+		},
+		{
+			name:     "State from another flow",
+			mockRepo: func(m *mockRepository) {},
+			tamper: func(data *oauthCallbackRequest) {
+				data.State = "forged"
+			},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Wrong code",
+			mockRepo: func(m *mockRepository) {},
+			tamper: func(data *oauthCallbackRequest) {
+				data.Code = "wrong"
+			},
+			expectCode: http.StatusBadGateway,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(mockRepository)
+			tt.mockRepo(mockRepo)
+			service := newTestService(mockRepo)
+			service.config.OAuthProviders = map[string]OAuthProvider{"stub": stub.provider()}
+
+			data := startFlow(t, service, stub)
+			if tt.tamper != nil {
+				tt.tamper(&data)
+			}
+			resp, err := service.oauthCallback(context.Background(), data)
+			assert.Equal(t, tt.expectCode, resp.Code)
+			if tt.expectCode == http.StatusOK {
+				require.NoError(t, err)
+				assert.Equal(t, "user-id", resp.Data.User.ID)
+				assert.NotEmpty(t, resp.Data.AccessToken)
+				assert.NotEmpty(t, resp.Data.RefreshToken)
+			} else {
+				assert.Error(t, err)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOAuthProvider_fetchIdentity(t *testing.T) {
+	// github style: numeric id, no email_verified claim
+	stub := newStubProvider(t, map[string]interface{}{
+		"id":    float64(583231),
+		"login": "octocat",
+		"email": "octo@example.com",
+	})
+	provider := stub.provider()
+
+	identity, err := provider.fetchIdentity(context.Background(), "github", "stub-access-token")
+	require.NoError(t, err)
+	assert.Equal(t, "583231", identity.subject)
+	assert.Equal(t, "octocat", identity.name)
+	assert.False(t, identity.emailVerified)
+
+	provider.TrustEmail = true
+	identity, err = provider.fetchIdentity(context.Background(), "github", "stub-access-token")
+	require.NoError(t, err)
+	assert.True(t, identity.emailVerified)
+}
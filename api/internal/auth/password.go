@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	PASSWORD_ALGORITHM_BCRYPT   = "bcrypt"
+	PASSWORD_ALGORITHM_ARGON2ID = "argon2id"
+
+	DEFAULT_BCRYPT_COST = 10
+	// second recommended option of RFC 9106 for memory constrained environment
+	DEFAULT_ARGON2_TIME    = 3
+	DEFAULT_ARGON2_MEMORY  = 64 * 1024
+	DEFAULT_ARGON2_THREADS = 4
+
+	ARGON2_SALT_LENGTH = 16
+	ARGON2_KEY_LENGTH  = 32
+
+	// bcrypt refuse longer input, argon2id take any length and the cap only keep a huge input from costing hashing time
+	BCRYPT_MAX_PASSWORD_BYTES = 72
+	ARGON2_MAX_PASSWORD_BYTES = 1024
+)
+
+var ErrPasswordMismatch = errors.New("password doesn't match")
+
+// PasswordConfig pick the algorithm for new hashes. stored hashes describe their own algorithm and
+// parameters, so old ones keep working and are upgraded the next time the owner sign in
+type PasswordConfig struct {
+	// PASSWORD_ALGORITHM_BCRYPT or PASSWORD_ALGORITHM_ARGON2ID
+	Algorithm  string
+	BcryptCost int
+	// iterations
+	Argon2Time uint32
+	// in KiB
+	Argon2Memory  uint32
+	Argon2Threads uint8
+}
+
+func (config PasswordConfig) algorithm() string {
+	if config.Algorithm != PASSWORD_ALGORITHM_ARGON2ID {
+		return PASSWORD_ALGORITHM_BCRYPT
+	}
+	return config.Algorithm
+}
+
+// maxPasswordBytes is the longest password the configured algorithm can hash
+func (config PasswordConfig) maxPasswordBytes() int {
+	if config.algorithm() == PASSWORD_ALGORITHM_ARGON2ID {
+		return ARGON2_MAX_PASSWORD_BYTES
+	}
+	return BCRYPT_MAX_PASSWORD_BYTES
+}
+
+func (config PasswordConfig) bcryptCost() int {
+	if config.BcryptCost < bcrypt.MinCost || config.BcryptCost > bcrypt.MaxCost {
+		return DEFAULT_BCRYPT_COST
+	}
+	return config.BcryptCost
+}
+
+func (config PasswordConfig) argon2Params() argon2Params {
+	params := argon2Params{
+		time:    config.Argon2Time,
+		memory:  config.Argon2Memory,
+		threads: config.Argon2Threads,
+	}
+	if params.time == 0 {
+		params.time = DEFAULT_ARGON2_TIME
+	}
+	if params.memory == 0 {
+		params.memory = DEFAULT_ARGON2_MEMORY
+	}
+	if params.threads == 0 {
+		params.threads = DEFAULT_ARGON2_THREADS
+	}
+	return params
+}
+
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify return ErrPasswordMismatch when password doesn't match, whatever algorithm hash was made with
+	Verify(hash string, password string) error
+	// NeedsRehash report whether hash was made with other algorithm or weaker parameters than configured
+	NeedsRehash(hash string) bool
+}
+
+type passwordHasher struct {
+	config PasswordConfig
+}
+
+func NewPasswordHasher(config PasswordConfig) PasswordHasher {
+	return &passwordHasher{
+		config: config,
+	}
+}
+
+func (hasher *passwordHasher) Hash(password string) (string, error) {
+	if hasher.config.algorithm() == PASSWORD_ALGORITHM_ARGON2ID {
+		return hashArgon2id(password, hasher.config.argon2Params())
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), hasher.config.bcryptCost())
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password with bcrypt %w", err)
+	}
+	return string(hash), nil
+}
+
+func (hasher *passwordHasher) Verify(hash string, password string) error {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		return verifyArgon2id(hash, password)
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrPasswordMismatch
+		}
+		return fmt.Errorf("failed to verify bcrypt hash %w", err)
+	}
+	return nil
+}
+
+func (hasher *passwordHasher) NeedsRehash(hash string) bool {
+	if hasher.config.algorithm() == PASSWORD_ALGORITHM_ARGON2ID {
+		params, _, _, err := decodeArgon2id(hash)
+		if err != nil {
+			return true
+		}
+		wanted := hasher.config.argon2Params()
+		return params.time < wanted.time || params.memory < wanted.memory || params.threads < wanted.threads
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
+	}
+	return cost < hasher.config.bcryptCost()
+}
+
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// hash is encoded in the PHC string format e.g $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+func hashArgon2id(password string, params argon2Params) (string, error) {
+	salt := make([]byte, ARGON2_SALT_LENGTH)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate argon2 salt %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, ARGON2_KEY_LENGTH)
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.memory,
+		params.time,
+		params.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func decodeArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	// first part is empty because the hash start with $
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return argon2Params{}, nil, nil, errors.New("not an argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Params{}, nil, nil, fmt.Errorf("unsupported argon2 version %s", parts[2])
+	}
+	params := argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return argon2Params{}, nil, nil, fmt.Errorf("invalid argon2 parameters %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2Params{}, nil, nil, fmt.Errorf("invalid argon2 salt %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return argon2Params{}, nil, nil, fmt.Errorf("invalid argon2 key %w", err)
+	}
+	return params, salt, key, nil
+}
+
+func verifyArgon2id(hash string, password string) error {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	candidate := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(candidate, key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	DEFAULT_PASSWORD_MIN_LENGTH = 8
+	// 0 (too guessable) to 4 (very unguessable), see passwordScore
+	DEFAULT_PASSWORD_MIN_SCORE = 2
+
+	// tags reported to the validator, apperror.HandlerValidatorError turn them into messages
+	PASSWORD_TAG_LENGTH   = "password_length"
+	PASSWORD_TAG_TOO_LONG = "password_too_long"
+	PASSWORD_TAG_PERSONAL = "password_personal"
+	PASSWORD_TAG_WEAK     = "password_weak"
+	PASSWORD_TAG_BREACHED = "password_breached"
+
+	// sha1 prefix length used by the k-anonymity range files
+	BREACHED_PASSWORD_PREFIX_LENGTH = 5
+)
+
+// PasswordPolicy is checked every time user pick a new password
+type PasswordPolicy struct {
+	MinLength int
+	// nil use DEFAULT_PASSWORD_MIN_SCORE, 0 turn the strength check off
+	MinScore *int
+	// optional, nil skip the breached password check
+	Breached BreachedPasswords
+	// optional, failures of the breached password list are logged here instead of slog.Default()
+	Logger *slog.Logger
+	// set by NewUserService to what the password hasher accept, zero is the bcrypt limit
+	maxBytes int
+}
+
+func (policy PasswordPolicy) minLength() int {
+	if policy.MinLength <= 0 {
+		return DEFAULT_PASSWORD_MIN_LENGTH
+	}
+	return policy.MinLength
+}
+
+func (policy PasswordPolicy) minScore() int {
+	if policy.MinScore == nil {
+		return DEFAULT_PASSWORD_MIN_SCORE
+	}
+	return *policy.MinScore
+}
+
+func (policy PasswordPolicy) maxPasswordBytes() int {
+	if policy.maxBytes <= 0 {
+		return BCRYPT_MAX_PASSWORD_BYTES
+	}
+	return policy.maxBytes
+}
+
+func (policy PasswordPolicy) logger() *slog.Logger {
+	if policy.Logger == nil {
+		return slog.Default()
+	}
+	return policy.Logger
+}
+
+// check return the validator tag of the first rule password breaks and its param, empty tag means it pass.
+// personal is anything the user told us about them e.g email and full name
+func (policy PasswordPolicy) check(password string, personal ...string) (string, string) {
+	if len([]rune(password)) < policy.minLength() {
+		return PASSWORD_TAG_LENGTH, strconv.Itoa(policy.minLength())
+	}
+	// counted in bytes, that is what the hasher is limited by
+	if len(password) > policy.maxPasswordBytes() {
+		return PASSWORD_TAG_TOO_LONG, strconv.Itoa(policy.maxPasswordBytes())
+	}
+	if containsPersonalInfo(password, personal...) {
+		return PASSWORD_TAG_PERSONAL, ""
+	}
+	if policy.minScore() > 0 && (commonPassword(password) || passwordScore(password) < policy.minScore()) {
+		return PASSWORD_TAG_WEAK, ""
+	}
+	if policy.Breached != nil {
+		breached, err := policy.Breached.Contains(password)
+		if err != nil {
+			// the list is a second line of defense, sign up shouldn't go down with it
+			policy.logger().LogAttrs(context.Background(), slog.LevelError, "BREACHED_PASSWORD_CHECK_ERROR",
+				slog.String("error", err.Error()),
+			)
+		} else if breached {
+			return PASSWORD_TAG_BREACHED, ""
+		}
+	}
+	return "", ""
+}
+
+// validateStruct is registered on the validator for every request carrying a new password
+func (policy PasswordPolicy) validateStruct(sl validator.StructLevel) {
+	var password string
+	var personal []string
+	switch data := sl.Current().Interface().(type) {
+	case registrationRequest:
+		password, personal = data.Password, []string{data.Email, data.Fullname}
+	case changePasswordRequest:
+		password, personal = data.Password, []string{data.email, data.fullname}
+	case resetPasswordRequest:
+		password, personal = data.Password, []string{data.email, data.fullname}
+	default:
+		return
+	}
+	// empty password is already reported by the required tag
+	if password == "" {
+		return
+	}
+	if tag, param := policy.check(password, personal...); tag != "" {
+		sl.ReportError(password, "Password", "Password", tag, param)
+	}
+}
+
+// RegisterPasswordPolicy make v enforce policy on registration, password reset and password change
+func RegisterPasswordPolicy(v *validator.Validate, policy PasswordPolicy) {
+	v.RegisterStructValidation(policy.validateStruct, registrationRequest{}, changePasswordRequest{}, resetPasswordRequest{})
+}
+
+func containsPersonalInfo(password string, personal ...string) bool {
+	password = strings.ToLower(password)
+	for _, info := range personal {
+		info = strings.ToLower(info)
+		parts := strings.FieldsFunc(info, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		// the whole email, its local part and every word of the name
+		if at := strings.Index(info, "@"); at > 0 {
+			parts = append(parts, info, info[:at])
+		}
+		for _, part := range parts {
+			// very short word like "al" appear in too many passwords by accident
+			if len([]rune(part)) >= 3 && strings.Contains(password, part) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = func() map[string]bool {
+	words := map[string]bool{}
+	for _, line := range strings.Split(commonPasswordList, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			words[line] = true
+		}
+	}
+	return words
+}()
+
+var leetspeak = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i")
+
+// commonPassword catch the popular passwords decorated the way their owners believe make them safe,
+// "Password1!" and "P@ssw0rd2024" are both "password"
+func commonPassword(password string) bool {
+	notLetter := func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}
+	word := strings.TrimFunc(strings.ToLower(password), func(r rune) bool {
+		return unicode.IsDigit(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r)
+	})
+	if commonPasswords[word] {
+		return true
+	}
+	word = strings.TrimFunc(leetspeak.Replace(word), notLetter)
+	return commonPasswords[word]
+}
+
+var keyboardRows = []string{
+	"`1234567890-=",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+	"abcdefghijklmnopqrstuvwxyz",
+}
+
+// predictable return true when next follow prev in a way attacker guess first:
+// repeated char, alphabet or digit sequence and keyboard walk, in either direction
+func predictable(prev rune, next rune) bool {
+	prev, next = unicode.ToLower(prev), unicode.ToLower(next)
+	if prev == next {
+		return true
+	}
+	for _, row := range keyboardRows {
+		i := strings.IndexRune(row, prev)
+		j := strings.IndexRune(row, next)
+		if i >= 0 && j >= 0 && (i-j == 1 || j-i == 1) {
+			return true
+		}
+	}
+	return false
+}
+
+// passwordScore estimate how many guesses a brute force take and put it on a 0-4 scale.
+// every char cost log2(charset) bits, except the predictable ones that only cost one bit.
+// it knows nothing about words, commonPassword is checked next to it
+func passwordScore(password string) int {
+	charset := 0
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+	if hasLower {
+		charset += 26
+	}
+	if hasUpper {
+		charset += 26
+	}
+	if hasDigit {
+		charset += 10
+	}
+	if hasSymbol {
+		charset += 33
+	}
+	if charset == 0 {
+		return 0
+	}
+
+	bitsPerChar := math.Log2(float64(charset))
+	bits := 0.0
+	var prev rune
+	for i, r := range []rune(password) {
+		if i > 0 && predictable(prev, r) {
+			bits++
+		} else {
+			bits += bitsPerChar
+		}
+		prev = r
+	}
+
+	switch {
+	case bits < 25:
+		return 0
+	case bits < 35:
+		return 1
+	case bits < 50:
+		return 2
+	case bits < 65:
+		return 3
+	default:
+		return 4
+	}
+}
+
+type BreachedPasswords interface {
+	Contains(password string) (bool, error)
+}
+
+// BreachedPasswordDir look passwords up in a directory of k-anonymity range files, the same layout
+// the haveibeenpwned downloader produce: one <PREFIX>.txt per 5 char sha1 prefix, each line is SUFFIX:COUNT.
+// only the prefix file of the password is read so the full list never has to fit in memory
+type BreachedPasswordDir struct {
+	dir string
+}
+
+func NewBreachedPasswordDir(dir string) (*BreachedPasswordDir, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("breached password list %s can't be opened %w", dir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached password list %s is not a directory", dir)
+	}
+	return &BreachedPasswordDir{
+		dir: dir,
+	}, nil
+}
+
+func (list *BreachedPasswordDir) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:BREACHED_PASSWORD_PREFIX_LENGTH], hash[BREACHED_PASSWORD_PREFIX_LENGTH:]
+
+	file, err := os.Open(filepath.Join(list.dir, prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// no password in the list share this prefix
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to open breached password range %s %w", prefix, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		candidate, _, _ := strings.Cut(line, ":")
+		if strings.EqualFold(candidate, suffix) {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read breached password range %s %w", prefix, err)
+	}
+	return false, nil
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	apperror "github.com/zulfikarrosadi/code_roast/internal/app-error"
+	"github.com/zulfikarrosadi/code_roast/internal/user"
+)
+
+func TestPasswordPolicy_register(t *testing.T) {
+	breached, err := NewBreachedPasswordDir("testdata/breached")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		password      string
+		expectCode    int
+		expectMessage string
+	}{
+		{
+			name:       "Strong password",
+			password:   "plum-Gravel-71-kite",
+			expectCode: http.StatusCreated,
+		},
+		{
+			name:          "Too short",
+			password:      "a",
+			expectCode:    http.StatusBadRequest,
+			expectMessage: "password must be at least 10 characters",
+		},
+		{
+			name:          "Too long for bcrypt",
+			password:      strings.Repeat("plum-Gravel-71-kite ", 4),
+			expectCode:    http.StatusBadRequest,
+			expectMessage: "password must be at most 72 bytes, accented letters and emoji take more than one",
+		},
+		{
+			name:          "Contain the name",
+			password:      "i-am-roaster-99",
+			expectCode:    http.StatusBadRequest,
+			expectMessage: "password must not contain your name or email",
+		},
+		{
+			name:          "Keyboard walk",
+			password:      "qwertyuiop1234",
+			expectCode:    http.StatusBadRequest,
+			expectMessage: "password is too easy to guess, avoid sequences and repeated characters or make it longer",
+		},
+		{
+			name:          "Common password with decoration",
+			password:      "P@ssw0rd2024!",
+			expectCode:    http.StatusBadRequest,
+			expectMessage: "password is too easy to guess, avoid sequences and repeated characters or make it longer",
+		},
+		{
+			name:          "Found in the breached list",
+			password:      "Correct-Horse-9-Battery",
+			expectCode:    http.StatusBadRequest,
+			expectMessage: "password has appeared in a data breach, please choose another one",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(mockRepository)
+			service := newTestService(mockRepo)
+			service.v = validator.New()
+			RegisterPasswordPolicy(service.v, PasswordPolicy{MinLength: 10, Breached: breached})
+
+			mockRepo.On("register", mock.Anything, mock.Anything, mock.Anything).Return(publicUserData{id: "user-id"}, nil)
+
+			resp, _ := service.register(context.Background(), registrationRequest{
+				Fullname:             "Rita Roaster",
+				Email:                "rita@example.com",
+				Password:             tt.password,
+				PasswordConfirmation: tt.password,
+			})
+			assert.Equal(t, tt.expectCode, resp.Code)
+			if tt.expectMessage != "" {
+				details, ok := resp.Error.Details.(apperror.ErrorDetails)
+				require.True(t, ok)
+				assert.Equal(t, tt.expectMessage, details["password"])
+			}
+		})
+	}
+}
+
+type failingBreachedList struct{}
+
+func (failingBreachedList) Contains(password string) (bool, error) {
+	return false, errors.New("range file unreadable")
+}
+
+func TestPasswordPolicy_check(t *testing.T) {
+	off := 0
+	var logs bytes.Buffer
+	tests := []struct {
+		name      string
+		policy    PasswordPolicy
+		password  string
+		expectTag string
+	}{
+		{
+			name:      "Default score reject common password",
+			policy:    PasswordPolicy{},
+			password:  "Password1!",
+			expectTag: PASSWORD_TAG_WEAK,
+		},
+		{
+			name:     "Score 0 turn the strength check off",
+			policy:   PasswordPolicy{MinScore: &off},
+			password: "Password1!",
+		},
+		{
+			name:      "Longer than bcrypt accept",
+			policy:    PasswordPolicy{},
+			password:  strings.Repeat("plum-Gravel-71-kite ", 4),
+			expectTag: PASSWORD_TAG_TOO_LONG,
+		},
+		{
+			name:      "Multibyte characters count in bytes",
+			policy:    PasswordPolicy{},
+			password:  strings.Repeat("щука-Ель-71 ", 4),
+			expectTag: PASSWORD_TAG_TOO_LONG,
+		},
+		{
+			name:     "Argon2id accept long passphrase",
+			policy:   PasswordPolicy{maxBytes: PasswordConfig{Algorithm: PASSWORD_ALGORITHM_ARGON2ID}.maxPasswordBytes()},
+			password: strings.Repeat("plum-Gravel-71-kite ", 4),
+		},
+		{
+			name:     "Breached list failure doesn't block",
+			policy:   PasswordPolicy{Breached: failingBreachedList{}, Logger: slog.New(slog.NewTextHandler(&logs, nil))},
+			password: "plum-Gravel-71-kite",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag, _ := tt.policy.check(tt.password)
+			assert.Equal(t, tt.expectTag, tag)
+		})
+	}
+	assert.Contains(t, logs.String(), "range file unreadable")
+}
+
+func TestServiceImpl_resetPasswordPersonalInfo(t *testing.T) {
+	mockRepo := new(mockRepository)
+	service := newTestService(mockRepo)
+	mockRepo.On("findPasswordReset", context.Background(), hashToken("reset-token"), mock.Anything).Return(
+		user.User{Id: "user-id", Email: "rita@example.com", Fullname: "Rita Roaster"}, nil,
+	)
+
+	resp, err := service.resetPassword(context.Background(), resetPasswordRequest{
+		Token:                "reset-token",
+		Password:             "roaster-Kettle-42",
+		PasswordConfirmation: "roaster-Kettle-42",
+	})
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	details, ok := resp.Error.Details.(apperror.ErrorDetails)
+	require.True(t, ok)
+	assert.Equal(t, "password must not contain your name or email", details["password"])
+	mockRepo.AssertNotCalled(t, "resetPassword", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPasswordScore(t *testing.T) {
+	assert.Equal(t, 0, passwordScore("aaaaaaaaaaaa"))
+	assert.Equal(t, 0, passwordScore("abcdefgh"))
+	assert.GreaterOrEqual(t, passwordScore("Tr0ub4dor&3"), 3)
+	assert.Equal(t, 4, passwordScore("correct horse battery staple"))
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// small argon2 parameters keep the tests fast
+var testArgon2Config = PasswordConfig{Algorithm: PASSWORD_ALGORITHM_ARGON2ID, Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 1}
+
+func TestPasswordHasher_Verify(t *testing.T) {
+	tests := []struct {
+		name   string
+		config PasswordConfig
+		prefix string
+	}{
+		{
+			name:   "Bcrypt",
+			config: PasswordConfig{BcryptCost: bcrypt.MinCost},
+			prefix: "$2a$",
+		},
+		{
+			name:   "Argon2id",
+			config: testArgon2Config,
+			prefix: "$argon2id$v=19$m=1024,t=1,p=1$",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hasher := NewPasswordHasher(tt.config)
+			hash, err := hasher.Hash("password123")
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(hash, tt.prefix), hash)
+
+			assert.NoError(t, hasher.Verify(hash, "password123"))
+			assert.ErrorIs(t, hasher.Verify(hash, "password124"), ErrPasswordMismatch)
+			assert.False(t, hasher.NeedsRehash(hash))
+		})
+	}
+}
+
+func TestPasswordHasher_NeedsRehash(t *testing.T) {
+	bcryptHash, err := NewPasswordHasher(PasswordConfig{BcryptCost: bcrypt.MinCost}).Hash("password123")
+	require.NoError(t, err)
+	argon2Hash, err := NewPasswordHasher(testArgon2Config).Hash("password123")
+	require.NoError(t, err)
+
+	stronger := testArgon2Config
+	stronger.Argon2Time = 2
+
+	tests := []struct {
+		name   string
+		config PasswordConfig
+		hash   string
+		expect bool
+	}{
+		{
+			name:   "Bcrypt cost raised",
+			config: PasswordConfig{BcryptCost: bcrypt.MinCost + 1},
+			hash:   bcryptHash,
+			expect: true,
+		},
+		{
+			name:   "Bcrypt to argon2id",
+			config: testArgon2Config,
+			hash:   bcryptHash,
+			expect: true,
+		},
+		{
+			name:   "Argon2id back to bcrypt",
+			config: PasswordConfig{BcryptCost: bcrypt.MinCost},
+			hash:   argon2Hash,
+			expect: true,
+		},
+		{
+			name:   "Argon2id time raised",
+			config: stronger,
+			hash:   argon2Hash,
+			expect: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hasher := NewPasswordHasher(tt.config)
+			assert.Equal(t, tt.expect, hasher.NeedsRehash(tt.hash))
+			// old hash must keep working whatever the config is
+			assert.NoError(t, hasher.Verify(tt.hash, "password123"))
+		})
+	}
+}
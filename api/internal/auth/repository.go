@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 	apperror "github.com/zulfikarrosadi/code_roast/internal/app-error"
@@ -23,17 +25,64 @@ type (
 	authentication struct {
 		id           string
 		refreshToken string
+		familyId     string
+		twoFactor    bool
 		lastLogin    int64
+		expiresAt    int64
 		remoteIP     string
 		agent        string
 		userId       string
 	}
 
+	totp struct {
+		secret  string
+		enabled bool
+		// time step of the last accepted code, 0 if none
+		lastStep int64
+	}
+
+	recoveryCode struct {
+		id        string
+		codeHash  string
+		createdAt int64
+	}
+
+	userIdentity struct {
+		id        string
+		userId    string
+		provider  string
+		subject   string
+		email     string
+		createdAt int64
+	}
+
+	personalToken struct {
+		id         string
+		userId     string
+		name       string
+		tokenHash  string
+		roleIds    []int
+		lastUsedAt int64
+		expiresAt  int64
+		createdAt  int64
+	}
+
+	passwordReset struct {
+		id        string
+		userId    string
+		tokenHash string
+		expiresAt int64
+		createdAt int64
+	}
+
 	publicUserData struct {
-		id       string
-		fullname string
-		email    string
-		roles    []user.Roles
+		id            string
+		fullname      string
+		email         string
+		roles         []user.Roles
+		emailVerified bool
+		twoFactor     bool
+		tokenVersion  int64
 	}
 )
 
@@ -48,8 +97,16 @@ func NewUserRepository(logger *slog.Logger, db *sql.DB) *RepositoryImpl {
 	}
 }
 
-func (repo *RepositoryImpl) findRefreshToken(ctx context.Context, token string) (publicUserData, error) {
+// rotateRefreshToken swap the presented refresh token with the next one in the same family.
+// presenting a token that was already rotated means it leaked, so the whole family is revoked, unless
+// it was rotated within REFRESH_TOKEN_REUSE_GRACE and its successor is unused, then next.refreshToken
+// is set to that successor. expired session (absolute expiry passed or last refreshed before idleCutoff) is revoked too
+func (repo *RepositoryImpl) rotateRefreshToken(ctx context.Context, token string, next *authentication, idleCutoff int64) (publicUserData, error) {
 	newPublicUserData := new(publicUserData)
+	current := new(authentication)
+	var replacedBy sql.NullString
+	var emailVerifiedAt sql.NullInt64
+
 	tx, err := repo.BeginTx(ctx, &sql.TxOptions{})
 	if err != nil {
 		return publicUserData{}, fmt.Errorf("repository: transaction begin error: %w", err)
@@ -66,20 +123,111 @@ func (repo *RepositoryImpl) findRefreshToken(ctx context.Context, token string)
 	err = tx.QueryRowContext(
 		ctx,
 		`
-		SELECT u.email , u.id, u.fullname
+		SELECT a.family_id, a.replaced_by, a.two_factor, a.last_login, a.expires_at, u.email , u.id, u.fullname, u.email_verified_at, u.token_version
 		FROM authentication AS a
 		JOIN users AS u
 		ON a.user_id = u.id
 		WHERE refresh_token = ?
+		FOR UPDATE
 		`,
 		token,
-	).Scan(&newPublicUserData.email, &newPublicUserData.id, &newPublicUserData.fullname)
+	).Scan(
+		&current.familyId,
+		&replacedBy,
+		&current.twoFactor,
+		&current.lastLogin,
+		&current.expiresAt,
+		&newPublicUserData.email,
+		&newPublicUserData.id,
+		&newPublicUserData.fullname,
+		&emailVerifiedAt,
+		&newPublicUserData.tokenVersion,
+	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return publicUserData{}, errors.New("refresh token not found")
+			return publicUserData{}, apperror.New(http.StatusUnauthorized, "refresh token not found, please sign in again", err)
 		}
 		return publicUserData{}, fmt.Errorf("repository: db query scan failed, %w", err)
 	}
+	concurrent := false
+	if replacedBy.Valid {
+		var successorLastLogin int64
+		var successorReplacedBy sql.NullString
+		err = tx.QueryRowContext(
+			ctx,
+			"SELECT last_login, replaced_by FROM authentication WHERE refresh_token = ? FOR UPDATE",
+			replacedBy.String,
+		).Scan(&successorLastLogin, &successorReplacedBy)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return publicUserData{}, fmt.Errorf("repository: db query scan failed, %w", err)
+		}
+		concurrent = err == nil && !successorReplacedBy.Valid &&
+			next.lastLogin-successorLastLogin <= int64(REFRESH_TOKEN_REUSE_GRACE/time.Second)
+	}
+	if replacedBy.Valid && !concurrent {
+		_, err = tx.ExecContext(
+			ctx,
+			"DELETE FROM authentication WHERE family_id = ?",
+			current.familyId,
+		)
+		if err != nil {
+			return publicUserData{}, fmt.Errorf("repository: failed to revoke refresh token family %w", err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return publicUserData{}, fmt.Errorf("repository: failed to commit transaction %w", err)
+		}
+		repo.Logger.LogAttrs(ctx, slog.LevelWarn, "REFRESH_TOKEN_REUSE",
+			slog.String("user_id", newPublicUserData.id),
+			slog.String("family_id", current.familyId),
+		)
+		return publicUserData{}, apperror.New(http.StatusUnauthorized, "refresh token is no longer valid, please sign in again", nil)
+	}
+	if concurrent {
+		// the successor was issued moments ago with every check passed, the client just get it again
+		next.refreshToken = replacedBy.String
+	} else {
+		if current.expiresAt <= next.lastLogin || current.lastLogin <= idleCutoff {
+			_, err = tx.ExecContext(
+				ctx,
+				"DELETE FROM authentication WHERE family_id = ?",
+				current.familyId,
+			)
+			if err != nil {
+				return publicUserData{}, fmt.Errorf("repository: failed to revoke expired session %w", err)
+			}
+			err = tx.Commit()
+			if err != nil {
+				return publicUserData{}, fmt.Errorf("repository: failed to commit transaction %w", err)
+			}
+			return publicUserData{}, apperror.New(http.StatusUnauthorized, "your session has expired, please sign in again", nil)
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			"INSERT INTO authentication (id, refresh_token, family_id, two_factor, last_login, expires_at, remote_ip, agent, user_id) VALUES(?,?,?,?,?,?,?,?,?)",
+			next.id,
+			next.refreshToken,
+			current.familyId,
+			current.twoFactor,
+			next.lastLogin,
+			current.expiresAt,
+			sessionRemoteIP(next.remoteIP),
+			sessionAgent(next.agent),
+			newPublicUserData.id,
+		)
+		if err != nil {
+			return publicUserData{}, fmt.Errorf("repository: insert rotated refresh token failed %w", err)
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			"UPDATE authentication SET replaced_by = ? WHERE refresh_token = ?",
+			next.refreshToken,
+			token,
+		)
+		if err != nil {
+			return publicUserData{}, fmt.Errorf("repository: failed to mark refresh token as rotated %w", err)
+		}
+	}
 	rows, err := tx.QueryContext(
 		ctx,
 		`
@@ -105,6 +253,8 @@ func (repo *RepositoryImpl) findRefreshToken(ctx context.Context, token string)
 		userRoles = append(userRoles, role)
 	}
 	newPublicUserData.roles = userRoles
+	newPublicUserData.emailVerified = emailVerifiedAt.Valid
+	newPublicUserData.twoFactor = current.twoFactor
 	err = tx.Commit()
 	if err != nil {
 		return publicUserData{}, fmt.Errorf("failed to commit transaction %w", err)
@@ -112,29 +262,15 @@ func (repo *RepositoryImpl) findRefreshToken(ctx context.Context, token string)
 	return *newPublicUserData, nil
 }
 
-// this method is not only find user by email, but inserting user auth details in db at once
-func (repo *RepositoryImpl) loginByEmail(ctx context.Context, email string, auth authentication) (user.User, error) {
+func (repo *RepositoryImpl) loginByEmail(ctx context.Context, email string) (user.User, error) {
 	userFromDb := new(user.User)
+	var emailVerifiedAt, totpEnabledAt sql.NullInt64
 
-	tx, err := repo.BeginTx(ctx, &sql.TxOptions{})
-	if err != nil {
-		return user.User{}, fmt.Errorf("repository: transaction begin error: %w", err)
-	}
-	defer func() {
-		// handle panic in extreamely rare case condition e.g driver fails
-		if p := recover(); p != nil {
-			tx.Rollback()
-			panic(p)
-		} else if err != nil {
-			tx.Rollback()
-		}
-	}()
-
-	err = tx.QueryRowContext(
+	err := repo.QueryRowContext(
 		ctx,
-		"SELECT id, fullname, password, email FROM users WHERE email = ?",
+		"SELECT id, fullname, password, email, email_verified_at, totp_enabled_at, token_version FROM users WHERE email = ?",
 		email,
-	).Scan(&userFromDb.Id, &userFromDb.Fullname, &userFromDb.Password, &userFromDb.Email)
+	).Scan(&userFromDb.Id, &userFromDb.Fullname, &userFromDb.Password, &userFromDb.Email, &emailVerifiedAt, &totpEnabledAt, &userFromDb.TokenVersion)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			// we use apperror to make it easier to directly handle this case
@@ -142,55 +278,102 @@ func (repo *RepositoryImpl) loginByEmail(ctx context.Context, email string, auth
 		}
 		return user.User{}, fmt.Errorf("repository: db query scan failed, %w", err)
 	}
-	_, err = tx.ExecContext(
+	userRoles, err := repo.findRoles(ctx, userFromDb.Id)
+	if err != nil {
+		return user.User{}, err
+	}
+
+	return user.User{
+		Id:               userFromDb.Id,
+		Fullname:         userFromDb.Fullname,
+		Email:            userFromDb.Email,
+		Password:         userFromDb.Password,
+		EmailVerifiedAt:  emailVerifiedAt.Int64,
+		TwoFactorEnabled: totpEnabledAt.Valid,
+		TokenVersion:     userFromDb.TokenVersion,
+		Roles:            userRoles,
+	}, nil
+}
+
+func (repo *RepositoryImpl) findUserById(ctx context.Context, userId string) (user.User, error) {
+	userFromDb := new(user.User)
+	var emailVerifiedAt, totpEnabledAt sql.NullInt64
+
+	err := repo.QueryRowContext(
 		ctx,
-		"INSERT INTO authentication (id, refresh_token, last_login, remote_ip, agent, user_id) VALUES(?,?,?,?,?,?)",
-		auth.id,
-		auth.refreshToken,
-		auth.lastLogin,
-		auth.remoteIP,
-		auth.agent,
-		userFromDb.Id,
-	)
+		"SELECT id, fullname, password, email, email_verified_at, totp_enabled_at, token_version FROM users WHERE id = ?",
+		userId,
+	).Scan(&userFromDb.Id, &userFromDb.Fullname, &userFromDb.Password, &userFromDb.Email, &emailVerifiedAt, &totpEnabledAt, &userFromDb.TokenVersion)
 	if err != nil {
-		return user.User{}, fmt.Errorf("repository: insert new user auth credentials failed %w", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return user.User{}, apperror.New(http.StatusNotFound, "user not found", err)
+		}
+		return user.User{}, fmt.Errorf("repository: db query scan failed, %w", err)
 	}
-	rows, err := tx.QueryContext(
+	userRoles, err := repo.findRoles(ctx, userFromDb.Id)
+	if err != nil {
+		return user.User{}, err
+	}
+
+	return user.User{
+		Id:               userFromDb.Id,
+		Fullname:         userFromDb.Fullname,
+		Email:            userFromDb.Email,
+		Password:         userFromDb.Password,
+		EmailVerifiedAt:  emailVerifiedAt.Int64,
+		TwoFactorEnabled: totpEnabledAt.Valid,
+		TokenVersion:     userFromDb.TokenVersion,
+		Roles:            userRoles,
+	}, nil
+}
+
+func (repo *RepositoryImpl) findRoles(ctx context.Context, userId string) ([]user.Roles, error) {
+	rows, err := repo.QueryContext(
 		ctx,
 		`
-			SELECT r.id as id, r.name as role
-			FROM users AS u
-			JOIN user_roles AS ur
-			ON u.id = ur.user_id
-			JOIN roles AS r
-			ON ur.role_id = r.id
-			WHERE u.email = ?;
+		SELECT r.id as id, r.name as role
+		FROM user_roles AS ur
+		JOIN roles AS r
+		ON ur.role_id = r.id
+		WHERE ur.user_id = ?;
 		`,
-		email,
+		userId,
 	)
 	if err != nil {
-		return user.User{}, fmt.Errorf("repository: role lookup fail %w", err)
+		return []user.Roles{}, fmt.Errorf("repository: role lookup fail %w", err)
 	}
 	defer rows.Close()
 
 	userRoles := []user.Roles{}
 	for rows.Next() {
 		role := user.Roles{}
-		rows.Scan(&role.Id, &role.Name)
+		if err := rows.Scan(&role.Id, &role.Name); err != nil {
+			return []user.Roles{}, fmt.Errorf("repository: fail to scan user role %w", err)
+		}
 		userRoles = append(userRoles, role)
 	}
-	err = tx.Commit()
+	return userRoles, nil
+}
+
+// start new token family for user that passed every sign in step
+func (repo *RepositoryImpl) createAuthentication(ctx context.Context, auth authentication) error {
+	_, err := repo.ExecContext(
+		ctx,
+		"INSERT INTO authentication (id, refresh_token, family_id, two_factor, last_login, expires_at, remote_ip, agent, user_id) VALUES(?,?,?,?,?,?,?,?,?)",
+		auth.id,
+		auth.refreshToken,
+		auth.familyId,
+		auth.twoFactor,
+		auth.lastLogin,
+		auth.expiresAt,
+		sessionRemoteIP(auth.remoteIP),
+		sessionAgent(auth.agent),
+		auth.userId,
+	)
 	if err != nil {
-		return user.User{}, fmt.Errorf("failed to commit transaction %w", err)
+		return fmt.Errorf("repository: insert new user auth credentials failed %w", err)
 	}
-
-	return user.User{
-		Id:       userFromDb.Id,
-		Fullname: userFromDb.Fullname,
-		Email:    userFromDb.Email,
-		Password: userFromDb.Password,
-		Roles:    userRoles,
-	}, nil
+	return nil
 }
 
 func (repository *RepositoryImpl) register(ctx context.Context, newUser user.User, auth authentication) (publicUserData, error) {
@@ -210,12 +393,14 @@ func (repository *RepositoryImpl) register(ctx context.Context, newUser user.Use
 
 	_, err = tx.ExecContext(
 		ctx,
-		"INSERT INTO users (id, fullname, email, password, created_at) VALUES (?,?,?,?,?)",
+		"INSERT INTO users (id, fullname, email, handle, password, created_at, verification_sent_at) VALUES (?,?,?,?,?,?,?)",
 		newUser.Id,
 		newUser.Fullname,
 		newUser.Email,
+		newUser.Handle,
 		newUser.Password,
 		newUser.CreatedAt,
+		newUser.CreatedAt,
 	)
 	if err != nil {
 		var mysqlErr *mysql.MySQLError
@@ -226,12 +411,14 @@ func (repository *RepositoryImpl) register(ctx context.Context, newUser user.Use
 	}
 	_, err = tx.ExecContext(
 		ctx,
-		"INSERT INTO authentication (id, refresh_token, last_login, remote_ip, agent, user_id) VALUES(?,?,?,?,?,?)",
+		"INSERT INTO authentication (id, refresh_token, family_id, last_login, expires_at, remote_ip, agent, user_id) VALUES(?,?,?,?,?,?,?,?)",
 		auth.id,
 		auth.refreshToken,
+		auth.familyId,
 		auth.lastLogin,
-		auth.remoteIP,
-		auth.agent,
+		auth.expiresAt,
+		sessionRemoteIP(auth.remoteIP),
+		sessionAgent(auth.agent),
 		newUser.Id,
 	)
 	if err != nil {
@@ -266,3 +453,1094 @@ func (repository *RepositoryImpl) register(ctx context.Context, newUser user.Use
 		},
 	}, nil
 }
+
+func (repo *RepositoryImpl) revokeRefreshToken(ctx context.Context, token string) (int64, error) {
+	result, err := repo.ExecContext(
+		ctx,
+		"DELETE FROM authentication WHERE refresh_token = ?",
+		token,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("repository: failed to revoke refresh token %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("repository: failed to get rows affected %w", err)
+	}
+	return rowsAffected, nil
+}
+
+// remove every session the user has, used for "sign out everywhere"
+func (repo *RepositoryImpl) revokeAllRefreshTokens(ctx context.Context, userId string) (int64, error) {
+	result, err := repo.ExecContext(
+		ctx,
+		"DELETE FROM authentication WHERE user_id = ?",
+		userId,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("repository: failed to revoke all refresh token of user %s %w", userId, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("repository: failed to get rows affected %w", err)
+	}
+	return rowsAffected, nil
+}
+
+// purge sessions that can no longer be refreshed so the table doesn't grow unbounded.
+// rotated tokens keep the last login of when they were used, they go idle while the family is still alive,
+// so they are kept until the absolute expiry of the family for a replayed one to still revoke the family
+func (repo *RepositoryImpl) deleteExpiredSessions(ctx context.Context, now int64, idleCutoff int64) (int64, error) {
+	result, err := repo.ExecContext(
+		ctx,
+		"DELETE FROM authentication WHERE expires_at <= ? OR (replaced_by IS NULL AND last_login <= ?)",
+		now,
+		idleCutoff,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("repository: failed to delete expired sessions %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("repository: failed to get rows affected %w", err)
+	}
+	return rowsAffected, nil
+}
+
+// list the latest token of every active token family, one family is one signed in device
+func (repo *RepositoryImpl) findSessions(ctx context.Context, userId string, now int64, idleCutoff int64) ([]authentication, error) {
+	rows, err := repo.QueryContext(
+		ctx,
+		`
+		SELECT family_id, refresh_token, last_login, expires_at, remote_ip, agent
+		FROM authentication
+		WHERE user_id = ? AND replaced_by IS NULL AND expires_at > ? AND last_login > ?
+		ORDER BY last_login DESC
+		`,
+		userId,
+		now,
+		idleCutoff,
+	)
+	if err != nil {
+		return []authentication{}, fmt.Errorf("repository: failed to get sessions of user %s %w", userId, err)
+	}
+	defer rows.Close()
+
+	sessions := []authentication{}
+	for rows.Next() {
+		session := authentication{userId: userId}
+		err = rows.Scan(
+			&session.familyId,
+			&session.refreshToken,
+			&session.lastLogin,
+			&session.expiresAt,
+			&session.remoteIP,
+			&session.agent,
+		)
+		if err != nil {
+			return []authentication{}, fmt.Errorf("repository: failed to scan session %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+func (repo *RepositoryImpl) revokeSession(ctx context.Context, userId string, familyId string) error {
+	result, err := repo.ExecContext(
+		ctx,
+		"DELETE FROM authentication WHERE user_id = ? AND family_id = ?",
+		userId,
+		familyId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to revoke session %s %w", familyId, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repository: failed to get rows affected %w", err)
+	}
+	if rowsAffected == 0 {
+		return apperror.New(http.StatusNotFound, "session not found", nil)
+	}
+	return nil
+}
+
+// store new password reset token for the owner of the email, return the owner so we can email them
+func (repo *RepositoryImpl) createPasswordReset(ctx context.Context, email string, reset passwordReset) (user.User, error) {
+	userFromDb := new(user.User)
+	err := repo.QueryRowContext(
+		ctx,
+		"SELECT id, fullname, email FROM users WHERE email = ?",
+		email,
+	).Scan(&userFromDb.Id, &userFromDb.Fullname, &userFromDb.Email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user.User{}, apperror.New(http.StatusNotFound, "user not found", err)
+		}
+		return user.User{}, fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	_, err = repo.ExecContext(
+		ctx,
+		"INSERT INTO password_resets (id, user_id, token_hash, expires_at, created_at) VALUES (?,?,?,?,?)",
+		reset.id,
+		userFromDb.Id,
+		reset.tokenHash,
+		reset.expiresAt,
+		reset.createdAt,
+	)
+	if err != nil {
+		return user.User{}, fmt.Errorf("repository: failed to create password reset %w", err)
+	}
+	return *userFromDb, nil
+}
+
+// findPasswordReset return the owner of a reset token that can still be used
+func (repo *RepositoryImpl) findPasswordReset(ctx context.Context, tokenHash string, now int64) (user.User, error) {
+	owner := user.User{}
+	err := repo.QueryRowContext(
+		ctx,
+		`
+		SELECT u.id, u.fullname, u.email
+		FROM password_resets AS r
+		JOIN users AS u ON u.id = r.user_id
+		WHERE r.token_hash = ? AND r.used_at IS NULL AND r.expires_at > ?`,
+		tokenHash,
+		now,
+	).Scan(&owner.Id, &owner.Fullname, &owner.Email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user.User{}, apperror.New(http.StatusBadRequest, "password reset link is invalid or has expired", err)
+		}
+		return user.User{}, fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	return owner, nil
+}
+
+// consume the reset token, change the password and sign the user out from every device at once
+func (repo *RepositoryImpl) resetPassword(ctx context.Context, tokenHash string, hashedPassword string, now int64) error {
+	reset := new(passwordReset)
+	var usedAt sql.NullInt64
+
+	tx, err := repo.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("repository: transaction begin error: %w", err)
+	}
+	defer func() {
+		// handle panic in extreamely rare case condition e.g driver fails
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT id, user_id, expires_at, used_at FROM password_resets WHERE token_hash = ? FOR UPDATE",
+		tokenHash,
+	).Scan(&reset.id, &reset.userId, &reset.expiresAt, &usedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return apperror.New(http.StatusBadRequest, "password reset link is invalid or has expired", err)
+		}
+		return fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	if usedAt.Valid || reset.expiresAt <= now {
+		err = apperror.New(http.StatusBadRequest, "password reset link is invalid or has expired", nil)
+		return err
+	}
+	// a reset is how a taken over account is recovered, access tokens and personal tokens
+	// the attacker may hold are revoked together with the sessions
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE users SET password = ?, token_version = token_version + 1 WHERE id = ?",
+		hashedPassword,
+		reset.userId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to update user password %w", err)
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"DELETE FROM personal_access_tokens WHERE user_id = ?",
+		reset.userId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to revoke personal access tokens %w", err)
+	}
+	// every outstanding reset token of this user is burned too, not only the one being used
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL",
+		now,
+		reset.userId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to mark password reset as used %w", err)
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"DELETE FROM authentication WHERE user_id = ?",
+		reset.userId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to revoke sessions after password reset %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("repository: failed to commit transaction %w", err)
+	}
+	return nil
+}
+
+func (repo *RepositoryImpl) verifyEmail(ctx context.Context, userId string, email string, now int64) error {
+	var emailVerifiedAt sql.NullInt64
+	err := repo.QueryRowContext(
+		ctx,
+		"SELECT email_verified_at FROM users WHERE id = ? AND email = ?",
+		userId,
+		email,
+	).Scan(&emailVerifiedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// the email was changed after the link is sent
+			return apperror.New(http.StatusBadRequest, "verification link is invalid or has expired", err)
+		}
+		return fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	if emailVerifiedAt.Valid {
+		return nil
+	}
+	_, err = repo.ExecContext(
+		ctx,
+		"UPDATE users SET email_verified_at = ? WHERE id = ?",
+		now,
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to mark email as verified %w", err)
+	}
+	return nil
+}
+
+// reserve the right to send another verification email, rejected when last one is sent after cooldownCutoff
+func (repo *RepositoryImpl) markVerificationSent(ctx context.Context, userId string, now int64, cooldownCutoff int64) (user.User, error) {
+	userFromDb := new(user.User)
+	var emailVerifiedAt, verificationSentAt sql.NullInt64
+
+	tx, err := repo.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return user.User{}, fmt.Errorf("repository: transaction begin error: %w", err)
+	}
+	defer func() {
+		// handle panic in extreamely rare case condition e.g driver fails
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT id, fullname, email, email_verified_at, verification_sent_at FROM users WHERE id = ? FOR UPDATE",
+		userId,
+	).Scan(&userFromDb.Id, &userFromDb.Fullname, &userFromDb.Email, &emailVerifiedAt, &verificationSentAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user.User{}, apperror.New(http.StatusNotFound, "user not found", err)
+		}
+		return user.User{}, fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	if emailVerifiedAt.Valid {
+		err = apperror.New(http.StatusConflict, "your email is already verified", nil)
+		return user.User{}, err
+	}
+	if verificationSentAt.Valid && verificationSentAt.Int64 > cooldownCutoff {
+		err = apperror.New(http.StatusTooManyRequests, "verification email was sent recently, please wait before requesting another one", nil)
+		return user.User{}, err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE users SET verification_sent_at = ? WHERE id = ?",
+		now,
+		userId,
+	)
+	if err != nil {
+		return user.User{}, fmt.Errorf("repository: failed to update verification sent time %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return user.User{}, fmt.Errorf("repository: failed to commit transaction %w", err)
+	}
+	return *userFromDb, nil
+}
+
+func (repo *RepositoryImpl) findTOTP(ctx context.Context, userId string) (totp, error) {
+	var secret sql.NullString
+	var enabledAt, lastStep sql.NullInt64
+	err := repo.QueryRowContext(
+		ctx,
+		"SELECT totp_secret, totp_enabled_at, totp_last_step FROM users WHERE id = ?",
+		userId,
+	).Scan(&secret, &enabledAt, &lastStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return totp{}, apperror.New(http.StatusNotFound, "user not found", err)
+		}
+		return totp{}, fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	return totp{
+		secret:   secret.String,
+		enabled:  enabledAt.Valid,
+		lastStep: lastStep.Int64,
+	}, nil
+}
+
+// useTOTPStep record the step of an accepted code, only one request can use a step even when they race
+func (repo *RepositoryImpl) useTOTPStep(ctx context.Context, userId string, step int64) error {
+	result, err := repo.ExecContext(
+		ctx,
+		"UPDATE users SET totp_last_step = ? WHERE id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)",
+		step,
+		userId,
+		step,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to save totp step %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repository: failed to get rows affected %w", err)
+	}
+	if rowsAffected == 0 {
+		return apperror.New(http.StatusBadRequest, "two-factor code has already been used, wait for the next one", nil)
+	}
+	return nil
+}
+
+// store secret that is waiting to be confirmed, enabled secret can't be replaced this way
+func (repo *RepositoryImpl) saveTOTPSecret(ctx context.Context, userId string, secret string) error {
+	result, err := repo.ExecContext(
+		ctx,
+		"UPDATE users SET totp_secret = ?, totp_last_step = NULL WHERE id = ? AND totp_enabled_at IS NULL",
+		secret,
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to save totp secret %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repository: failed to get rows affected %w", err)
+	}
+	if rowsAffected == 0 {
+		return apperror.New(http.StatusConflict, "two-factor authentication is already enabled", nil)
+	}
+	return nil
+}
+
+// turn on two-factor authentication and replace every previous recovery code
+func (repo *RepositoryImpl) enableTOTP(ctx context.Context, userId string, now int64, codes []recoveryCode) error {
+	insertQueryParams := []string{}
+	insertQueryValue := []interface{}{}
+	for _, code := range codes {
+		insertQueryParams = append(insertQueryParams, "(?,?,?,?)")
+		insertQueryValue = append(insertQueryValue, code.id, userId, code.codeHash, code.createdAt)
+	}
+
+	tx, err := repo.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("repository: transaction begin error: %w", err)
+	}
+	defer func() {
+		// handle panic in extreamely rare case condition e.g driver fails
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE users SET totp_enabled_at = ? WHERE id = ?",
+		now,
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to enable totp %w", err)
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"DELETE FROM recovery_codes WHERE user_id = ?",
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to delete old recovery codes %w", err)
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		fmt.Sprintf("INSERT INTO recovery_codes (id, user_id, code_hash, created_at) VALUES %s", strings.Join(insertQueryParams, ",")),
+		insertQueryValue...,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to insert recovery codes %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("repository: failed to commit transaction %w", err)
+	}
+	return nil
+}
+
+func (repo *RepositoryImpl) disableTOTP(ctx context.Context, userId string) error {
+	tx, err := repo.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("repository: transaction begin error: %w", err)
+	}
+	defer func() {
+		// handle panic in extreamely rare case condition e.g driver fails
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL WHERE id = ?",
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to disable totp %w", err)
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"DELETE FROM recovery_codes WHERE user_id = ?",
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to delete recovery codes %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("repository: failed to commit transaction %w", err)
+	}
+	return nil
+}
+
+// every recovery code can only be used once
+func (repo *RepositoryImpl) useRecoveryCode(ctx context.Context, userId string, codeHash string, now int64) error {
+	result, err := repo.ExecContext(
+		ctx,
+		"UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		now,
+		userId,
+		codeHash,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to use recovery code %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repository: failed to get rows affected %w", err)
+	}
+	if rowsAffected == 0 {
+		return apperror.New(http.StatusBadRequest, "two-factor code is incorrect", nil)
+	}
+	return nil
+}
+
+func (repo *RepositoryImpl) findTokenVersion(ctx context.Context, userId string) (int64, error) {
+	var tokenVersion int64
+	err := repo.QueryRowContext(
+		ctx,
+		"SELECT token_version FROM users WHERE id = ?",
+		userId,
+	).Scan(&tokenVersion)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, apperror.New(http.StatusUnauthorized, "user not found, please sign in again", err)
+		}
+		return 0, fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	return tokenVersion, nil
+}
+
+func (repo *RepositoryImpl) findUserByIdentity(ctx context.Context, provider string, subject string) (user.User, error) {
+	var userId string
+	err := repo.QueryRowContext(
+		ctx,
+		"SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?",
+		provider,
+		subject,
+	).Scan(&userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user.User{}, apperror.New(http.StatusNotFound, "identity not linked to any user", err)
+		}
+		return user.User{}, fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	return repo.findUserById(ctx, userId)
+}
+
+// link identity to the user owning the email, 404 when there's none
+// linkIdentity only link to an account whose owner proved the email, anyone can sign up with an address
+// they don't own and wait for its real owner to sign in with a provider
+func (repo *RepositoryImpl) linkIdentity(ctx context.Context, email string, identity userIdentity) (user.User, error) {
+	var userId string
+	var emailVerifiedAt sql.NullInt64
+	err := repo.QueryRowContext(
+		ctx,
+		"SELECT id, email_verified_at FROM users WHERE email = ?",
+		email,
+	).Scan(&userId, &emailVerifiedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return user.User{}, apperror.New(http.StatusNotFound, "user not found", err)
+		}
+		return user.User{}, fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	if !emailVerifiedAt.Valid {
+		return user.User{}, apperror.New(
+			http.StatusConflict,
+			"an account with this email already exists, sign in with your password and verify your email first",
+			nil,
+		)
+	}
+	_, err = repo.ExecContext(
+		ctx,
+		"INSERT INTO user_identities (id, user_id, provider, subject, email, created_at) VALUES (?,?,?,?,?,?)",
+		identity.id,
+		userId,
+		identity.provider,
+		identity.subject,
+		identity.email,
+		identity.createdAt,
+	)
+	if err != nil {
+		return user.User{}, fmt.Errorf("repository: failed to link identity %w", err)
+	}
+	return repo.findUserById(ctx, userId)
+}
+
+func (repo *RepositoryImpl) createOAuthUser(ctx context.Context, newUser user.User, identity userIdentity) (user.User, error) {
+	var emailVerifiedAt sql.NullInt64
+	if newUser.EmailVerifiedAt != 0 {
+		emailVerifiedAt = sql.NullInt64{Int64: newUser.EmailVerifiedAt, Valid: true}
+	}
+
+	tx, err := repo.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return user.User{}, fmt.Errorf("repository: transaction begin error: %w", err)
+	}
+	defer func() {
+		// handle panic in extreamely rare case condition e.g driver fails
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO users (id, fullname, email, handle, password, created_at, email_verified_at) VALUES (?,?,?,?,?,?,?)",
+		newUser.Id,
+		newUser.Fullname,
+		newUser.Email,
+		newUser.Handle,
+		newUser.Password,
+		newUser.CreatedAt,
+		emailVerifiedAt,
+	)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == DUPLICATE_CONSTRAINT_ERROR {
+			return user.User{}, apperror.New(http.StatusConflict, "this email is already registered, sign in with your password instead", err)
+		}
+		return user.User{}, fmt.Errorf("repository: insert new user fail: %w", err)
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO user_roles (user_id, role_id) VALUES(?,?)",
+		newUser.Id,
+		user.ROLE_ID_MEMBER,
+	)
+	if err != nil {
+		return user.User{}, fmt.Errorf("repository: attaching new role to new user failed %w", err)
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO user_identities (id, user_id, provider, subject, email, created_at) VALUES (?,?,?,?,?,?)",
+		identity.id,
+		newUser.Id,
+		identity.provider,
+		identity.subject,
+		identity.email,
+		identity.createdAt,
+	)
+	if err != nil {
+		return user.User{}, fmt.Errorf("repository: failed to link identity %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return user.User{}, fmt.Errorf("repository: failed to commit transaction: %w", err)
+	}
+	newUser.Roles = []user.Roles{
+		{
+			Id:   user.ROLE_ID_MEMBER,
+			Name: "member",
+		},
+	}
+	return newUser, nil
+}
+
+func (repo *RepositoryImpl) createPersonalToken(ctx context.Context, token personalToken) error {
+	tx, err := repo.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("repository: transaction begin error: %w", err)
+	}
+	defer func() {
+		// handle panic in extreamely rare case condition e.g driver fails
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var expiresAt sql.NullInt64
+	if token.expiresAt != 0 {
+		expiresAt = sql.NullInt64{Int64: token.expiresAt, Valid: true}
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO personal_access_tokens (id, user_id, name, token_hash, expires_at, created_at) VALUES (?,?,?,?,?,?)",
+		token.id,
+		token.userId,
+		token.name,
+		token.tokenHash,
+		expiresAt,
+		token.createdAt,
+	)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == DUPLICATE_CONSTRAINT_ERROR {
+			return apperror.New(http.StatusConflict, "you already have a token with this name", err)
+		}
+		return fmt.Errorf("repository: failed to insert personal token %w", err)
+	}
+	if len(token.roleIds) > 0 {
+		insertQueryParams := []string{}
+		insertQueryValue := []interface{}{}
+		for _, roleId := range token.roleIds {
+			insertQueryParams = append(insertQueryParams, "(?,?)")
+			insertQueryValue = append(insertQueryValue, token.id, roleId)
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			fmt.Sprintf("INSERT INTO personal_access_token_roles (token_id, role_id) VALUES %s", strings.Join(insertQueryParams, ",")),
+			insertQueryValue...,
+		)
+		if err != nil {
+			return fmt.Errorf("repository: failed to insert personal token roles %w", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("repository: failed to commit transaction %w", err)
+	}
+	return nil
+}
+
+func (repo *RepositoryImpl) findPersonalTokens(ctx context.Context, userId string) ([]personalToken, error) {
+	rows, err := repo.QueryContext(
+		ctx,
+		`
+		SELECT pat.id, pat.name, pat.last_used_at, pat.expires_at, pat.created_at, patr.role_id
+		FROM personal_access_tokens AS pat
+		LEFT JOIN personal_access_token_roles AS patr
+		ON pat.id = patr.token_id
+		WHERE pat.user_id = ?
+		ORDER BY pat.created_at DESC
+		`,
+		userId,
+	)
+	if err != nil {
+		return []personalToken{}, fmt.Errorf("repository: failed to get personal tokens of user %s %w", userId, err)
+	}
+	defer rows.Close()
+
+	tokens := []personalToken{}
+	indexById := map[string]int{}
+	for rows.Next() {
+		token := personalToken{userId: userId, roleIds: []int{}}
+		var lastUsedAt, expiresAt, roleId sql.NullInt64
+		err = rows.Scan(&token.id, &token.name, &lastUsedAt, &expiresAt, &token.createdAt, &roleId)
+		if err != nil {
+			return []personalToken{}, fmt.Errorf("repository: failed to scan personal token %w", err)
+		}
+		// one row per role, fold them back into their token
+		index, ok := indexById[token.id]
+		if !ok {
+			token.lastUsedAt = lastUsedAt.Int64
+			token.expiresAt = expiresAt.Int64
+			tokens = append(tokens, token)
+			index = len(tokens) - 1
+			indexById[token.id] = index
+		}
+		if roleId.Valid {
+			tokens[index].roleIds = append(tokens[index].roleIds, int(roleId.Int64))
+		}
+	}
+	return tokens, nil
+}
+
+func (repo *RepositoryImpl) deletePersonalToken(ctx context.Context, userId string, tokenId string) error {
+	result, err := repo.ExecContext(
+		ctx,
+		"DELETE FROM personal_access_tokens WHERE id = ? AND user_id = ?",
+		tokenId,
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to delete personal token %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repository: failed to get rows affected %w", err)
+	}
+	if rowsAffected == 0 {
+		return apperror.New(http.StatusNotFound, "token not found", nil)
+	}
+	return nil
+}
+
+// findPersonalTokenOwner return the token and its owner, roles of the owner are the ones granted
+// to the token that the owner still hold
+func (repo *RepositoryImpl) findPersonalTokenOwner(ctx context.Context, tokenHash string, now int64) (personalToken, user.User, error) {
+	token := personalToken{tokenHash: tokenHash}
+	owner := user.User{}
+	var emailVerifiedAt sql.NullInt64
+	err := repo.QueryRowContext(
+		ctx,
+		`
+		SELECT pat.id, pat.name, u.id, u.fullname, u.email, u.email_verified_at, u.token_version
+		FROM personal_access_tokens AS pat
+		JOIN users AS u
+		ON pat.user_id = u.id
+		WHERE pat.token_hash = ? AND (pat.expires_at IS NULL OR pat.expires_at > ?)
+		`,
+		tokenHash,
+		now,
+	).Scan(&token.id, &token.name, &owner.Id, &owner.Fullname, &owner.Email, &emailVerifiedAt, &owner.TokenVersion)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return personalToken{}, user.User{}, apperror.New(http.StatusUnauthorized, "invalid or expired personal access token", err)
+		}
+		return personalToken{}, user.User{}, fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	token.userId = owner.Id
+	owner.EmailVerifiedAt = emailVerifiedAt.Int64
+
+	rows, err := repo.QueryContext(
+		ctx,
+		`
+		SELECT r.id, r.name
+		FROM personal_access_token_roles AS patr
+		JOIN user_roles AS ur
+		ON ur.role_id = patr.role_id AND ur.user_id = ?
+		JOIN roles AS r
+		ON r.id = patr.role_id
+		WHERE patr.token_id = ?
+		`,
+		owner.Id,
+		token.id,
+	)
+	if err != nil {
+		return personalToken{}, user.User{}, fmt.Errorf("repository: role lookup fail %w", err)
+	}
+	defer rows.Close()
+
+	owner.Roles = []user.Roles{}
+	for rows.Next() {
+		role := user.Roles{}
+		if err := rows.Scan(&role.Id, &role.Name); err != nil {
+			return personalToken{}, user.User{}, fmt.Errorf("repository: fail to scan user role %w", err)
+		}
+		owner.Roles = append(owner.Roles, role)
+	}
+	return token, owner, nil
+}
+
+// last_used_at is only written when it's older than usedCutoff, so busy bots don't write on every request
+func (repo *RepositoryImpl) touchPersonalToken(ctx context.Context, tokenId string, now int64, usedCutoff int64) error {
+	_, err := repo.ExecContext(
+		ctx,
+		"UPDATE personal_access_tokens SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)",
+		now,
+		tokenId,
+		usedCutoff,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to update personal token last used %w", err)
+	}
+	return nil
+}
+
+// change the password and sign out every other device, the session of keepRefreshToken stays signed in
+func (repo *RepositoryImpl) changePassword(ctx context.Context, userId string, hashedPassword string, keepRefreshToken string, now int64) error {
+	var keepFamilyId string
+
+	tx, err := repo.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("repository: transaction begin error: %w", err)
+	}
+	defer func() {
+		// handle panic in extreamely rare case condition e.g driver fails
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// bumping token_version end every access token, the kept session get a new one on its next refresh
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE users SET password = ?, token_version = token_version + 1 WHERE id = ?",
+		hashedPassword,
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to update user password %w", err)
+	}
+	// token roles go with them through ON DELETE CASCADE
+	_, err = tx.ExecContext(
+		ctx,
+		"DELETE FROM personal_access_tokens WHERE user_id = ?",
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to revoke personal access tokens %w", err)
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL",
+		now,
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to burn password reset tokens %w", err)
+	}
+	// mysql doesn't allow subquery on the table we delete from, so the family is looked up first
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT family_id FROM authentication WHERE refresh_token = ? AND user_id = ?",
+		keepRefreshToken,
+		userId,
+	).Scan(&keepFamilyId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	if keepFamilyId == "" {
+		// no session to keep, sign out everywhere
+		_, err = tx.ExecContext(ctx, "DELETE FROM authentication WHERE user_id = ?", userId)
+	} else {
+		_, err = tx.ExecContext(
+			ctx,
+			"DELETE FROM authentication WHERE user_id = ? AND family_id <> ?",
+			userId,
+			keepFamilyId,
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("repository: failed to revoke other sessions %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("repository: failed to commit transaction %w", err)
+	}
+	return nil
+}
+
+// new email is unverified until the user open the link sent to it
+func (repo *RepositoryImpl) changeEmail(ctx context.Context, userId string, email string, now int64) error {
+	_, err := repo.ExecContext(
+		ctx,
+		"UPDATE users SET email = ?, email_verified_at = NULL, verification_sent_at = ? WHERE id = ?",
+		email,
+		now,
+		userId,
+	)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == DUPLICATE_CONSTRAINT_ERROR {
+			return apperror.New(http.StatusConflict, "this email is already registered", err)
+		}
+		return fmt.Errorf("repository: failed to change user email %w", err)
+	}
+	return nil
+}
+
+type deletionStep struct {
+	query string
+	name  string
+}
+
+// deleteAccount remove everything that can identify the user, policy decide what happen to posts and likes
+func (repo *RepositoryImpl) deleteAccount(ctx context.Context, userId string, policy string, now int64) error {
+	tx, err := repo.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("repository: transaction begin error: %w", err)
+	}
+	defer func() {
+		// handle panic in extreamely rare case condition e.g driver fails
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var deletedAt sql.NullInt64
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT deleted_at FROM users WHERE id = ? FOR UPDATE",
+		userId,
+	).Scan(&deletedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return apperror.New(http.StatusNotFound, "user not found", err)
+		}
+		return fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	if deletedAt.Valid {
+		err = apperror.New(http.StatusNotFound, "user not found", nil)
+		return err
+	}
+
+	steps := []deletionStep{}
+	if policy == ACCOUNT_DELETION_HARD_DELETE {
+		// subforums hold posts of other people, deleting them would take those posts down too
+		var ownedSubforums int
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(id) FROM subforums WHERE user_id = ?", userId).Scan(&ownedSubforums)
+		if err != nil {
+			return fmt.Errorf("repository: db query scan failed, %w", err)
+		}
+		if ownedSubforums > 0 {
+			err = apperror.New(http.StatusConflict, "delete your subforums before deleting your account", nil)
+			return err
+		}
+		steps = append(steps,
+			// take the comments out of the stored counts before they become placeholders
+			deletionStep{name: "comment counts", query: `
+			UPDATE posts p
+			JOIN (SELECT post_id, COUNT(id) AS removed FROM comments WHERE user_id = ? AND deleted_at IS NULL GROUP BY post_id) c ON c.post_id = p.id
+			SET p.comment_count = p.comment_count - c.removed`},
+			// replies of other people hang from these comments, so they stay as placeholders
+			deletionStep{name: "comments", query: "UPDATE comments SET user_id = NULL, content = NULL, deleted_at = COALESCE(deleted_at, UNIX_TIMESTAMP()) WHERE user_id = ?"},
+			deletionStep{name: "comments of posts", query: "DELETE FROM comments WHERE post_id IN (SELECT id FROM posts WHERE user_id = ?)"},
+			// take the votes out of the stored scores before the votes are gone
+			deletionStep{name: "comment scores", query: `
+			UPDATE comments c
+			JOIN comment_votes v ON v.comment_id = c.id AND v.user_id = ?
+			SET c.upvotes = c.upvotes - (v.value = 1), c.downvotes = c.downvotes - (v.value = -1), c.score = c.score - v.value`},
+			deletionStep{name: "comment votes", query: "DELETE FROM comment_votes WHERE user_id = ?"},
+			deletionStep{name: "post scores", query: `
+			UPDATE posts p
+			JOIN likes l ON l.post_id = p.id AND l.user_id = ?
+			SET p.upvotes = p.upvotes - (l.value = 1), p.downvotes = p.downvotes - (l.value = -1), p.score = p.score - l.value`},
+			deletionStep{name: "comment reactions", query: "DELETE FROM comment_reactions WHERE user_id = ?"},
+			deletionStep{name: "post reactions", query: "DELETE FROM post_reactions WHERE user_id = ?"},
+			deletionStep{name: "reactions of posts", query: "DELETE FROM post_reactions WHERE post_id IN (SELECT id FROM posts WHERE user_id = ?)"},
+			deletionStep{name: "likes", query: "DELETE FROM likes WHERE user_id = ?"},
+			deletionStep{name: "likes of posts", query: "DELETE FROM likes WHERE post_id IN (SELECT id FROM posts WHERE user_id = ?)"},
+			deletionStep{name: "queued post media", query: `
+			INSERT IGNORE INTO media_deletions (media_url, next_attempt_at, created_at)
+			SELECT media_url, UNIX_TIMESTAMP(), UNIX_TIMESTAMP() FROM post_media WHERE post_id IN (SELECT id FROM posts WHERE user_id = ?)`},
+			deletionStep{name: "queued revision media", query: `
+			INSERT IGNORE INTO media_deletions (media_url, next_attempt_at, created_at)
+			SELECT m.media_url, UNIX_TIMESTAMP(), UNIX_TIMESTAMP()
+			FROM post_revisions r, JSON_TABLE(r.media, '$[*]' COLUMNS (media_url varchar(512) PATH '$')) m
+			WHERE r.post_id IN (SELECT id FROM posts WHERE user_id = ?)`},
+			deletionStep{name: "post media", query: "DELETE FROM post_media WHERE post_id IN (SELECT id FROM posts WHERE user_id = ?)"},
+			deletionStep{name: "reviews of posts", query: "DELETE FROM post_reviews WHERE post_id IN (SELECT id FROM posts WHERE user_id = ?)"},
+			// the decision stay on posts of other people, only who made it is forgotten
+			deletionStep{name: "post reviews", query: "UPDATE post_reviews SET moderator_id = NULL WHERE moderator_id = ?"},
+			deletionStep{name: "post revisions", query: "DELETE FROM post_revisions WHERE post_id IN (SELECT id FROM posts WHERE user_id = ?)"},
+			deletionStep{name: "posts", query: "DELETE FROM posts WHERE user_id = ?"},
+		)
+	}
+	steps = append(steps,
+		// both policies drop the avatar, the file on cloudinary goes with it
+		deletionStep{name: "queued avatar", query: `
+		INSERT IGNORE INTO media_deletions (media_url, next_attempt_at, created_at)
+		SELECT avatar, UNIX_TIMESTAMP(), UNIX_TIMESTAMP() FROM users WHERE id = ? AND avatar IS NOT NULL AND avatar != ''`},
+		deletionStep{name: "personal access tokens", query: "DELETE FROM personal_access_tokens WHERE user_id = ?"},
+		deletionStep{name: "recovery codes", query: "DELETE FROM recovery_codes WHERE user_id = ?"},
+		deletionStep{name: "identities", query: "DELETE FROM user_identities WHERE user_id = ?"},
+		deletionStep{name: "password resets", query: "DELETE FROM password_resets WHERE user_id = ?"},
+		deletionStep{name: "sessions", query: "DELETE FROM authentication WHERE user_id = ?"},
+		deletionStep{name: "roles", query: "DELETE FROM user_roles WHERE user_id = ?"},
+	)
+	for _, step := range steps {
+		_, err = tx.ExecContext(ctx, step.query, userId)
+		if err != nil {
+			return fmt.Errorf("repository: failed to delete %s of user %w", step.name, err)
+		}
+	}
+
+	if policy == ACCOUNT_DELETION_HARD_DELETE {
+		_, err = tx.ExecContext(ctx, "DELETE FROM users WHERE id = ?", userId)
+	} else {
+		// email must stay unique, the id keep the placeholder unique and free the real address
+		_, err = tx.ExecContext(
+			ctx,
+			`
+			UPDATE users
+			SET fullname = ?, email = CONCAT('deleted+', id, '@deleted.invalid'), password = '',
+			handle = CONCAT('deleted_', RIGHT(REPLACE(id, '-', ''), 12)), bio = NULL, avatar = NULL,
+			email_verified_at = NULL, verification_sent_at = NULL, totp_secret = NULL, totp_enabled_at = NULL,
+			totp_last_step = NULL, token_version = token_version + 1, deleted_at = ?
+			WHERE id = ?`,
+			user.DELETED_USER_FULLNAME,
+			now,
+			userId,
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("repository: failed to delete user %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("repository: failed to commit transaction %w", err)
+	}
+	return nil
+}
+
+// only replace the hash when it's still the one we verified, a password change in between wins
+func (repo *RepositoryImpl) updatePasswordHash(ctx context.Context, userId string, oldHash string, newHash string) error {
+	_, err := repo.ExecContext(
+		ctx,
+		"UPDATE users SET password = ? WHERE id = ? AND password = ?",
+		newHash,
+		userId,
+		oldHash,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to upgrade password hash %w", err)
+	}
+	return nil
+}
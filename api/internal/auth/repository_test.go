@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apperror "github.com/zulfikarrosadi/code_roast/internal/app-error"
+)
+
+func TestRepositoryImpl_resetPassword(t *testing.T) {
+	const now = int64(1_700_000_000)
+	tests := []struct {
+		name       string
+		expiresAt  int64
+		failRevoke bool
+		expectCode int
+	}{
+		{name: "Reset revoke every credential in one transaction", expiresAt: now + 60},
+		{name: "Expired link change nothing", expiresAt: now, expectCode: http.StatusBadRequest},
+		{name: "Failed token revoke roll the password back", expiresAt: now + 60, failRevoke: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, sqlMock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+			repo := NewUserRepository(nil, db)
+
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, expires_at, used_at FROM password_resets WHERE token_hash = ? FOR UPDATE")).
+				WithArgs("token-hash").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "expires_at", "used_at"}).AddRow(1, "user-1", tt.expiresAt, nil))
+			if tt.expectCode != 0 {
+				sqlMock.ExpectRollback()
+			} else {
+				sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE users SET password = ?, token_version = token_version + 1 WHERE id = ?")).
+					WithArgs("new-hash", "user-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				revoke := sqlMock.ExpectExec(regexp.QuoteMeta("DELETE FROM personal_access_tokens WHERE user_id = ?")).
+					WithArgs("user-1")
+				if tt.failRevoke {
+					revoke.WillReturnError(errors.New("connection reset"))
+					sqlMock.ExpectRollback()
+				} else {
+					revoke.WillReturnResult(sqlmock.NewResult(0, 2))
+					sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL")).
+						WithArgs(now, "user-1").
+						WillReturnResult(sqlmock.NewResult(0, 1))
+					sqlMock.ExpectExec(regexp.QuoteMeta("DELETE FROM authentication WHERE user_id = ?")).
+						WithArgs("user-1").
+						WillReturnResult(sqlmock.NewResult(0, 3))
+					sqlMock.ExpectCommit()
+				}
+			}
+
+			err = repo.resetPassword(context.Background(), "token-hash", "new-hash", now)
+			switch {
+			case tt.expectCode != 0:
+				var appError *apperror.AppError
+				require.ErrorAs(t, err, &appError)
+				assert.Equal(t, tt.expectCode, appError.Code)
+			case tt.failRevoke:
+				assert.Error(t, err)
+			default:
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, sqlMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRepositoryImpl_rotateRefreshTokenReuse(t *testing.T) {
+	const now = int64(1_700_000_000)
+	grace := int64(REFRESH_TOKEN_REUSE_GRACE / time.Second)
+	tests := []struct {
+		name               string
+		successorLastLogin int64
+		successorReplaced  interface{}
+		expectSuccessor    bool
+	}{
+		{name: "Concurrent refresh get the successor", successorLastLogin: now - grace, expectSuccessor: true},
+		{name: "Reuse after the grace revoke the family", successorLastLogin: now - grace - 1},
+		{name: "Reuse of a token whose successor was used revoke the family", successorLastLogin: now, successorReplaced: "third-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, sqlMock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+			repo := NewUserRepository(slog.New(slog.NewTextHandler(io.Discard, nil)), db)
+
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT a.family_id, a.replaced_by, a.two_factor, a.last_login, a.expires_at, u.email , u.id, u.fullname, u.email_verified_at, u.token_version FROM authentication AS a")).
+				WithArgs("old-token").
+				WillReturnRows(sqlmock.NewRows([]string{"family_id", "replaced_by", "two_factor", "last_login", "expires_at", "email", "id", "fullname", "email_verified_at", "token_version"}).
+					AddRow("family-1", "successor-token", false, now-3600, now+3600, "user@example.com", "user-1", "User", now-7200, 1))
+			sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT last_login, replaced_by FROM authentication WHERE refresh_token = ? FOR UPDATE")).
+				WithArgs("successor-token").
+				WillReturnRows(sqlmock.NewRows([]string{"last_login", "replaced_by"}).AddRow(tt.successorLastLogin, tt.successorReplaced))
+			if tt.expectSuccessor {
+				sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT r.id as id, r.name as role FROM users AS u")).
+					WithArgs("user-1").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "role"}).AddRow(4, "member"))
+				sqlMock.ExpectCommit()
+			} else {
+				sqlMock.ExpectExec(regexp.QuoteMeta("DELETE FROM authentication WHERE family_id = ?")).
+					WithArgs("family-1").
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				sqlMock.ExpectCommit()
+			}
+
+			next := &authentication{id: "auth-2", refreshToken: "new-token", lastLogin: now}
+			result, err := repo.rotateRefreshToken(context.Background(), "old-token", next, now-86400)
+			if tt.expectSuccessor {
+				require.NoError(t, err)
+				assert.Equal(t, "successor-token", next.refreshToken)
+				assert.Equal(t, "user-1", result.id)
+			} else {
+				var appError *apperror.AppError
+				require.ErrorAs(t, err, &appError)
+				assert.Equal(t, http.StatusUnauthorized, appError.Code)
+				assert.Equal(t, "new-token", next.refreshToken)
+			}
+			assert.NoError(t, sqlMock.ExpectationsWereMet())
+		})
+	}
+}
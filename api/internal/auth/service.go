@@ -4,45 +4,107 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	apperror "github.com/zulfikarrosadi/code_roast/internal/app-error"
+	"github.com/zulfikarrosadi/code_roast/internal/mailer"
 	"github.com/zulfikarrosadi/code_roast/internal/user"
 	"github.com/zulfikarrosadi/code_roast/pkg/schema"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type Repository interface {
 	register(context.Context, user.User, authentication) (publicUserData, error)
-	loginByEmail(context.Context, string, authentication) (user.User, error)
-	findRefreshToken(context.Context, string) (publicUserData, error)
+	loginByEmail(context.Context, string) (user.User, error)
+	findUserById(context.Context, string) (user.User, error)
+	createAuthentication(context.Context, authentication) error
+	rotateRefreshToken(context.Context, string, *authentication, int64) (publicUserData, error)
+	revokeRefreshToken(context.Context, string) (int64, error)
+	revokeAllRefreshTokens(context.Context, string) (int64, error)
+	deleteExpiredSessions(context.Context, int64, int64) (int64, error)
+	findSessions(context.Context, string, int64, int64) ([]authentication, error)
+	revokeSession(context.Context, string, string) error
+	createPasswordReset(context.Context, string, passwordReset) (user.User, error)
+	findPasswordReset(context.Context, string, int64) (user.User, error)
+	resetPassword(context.Context, string, string, int64) error
+	verifyEmail(context.Context, string, string, int64) error
+	markVerificationSent(context.Context, string, int64, int64) (user.User, error)
+	findTOTP(context.Context, string) (totp, error)
+	useTOTPStep(context.Context, string, int64) error
+	saveTOTPSecret(context.Context, string, string) error
+	enableTOTP(context.Context, string, int64, []recoveryCode) error
+	disableTOTP(context.Context, string) error
+	useRecoveryCode(context.Context, string, string, int64) error
+	findTokenVersion(context.Context, string) (int64, error)
+	findUserByIdentity(context.Context, string, string) (user.User, error)
+	linkIdentity(context.Context, string, userIdentity) (user.User, error)
+	createOAuthUser(context.Context, user.User, userIdentity) (user.User, error)
+	createPersonalToken(context.Context, personalToken) error
+	findPersonalTokens(context.Context, string) ([]personalToken, error)
+	deletePersonalToken(context.Context, string, string) error
+	findPersonalTokenOwner(context.Context, string, int64) (personalToken, user.User, error)
+	touchPersonalToken(context.Context, string, int64, int64) error
+	changePassword(context.Context, string, string, string, int64) error
+	changeEmail(context.Context, string, string, int64) error
+	updatePasswordHash(context.Context, string, string, string) error
+	deleteAccount(context.Context, string, string, int64) error
 }
 
 type ServiceImpl struct {
 	Repository
-	v *validator.Validate
+	v        *validator.Validate
+	mailer   mailer.Mailer
+	attempts AttemptStore
+	keys     *KeySet
+	// built from config.Password
+	passwords PasswordHasher
+	config    Config
 }
 
-func NewUserService(repo Repository, v *validator.Validate) *ServiceImpl {
+func NewUserService(repo Repository, v *validator.Validate, mailer mailer.Mailer, attempts AttemptStore, keys *KeySet, config Config) *ServiceImpl {
+	policy := config.PasswordPolicy
+	policy.maxBytes = config.Password.maxPasswordBytes()
+	RegisterPasswordPolicy(v, policy)
 	return &ServiceImpl{
 		Repository: repo,
 		v:          v,
+		mailer:     mailer,
+		attempts:   attempts,
+		keys:       keys,
+		passwords:  NewPasswordHasher(config.Password),
+		config:     config,
 	}
 }
 
 type CustomJWTClaims struct {
-	Id       string       `json:"id"`
-	Email    string       `json:"email"`
-	Fullname string       `json:"fullname"`
-	Roles    []user.Roles `json:"roles"`
+	Id            string       `json:"id"`
+	Email         string       `json:"email"`
+	Fullname      string       `json:"fullname"`
+	Roles         []user.Roles `json:"roles"`
+	EmailVerified bool         `json:"email_verified"`
+	TwoFactor     bool         `json:"two_factor"`
+	// bumped on every role change, token carrying older version has stale roles
+	TokenVersion int64 `json:"ver"`
+	// set by AuthenticatePersonalToken, never part of a signed jwt so it can't be forged
+	PersonalToken bool `json:"-"`
 	jwt.RegisteredClaims
 }
 
+// tokens minted for a single purpose (e.g email verification) carry an audience,
+// they must never be accepted as access token
+func (claims CustomJWTClaims) Validate() error {
+	if len(claims.Audience) > 0 {
+		return errors.New("token is not an access token")
+	}
+	return nil
+}
+
 type registrationRequest struct {
 	Id                   string `json:"id"`
 	Fullname             string `json:"fullname" validate:"required"`
@@ -60,44 +122,243 @@ type loginRequest struct {
 }
 
 type registrationResponse struct {
-	ID       string       `json:"id"`
-	Email    string       `json:"email"`
-	Fullname string       `json:"fullname"`
-	Roles    []user.Roles `json:"roles"`
+	ID            string       `json:"id"`
+	Email         string       `json:"email"`
+	Fullname      string       `json:"fullname"`
+	Roles         []user.Roles `json:"roles"`
+	EmailVerified bool         `json:"email_verified"`
 }
 
 // we need this to standarize auth resposne
+// when user has two-factor enabled, sign in only return challenge token that
+// must be exchanged together with the code to get the actual tokens
 type authResponse struct {
-	User         registrationResponse `json:"user"`
-	AccessToken  string               `json:"access_token"`
-	RefreshToken string               `json:"refresh_token"`
+	User              registrationResponse `json:"user"`
+	AccessToken       string               `json:"access_token,omitempty"`
+	RefreshToken      string               `json:"refresh_token,omitempty"`
+	TwoFactorRequired bool                 `json:"two_factor_required,omitempty"`
+	ChallengeToken    string               `json:"challenge_token,omitempty"`
+}
+
+type twoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode   string `json:"recovery_code" validate:"required_without=Code"`
+	remoteIP       string
+	agent          string
+}
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+}
+
+type twoFactorEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type twoFactorResponse struct {
+	Enabled       bool     `json:"enabled"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type refreshTokenRequest struct {
+	token    string
+	remoteIP string
+	agent    string
+}
+
+type sessionDetail struct {
+	Id        string `json:"id"`
+	RemoteIP  string `json:"remote_ip"`
+	Agent     string `json:"agent"`
+	LastLogin int64  `json:"last_login"`
+	ExpiresAt int64  `json:"expires_at"`
+	Current   bool   `json:"current"`
+}
+
+type sessionsResponse struct {
+	Sessions []sessionDetail `json:"sessions"`
+}
+
+type sessionResponse struct {
+	Session sessionDetail `json:"session"`
+}
+
+type forgotPasswordRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	remoteIP string
+}
+
+type resetPasswordRequest struct {
+	Token                string `json:"token" validate:"required"`
+	Password             string `json:"password" validate:"required"`
+	PasswordConfirmation string `json:"password_confirmation" validate:"required,eqfield=Password"`
+	// owner of the token, new password can't contain them
+	email    string
+	fullname string
+}
+
+type changePasswordRequest struct {
+	CurrentPassword      string `json:"current_password" validate:"required"`
+	Password             string `json:"password" validate:"required"`
+	PasswordConfirmation string `json:"password_confirmation" validate:"required,eqfield=Password"`
+	// session that made the request stays signed in
+	refreshToken string
+	// new password can't contain them
+	email    string
+	fullname string
+	remoteIP string
+}
+
+type changeEmailRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+	remoteIP string
 }
 
-var JWT_SECRET = os.Getenv("JWT_SECRET")
+type deleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+	remoteIP string
+}
+
+type accountResponse struct {
+	Message string `json:"message"`
+}
+
+type passwordResponse struct {
+	Message string `json:"message"`
+}
+
+type verifyEmailRequest struct {
+	Token string `query:"token" json:"token" validate:"required"`
+}
+
+type emailVerificationResponse struct {
+	Message string `json:"message"`
+}
+
+type oauthStartResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+	// handed to the client as cookie, never in the body
+	stateToken string
+}
+
+type oauthCallbackRequest struct {
+	Provider   string `param:"provider"`
+	Code       string `query:"code" json:"code" validate:"required"`
+	State      string `query:"state" json:"state" validate:"required"`
+	stateToken string
+	remoteIP   string
+	agent      string
+}
+
+type personalTokenRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+	// scopes of the token, every role must be held by the user
+	RoleIds       []int `json:"role_ids" validate:"dive,min=1"`
+	ExpiresInDays int   `json:"expires_in_days" validate:"omitempty,min=1,max=365"`
+}
+
+type personalTokenDetail struct {
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	RoleIds    []int  `json:"role_ids"`
+	LastUsedAt int64  `json:"last_used_at"`
+	ExpiresAt  int64  `json:"expires_at"`
+	CreatedAt  int64  `json:"created_at"`
+	// only filled once, right after the token is created
+	Token string `json:"token,omitempty"`
+}
+
+type personalTokensResponse struct {
+	Tokens []personalTokenDetail `json:"tokens"`
+}
+
+type personalTokenResponse struct {
+	Token personalTokenDetail `json:"token"`
+}
+
+type unlockRequest struct {
+	Email string `json:"email" validate:"required_without=IP,omitempty,email"`
+	IP    string `json:"ip" validate:"required_without=Email,omitempty,ip"`
+}
+
+type unlockResponse struct {
+	Message string `json:"message"`
+}
+
+type signoutResponse struct {
+	RevokedSessions int64 `json:"revoked_sessions"`
+}
+
+func (service *ServiceImpl) signAccessToken(user publicUserData) (string, error) {
+	return service.keys.Sign(CustomJWTClaims{
+		Id:            user.id,
+		Email:         user.email,
+		Fullname:      user.fullname,
+		Roles:         user.roles,
+		EmailVerified: user.emailVerified,
+		TwoFactor:     user.twoFactor,
+		TokenVersion:  user.tokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * 5)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+	})
+}
 
-func (service *ServiceImpl) refreshToken(ctx context.Context, token string) (schema.Response[authResponse], error) {
-	user, err := service.findRefreshToken(ctx, token)
+func (service *ServiceImpl) refreshToken(ctx context.Context, data refreshTokenRequest) (schema.Response[authResponse], error) {
+	newRefreshToken, err := uuid.NewV7()
 	if err != nil {
 		return schema.Response[authResponse]{
 			Status: "fail",
-			Code:   http.StatusUnauthorized,
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "something went wrong, generate new refresh token fail, please try again later",
+			},
+		}, fmt.Errorf("service: fail generate new refresh token, %w", err)
+	}
+	authId, err := uuid.NewV7()
+	if err != nil {
+		return schema.Response[authResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "something went wrong, generate new refresh token fail, please try again later",
+			},
+		}, fmt.Errorf("service: fail generate new auth id, %w", err)
+	}
+	now := time.Now()
+	next := authentication{
+		id:           authId.String(),
+		refreshToken: newRefreshToken.String(),
+		lastLogin:    now.Unix(),
+		remoteIP:     data.remoteIP,
+		agent:        data.agent,
+	}
+	user, err := service.Repository.rotateRefreshToken(ctx, data.token, &next, service.config.Session.idleCutoff(now))
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[authResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[authResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
 			Error: schema.Error{
-				Message: "refresh token lookup not found",
+				Message: "something went wrong, please try again later",
 			},
 		}, err
 	}
-	newAccessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, CustomJWTClaims{
-		Id:       user.id,
-		Email:    user.email,
-		Fullname: user.fullname,
-		Roles:    user.roles,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * 5)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-		},
-	},
-	).SignedString([]byte(JWT_SECRET))
+	newAccessToken, err := service.signAccessToken(user)
 	if err != nil {
 		return schema.Response[authResponse]{
 			Status: "fail",
@@ -112,13 +373,14 @@ func (service *ServiceImpl) refreshToken(ctx context.Context, token string) (sch
 		Code:   http.StatusOK,
 		Data: authResponse{
 			User: registrationResponse{
-				ID:       user.id,
-				Email:    user.email,
-				Fullname: user.fullname,
-				Roles:    user.roles,
+				ID:            user.id,
+				Email:         user.email,
+				Fullname:      user.fullname,
+				Roles:         user.roles,
+				EmailVerified: user.emailVerified,
 			},
 			AccessToken:  newAccessToken,
-			RefreshToken: token,
+			RefreshToken: next.refreshToken,
 		},
 	}, nil
 }
@@ -170,7 +432,7 @@ func (service *ServiceImpl) register(
 			},
 		}, fmt.Errorf("service: fail generate new authentication id, %w", err)
 	}
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newUser.Password), 10)
+	hashedPassword, err := service.passwords.Hash(newUser.Password)
 	if err != nil {
 		return schema.Response[authResponse]{
 			Status: "fail",
@@ -187,13 +449,16 @@ func (service *ServiceImpl) register(
 			Id:        newUserId.String(),
 			Fullname:  newUser.Fullname,
 			Email:     newUser.Email,
-			Password:  string(hashedPassword),
+			Handle:    user.DefaultHandle(newUserId.String()),
+			Password:  hashedPassword,
 			CreatedAt: time.Now().Unix(),
 		},
 		authentication{
 			id:           authenticationId.String(),
 			refreshToken: refreshToken.String(),
+			familyId:     authenticationId.String(),
 			lastLogin:    time.Now().Unix(),
+			expiresAt:    time.Now().Add(service.config.Session.absoluteLifetime()).Unix(),
 			userId:       newUserId.String(),
 			agent:        newUser.Agent,
 			remoteIP:     newUser.RemoteIp,
@@ -218,18 +483,7 @@ func (service *ServiceImpl) register(
 			},
 		}, err
 	}
-	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, CustomJWTClaims{
-		Id:       user.id,
-		Email:    user.email,
-		Fullname: user.fullname,
-		Roles:    user.roles,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * 5)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-		},
-	},
-	).SignedString([]byte(JWT_SECRET))
+	accessToken, err := service.signAccessToken(user)
 	if err != nil {
 		return schema.Response[authResponse]{
 			Status: "fail",
@@ -239,15 +493,18 @@ func (service *ServiceImpl) register(
 			},
 		}, fmt.Errorf("service: fail to generate new access token, %w", err)
 	}
+	// failing to deliver this email must not fail the registration, user can ask for another one later
+	_ = service.sendVerificationEmail(ctx, user.id, user.fullname, user.email)
 	return schema.Response[authResponse]{
 		Status: "success",
 		Code:   http.StatusCreated,
 		Data: authResponse{
 			User: registrationResponse{
-				ID:       user.id,
-				Email:    user.email,
-				Fullname: user.fullname,
-				Roles:    user.roles,
+				ID:            user.id,
+				Email:         user.email,
+				Fullname:      user.fullname,
+				Roles:         user.roles,
+				EmailVerified: user.emailVerified,
 			},
 			AccessToken:  accessToken,
 			RefreshToken: refreshToken.String(),
@@ -271,79 +528,164 @@ func (service *ServiceImpl) login(
 			},
 		}, fmt.Errorf("service: input validation error %w", err)
 	}
+	err = service.checkLockout(ctx, accountAttemptKey(user.Email), ipAttemptKey(user.authentication.remoteIP))
+	if err != nil {
+		return lockoutResponse[authResponse](err), err
+	}
 
-	refreshToken, err := uuid.NewV7()
+	result, err := service.Repository.loginByEmail(ctx, user.Email)
 	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			if appError.Code == http.StatusBadRequest {
+				if err := service.recordLoginFailure(ctx, user.Email, user.authentication.remoteIP); err != nil {
+					return lockoutResponse[authResponse](err), err
+				}
+			}
+			return schema.Response[authResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
 		return schema.Response[authResponse]{
 			Status: "fail",
 			Code:   http.StatusInternalServerError,
 			Error: schema.Error{
 				Message: "fail process your request, please try again later",
 			},
-		}, fmt.Errorf("service: fail generate new refresh token, %w", err)
+		}, err
 	}
-	authId, err := uuid.NewV7()
+	err = service.passwords.Verify(result.Password, user.Password)
 	if err != nil {
+		if err := service.recordLoginFailure(ctx, user.Email, user.authentication.remoteIP); err != nil {
+			return lockoutResponse[authResponse](err), err
+		}
 		return schema.Response[authResponse]{
 			Status: "fail",
-			Code:   http.StatusInternalServerError,
+			Code:   http.StatusBadRequest,
 			Error: schema.Error{
-				Message: "fail process your request, please try again later",
+				Message: "email or password is incorrect",
 			},
-		}, fmt.Errorf("service: fail generate new auth id, %w", err)
+		}, fmt.Errorf("service: comparing password failed, %w", err)
 	}
-	result, err := service.Repository.loginByEmail(
-		ctx,
-		user.Email,
-		authentication{
-			id:           authId.String(),
-			refreshToken: refreshToken.String(),
-			lastLogin:    user.authentication.lastLogin,
-			remoteIP:     user.authentication.remoteIP,
-			agent:        user.authentication.agent,
-		},
-	)
-	if err != nil {
-		var appError *apperror.AppError
-		if errors.As(err, &appError) {
+	if service.passwords.NeedsRehash(result.Password) {
+		// plain password is only known right now, failing here just mean we try again on next sign in
+		if newHash, err := service.passwords.Hash(user.Password); err == nil {
+			service.Repository.updatePasswordHash(ctx, result.Id, result.Password, newHash)
+		}
+	}
+	if !result.TwoFactorEnabled {
+		// only full sign in clear the failures, ip failures are left alone so attacker can't use their own account to reset it
+		err = service.attempts.Reset(ctx, accountAttemptKey(user.Email))
+		if err != nil {
 			return schema.Response[authResponse]{
 				Status: "fail",
-				Code:   appError.Code,
+				Code:   http.StatusInternalServerError,
 				Error: schema.Error{
-					Message: appError.Message,
+					Message: "fail process your request, please try again later",
 				},
-			}, err
+			}, fmt.Errorf("service: fail to reset sign in attempts %w", err)
+		}
+	}
+	return service.completeSignin(ctx, result, user.authentication.remoteIP, user.authentication.agent)
+}
+
+// completeSignin is called once the user proved who they are (password, oauth provider), user with
+// two-factor enabled get a challenge token instead of a session
+func (service *ServiceImpl) completeSignin(ctx context.Context, result user.User, remoteIP string, agent string) (schema.Response[authResponse], error) {
+	userData := publicUserData{
+		id:            result.Id,
+		email:         result.Email,
+		fullname:      result.Fullname,
+		roles:         result.Roles,
+		emailVerified: result.EmailVerifiedAt != 0,
+		tokenVersion:  result.TokenVersion,
+	}
+	if result.TwoFactorEnabled {
+		// first factor is correct but session is not created until the second factor is presented
+		challengeToken, err := service.signPurposeToken(TOKEN_PURPOSE_TWO_FACTOR, result.Id, result.Email, TWO_FACTOR_CHALLENGE_LIFETIME)
+		if err != nil {
+			return schema.Response[authResponse]{
+				Status: "fail",
+				Code:   http.StatusInternalServerError,
+				Error: schema.Error{
+					Message: "fail to process your request, please try again later",
+				},
+			}, fmt.Errorf("service: fail to sign two-factor challenge token, %w", err)
 		}
+		return schema.Response[authResponse]{
+			Status: "success",
+			Code:   http.StatusAccepted,
+			Data: authResponse{
+				TwoFactorRequired: true,
+				ChallengeToken:    challengeToken,
+			},
+		}, nil
+	}
+	return service.startSession(ctx, userData, remoteIP, agent)
+}
+
+var ErrStaleToken = errors.New("access token was issued before the latest permission change")
+
+// CheckTokenVersion return ErrStaleToken when the roles of the user changed after the token was issued
+func (service *ServiceImpl) CheckTokenVersion(ctx context.Context, claims *CustomJWTClaims) error {
+	tokenVersion, err := service.Repository.findTokenVersion(ctx, claims.Id)
+	if err != nil {
+		return err
+	}
+	if tokenVersion != claims.TokenVersion {
+		return ErrStaleToken
+	}
+	return nil
+}
+
+// startSession create new token family for user that already passed every sign in step
+func (service *ServiceImpl) startSession(ctx context.Context, userData publicUserData, remoteIP string, agent string) (schema.Response[authResponse], error) {
+	refreshToken, err := uuid.NewV7()
+	if err != nil {
 		return schema.Response[authResponse]{
 			Status: "fail",
 			Code:   http.StatusInternalServerError,
 			Error: schema.Error{
 				Message: "fail process your request, please try again later",
 			},
-		}, err
+		}, fmt.Errorf("service: fail generate new refresh token, %w", err)
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(result.Password), []byte(user.Password))
+	authId, err := uuid.NewV7()
 	if err != nil {
 		return schema.Response[authResponse]{
 			Status: "fail",
-			Code:   http.StatusBadRequest,
+			Code:   http.StatusInternalServerError,
 			Error: schema.Error{
-				Message: "email or password is incorrect",
+				Message: "fail process your request, please try again later",
 			},
-		}, fmt.Errorf("service: comparing password failed, %w", err)
+		}, fmt.Errorf("service: fail generate new auth id, %w", err)
 	}
-	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, CustomJWTClaims{
-		Id:       result.Id,
-		Email:    result.Email,
-		Fullname: result.Fullname,
-		Roles:    result.Roles,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * 5)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-		},
-	},
-	).SignedString([]byte(JWT_SECRET))
+	now := time.Now()
+	err = service.Repository.createAuthentication(ctx, authentication{
+		id:           authId.String(),
+		refreshToken: refreshToken.String(),
+		familyId:     authId.String(),
+		twoFactor:    userData.twoFactor,
+		lastLogin:    now.Unix(),
+		expiresAt:    now.Add(service.config.Session.absoluteLifetime()).Unix(),
+		remoteIP:     remoteIP,
+		agent:        agent,
+		userId:       userData.id,
+	})
+	if err != nil {
+		return schema.Response[authResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail process your request, please try again later",
+			},
+		}, err
+	}
+	accessToken, err := service.signAccessToken(userData)
 	if err != nil {
 		return schema.Response[authResponse]{
 			Status: "fail",
@@ -358,13 +700,1541 @@ func (service *ServiceImpl) login(
 		Code:   http.StatusOK,
 		Data: authResponse{
 			User: registrationResponse{
-				ID:       result.Id,
-				Email:    result.Email,
-				Fullname: result.Fullname,
-				Roles:    result.Roles,
+				ID:            userData.id,
+				Email:         userData.email,
+				Fullname:      userData.fullname,
+				Roles:         userData.roles,
+				EmailVerified: userData.emailVerified,
 			},
 			AccessToken:  accessToken,
 			RefreshToken: refreshToken.String(),
 		},
 	}, nil
 }
+
+// useTOTP accept every time step once, so a code seen over someone's shoulder can't be replayed while it is still valid
+func (service *ServiceImpl) useTOTP(ctx context.Context, userId string, secret totp, code string, now time.Time) error {
+	step, ok := validateTOTP(secret.secret, code, now, secret.lastStep)
+	if !ok {
+		return apperror.New(http.StatusBadRequest, "two-factor code is incorrect", errors.New("service: invalid totp code"))
+	}
+	return service.Repository.useTOTPStep(ctx, userId, step)
+}
+
+// second step of sign in for user with two-factor enabled, either totp code or one of the recovery code is accepted
+func (service *ServiceImpl) loginTwoFactor(ctx context.Context, data twoFactorLoginRequest) (schema.Response[authResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationErrorDetail := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[authResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationErrorDetail,
+			},
+		}, fmt.Errorf("service: input validation error %w", err)
+	}
+	claims, err := service.parsePurposeToken(data.ChallengeToken, TOKEN_PURPOSE_TWO_FACTOR)
+	if err != nil {
+		return schema.Response[authResponse]{
+			Status: "fail",
+			Code:   http.StatusUnauthorized,
+			Error: schema.Error{
+				Message: "sign in attempt is invalid or has expired, please sign in again",
+			},
+		}, fmt.Errorf("service: %w", err)
+	}
+	// guessing the code is counted against the same account as guessing the password
+	err = service.checkLockout(ctx, accountAttemptKey(claims.Email), ipAttemptKey(data.remoteIP))
+	if err != nil {
+		return lockoutResponse[authResponse](err), err
+	}
+	secret, err := service.Repository.findTOTP(ctx, claims.Subject)
+	if err != nil {
+		return schema.Response[authResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail process your request, please try again later",
+			},
+		}, err
+	}
+	if !secret.enabled {
+		return schema.Response[authResponse]{
+			Status: "fail",
+			Code:   http.StatusUnauthorized,
+			Error: schema.Error{
+				Message: "sign in attempt is invalid or has expired, please sign in again",
+			},
+		}, errors.New("service: two-factor is no longer enabled for this user")
+	}
+	if data.Code != "" {
+		err = service.useTOTP(ctx, claims.Subject, secret, data.Code, time.Now())
+		if err != nil {
+			var appError *apperror.AppError
+			if errors.As(err, &appError) {
+				if err := service.recordLoginFailure(ctx, claims.Email, data.remoteIP); err != nil {
+					return lockoutResponse[authResponse](err), err
+				}
+				return schema.Response[authResponse]{
+					Status: "fail",
+					Code:   appError.Code,
+					Error: schema.Error{
+						Message: appError.Message,
+					},
+				}, err
+			}
+			return schema.Response[authResponse]{
+				Status: "fail",
+				Code:   http.StatusInternalServerError,
+				Error: schema.Error{
+					Message: "fail process your request, please try again later",
+				},
+			}, err
+		}
+	} else {
+		err = service.Repository.useRecoveryCode(ctx, claims.Subject, hashToken(normalizeRecoveryCode(data.RecoveryCode)), time.Now().Unix())
+		if err != nil {
+			var appError *apperror.AppError
+			if errors.As(err, &appError) {
+				if err := service.recordLoginFailure(ctx, claims.Email, data.remoteIP); err != nil {
+					return lockoutResponse[authResponse](err), err
+				}
+				return schema.Response[authResponse]{
+					Status: "fail",
+					Code:   appError.Code,
+					Error: schema.Error{
+						Message: appError.Message,
+					},
+				}, err
+			}
+			return schema.Response[authResponse]{
+				Status: "fail",
+				Code:   http.StatusInternalServerError,
+				Error: schema.Error{
+					Message: "fail process your request, please try again later",
+				},
+			}, err
+		}
+	}
+	result, err := service.Repository.findUserById(ctx, claims.Subject)
+	if err != nil {
+		return schema.Response[authResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail process your request, please try again later",
+			},
+		}, err
+	}
+	err = service.attempts.Reset(ctx, accountAttemptKey(claims.Email))
+	if err != nil {
+		return schema.Response[authResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail process your request, please try again later",
+			},
+		}, fmt.Errorf("service: fail to reset sign in attempts %w", err)
+	}
+	return service.startSession(ctx, publicUserData{
+		id:            result.Id,
+		email:         result.Email,
+		fullname:      result.Fullname,
+		roles:         result.Roles,
+		emailVerified: result.EmailVerifiedAt != 0,
+		tokenVersion:  result.TokenVersion,
+		twoFactor:     true,
+	}, data.remoteIP, data.agent)
+}
+
+// checkLockout return lockedOutError when any of the keys is still locked
+func (service *ServiceImpl) checkLockout(ctx context.Context, keys ...string) error {
+	var retryAfter time.Duration
+	for _, key := range keys {
+		lockedUntil, err := service.attempts.LockedUntil(ctx, key)
+		if err != nil {
+			return fmt.Errorf("service: fail to check sign in lockout %w", err)
+		}
+		if remaining := time.Until(lockedUntil); remaining > retryAfter {
+			retryAfter = remaining
+		}
+	}
+	if retryAfter > 0 {
+		return &lockedOutError{retryAfter: retryAfter}
+	}
+	return nil
+}
+
+// recordLoginFailure count the failure against the account and the ip, locking those that reached their limit
+func (service *ServiceImpl) recordLoginFailure(ctx context.Context, email string, remoteIP string) error {
+	limits := map[string]int64{
+		accountAttemptKey(email): service.config.Lockout.maxAccountAttempts(),
+	}
+	if remoteIP != "" {
+		limits[ipAttemptKey(remoteIP)] = service.config.Lockout.maxIPAttempts()
+	}
+	for key, limit := range limits {
+		failures, err := service.attempts.Fail(ctx, key, service.config.Lockout.attemptWindow())
+		if err != nil {
+			return fmt.Errorf("service: fail to record sign in failure %w", err)
+		}
+		lockout := service.config.Lockout.lockoutDuration(failures, limit)
+		if lockout == 0 {
+			continue
+		}
+		err = service.attempts.Lock(ctx, key, time.Now().Add(lockout))
+		if err != nil {
+			return fmt.Errorf("service: fail to lock %w", err)
+		}
+	}
+	return nil
+}
+
+// limitPasswordReset count the request against the email and the ip, past their limit they are locked for a window.
+// unregistered emails are counted too, otherwise the limit would tell which ones are registered
+func (service *ServiceImpl) limitPasswordReset(ctx context.Context, email string, remoteIP string) error {
+	keys := []string{passwordResetAttemptKey(accountAttemptKey(email))}
+	limits := map[string]int64{
+		keys[0]: service.config.passwordResetMaxPerEmail(),
+	}
+	if remoteIP != "" {
+		keys = append(keys, passwordResetAttemptKey(ipAttemptKey(remoteIP)))
+		limits[keys[1]] = service.config.passwordResetMaxPerIP()
+	}
+	err := service.checkLockout(ctx, keys...)
+	if err != nil {
+		return err
+	}
+	window := service.config.passwordResetWindow()
+	for _, key := range keys {
+		requests, err := service.attempts.Fail(ctx, key, window)
+		if err != nil {
+			return fmt.Errorf("service: fail to count password reset request %w", err)
+		}
+		if requests <= limits[key] {
+			continue
+		}
+		err = service.attempts.Lock(ctx, key, time.Now().Add(window))
+		if err != nil {
+			return fmt.Errorf("service: fail to lock %w", err)
+		}
+		return &lockedOutError{retryAfter: window}
+	}
+	return nil
+}
+
+func lockoutResponse[T any](err error) schema.Response[T] {
+	var lockedOut *lockedOutError
+	if errors.As(err, &lockedOut) {
+		return schema.Response[T]{
+			Status: "fail",
+			Code:   http.StatusTooManyRequests,
+			Error: schema.Error{
+				Message: fmt.Sprintf("too many failed sign in attempts, please try again in %d seconds", lockedOut.retryAfterSeconds()),
+			},
+		}
+	}
+	return schema.Response[T]{
+		Status: "fail",
+		Code:   http.StatusInternalServerError,
+		Error: schema.Error{
+			Message: "fail process your request, please try again later",
+		},
+	}
+}
+
+// unlock lift the lockout of an account and/or ip before it runs out by itself
+func (service *ServiceImpl) unlock(ctx context.Context, data unlockRequest) (schema.Response[unlockResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationErrorDetail := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[unlockResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationErrorDetail,
+			},
+		}, fmt.Errorf("service: input validation error %w", err)
+	}
+	keys := []string{}
+	if data.Email != "" {
+		keys = append(keys, accountAttemptKey(data.Email))
+	}
+	if data.IP != "" {
+		keys = append(keys, ipAttemptKey(data.IP))
+	}
+	for _, key := range keys {
+		err = service.attempts.Reset(ctx, key)
+		if err != nil {
+			return schema.Response[unlockResponse]{
+				Status: "fail",
+				Code:   http.StatusInternalServerError,
+				Error: schema.Error{
+					Message: "fail to unlock, please try again later",
+				},
+			}, fmt.Errorf("service: fail to reset sign in attempts %w", err)
+		}
+	}
+	return schema.Response[unlockResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: unlockResponse{
+			Message: "sign in attempts have been reset",
+		},
+	}, nil
+}
+
+// enrollTwoFactor generate new secret, it is not enforced until confirmed with a valid code
+func (service *ServiceImpl) enrollTwoFactor(ctx context.Context, userId string, email string) (schema.Response[twoFactorEnrollmentResponse], error) {
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return schema.Response[twoFactorEnrollmentResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to enable two-factor authentication, please try again later",
+			},
+		}, fmt.Errorf("service: %w", err)
+	}
+	err = service.Repository.saveTOTPSecret(ctx, userId, secret)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[twoFactorEnrollmentResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[twoFactorEnrollmentResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to enable two-factor authentication, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[twoFactorEnrollmentResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: twoFactorEnrollmentResponse{
+			Secret: secret,
+			URI:    totpURI(email, secret),
+		},
+	}, nil
+}
+
+// confirmTwoFactor turn two-factor on and hand the recovery codes to the user, this is the only time they are shown
+func (service *ServiceImpl) confirmTwoFactor(ctx context.Context, userId string, data twoFactorCodeRequest) (schema.Response[twoFactorResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationErrorDetail := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[twoFactorResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationErrorDetail,
+			},
+		}, fmt.Errorf("service: input validation error %w", err)
+	}
+	secret, err := service.Repository.findTOTP(ctx, userId)
+	if err != nil {
+		return schema.Response[twoFactorResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to enable two-factor authentication, please try again later",
+			},
+		}, err
+	}
+	if secret.enabled {
+		return schema.Response[twoFactorResponse]{
+			Status: "fail",
+			Code:   http.StatusConflict,
+			Error: schema.Error{
+				Message: "two-factor authentication is already enabled",
+			},
+		}, errors.New("service: two-factor is already enabled")
+	}
+	if secret.secret == "" {
+		return schema.Response[twoFactorResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: "start two-factor enrollment first",
+			},
+		}, errors.New("service: two-factor enrollment not started")
+	}
+	now := time.Now()
+	err = service.useTOTP(ctx, userId, secret, data.Code, now)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[twoFactorResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[twoFactorResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to enable two-factor authentication, please try again later",
+			},
+		}, err
+	}
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return schema.Response[twoFactorResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to enable two-factor authentication, please try again later",
+			},
+		}, fmt.Errorf("service: %w", err)
+	}
+	recoveryCodes := []recoveryCode{}
+	for _, code := range codes {
+		codeId, err := uuid.NewV7()
+		if err != nil {
+			return schema.Response[twoFactorResponse]{
+				Status: "fail",
+				Code:   http.StatusInternalServerError,
+				Error: schema.Error{
+					Message: "fail to enable two-factor authentication, please try again later",
+				},
+			}, fmt.Errorf("service: fail generate recovery code id, %w", err)
+		}
+		recoveryCodes = append(recoveryCodes, recoveryCode{
+			id:        codeId.String(),
+			codeHash:  hashToken(code),
+			createdAt: now.Unix(),
+		})
+	}
+	err = service.Repository.enableTOTP(ctx, userId, now.Unix(), recoveryCodes)
+	if err != nil {
+		return schema.Response[twoFactorResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to enable two-factor authentication, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[twoFactorResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: twoFactorResponse{
+			Enabled:       true,
+			RecoveryCodes: codes,
+		},
+	}, nil
+}
+
+func (service *ServiceImpl) disableTwoFactor(ctx context.Context, userId string, data twoFactorCodeRequest) (schema.Response[twoFactorResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationErrorDetail := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[twoFactorResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationErrorDetail,
+			},
+		}, fmt.Errorf("service: input validation error %w", err)
+	}
+	secret, err := service.Repository.findTOTP(ctx, userId)
+	if err != nil {
+		return schema.Response[twoFactorResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to disable two-factor authentication, please try again later",
+			},
+		}, err
+	}
+	if !secret.enabled {
+		return schema.Response[twoFactorResponse]{
+			Status: "fail",
+			Code:   http.StatusConflict,
+			Error: schema.Error{
+				Message: "two-factor authentication is not enabled",
+			},
+		}, errors.New("service: two-factor is not enabled")
+	}
+	err = service.useTOTP(ctx, userId, secret, data.Code, time.Now())
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[twoFactorResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[twoFactorResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to disable two-factor authentication, please try again later",
+			},
+		}, err
+	}
+	err = service.Repository.disableTOTP(ctx, userId)
+	if err != nil {
+		return schema.Response[twoFactorResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to disable two-factor authentication, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[twoFactorResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: twoFactorResponse{
+			Enabled: false,
+		},
+	}, nil
+}
+
+func (service *ServiceImpl) signout(ctx context.Context, token string) (schema.Response[signoutResponse], error) {
+	revoked, err := service.Repository.revokeRefreshToken(ctx, token)
+	if err != nil {
+		return schema.Response[signoutResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to sign out, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[signoutResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: signoutResponse{
+			RevokedSessions: revoked,
+		},
+	}, nil
+}
+
+func (service *ServiceImpl) signoutAll(ctx context.Context, userId string) (schema.Response[signoutResponse], error) {
+	revoked, err := service.Repository.revokeAllRefreshTokens(ctx, userId)
+	if err != nil {
+		return schema.Response[signoutResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to sign out from all devices, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[signoutResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: signoutResponse{
+			RevokedSessions: revoked,
+		},
+	}, nil
+}
+
+// currentToken is the refresh token of the requester, used to flag the device they are using now
+func (service *ServiceImpl) listSessions(ctx context.Context, userId string, currentToken string) (schema.Response[sessionsResponse], error) {
+	now := time.Now()
+	result, err := service.Repository.findSessions(ctx, userId, now.Unix(), service.config.Session.idleCutoff(now))
+	if err != nil {
+		return schema.Response[sessionsResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to get your active sessions, please try again later",
+			},
+		}, err
+	}
+	sessions := []sessionDetail{}
+	for _, session := range result {
+		sessions = append(sessions, sessionDetail{
+			Id:        session.familyId,
+			RemoteIP:  session.remoteIP,
+			Agent:     session.agent,
+			LastLogin: session.lastLogin,
+			ExpiresAt: session.expiresAt,
+			Current:   currentToken != "" && session.refreshToken == currentToken,
+		})
+	}
+	return schema.Response[sessionsResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: sessionsResponse{
+			Sessions: sessions,
+		},
+	}, nil
+}
+
+func (service *ServiceImpl) revokeSession(ctx context.Context, userId string, sessionId string) (schema.Response[sessionResponse], error) {
+	err := service.Repository.revokeSession(ctx, userId, sessionId)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[sessionResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[sessionResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to revoke this session, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[sessionResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: sessionResponse{
+			Session: sessionDetail{
+				Id: sessionId,
+			},
+		},
+	}, nil
+}
+
+func (service *ServiceImpl) forgotPassword(ctx context.Context, data forgotPasswordRequest) (schema.Response[passwordResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationErrorDetail := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[passwordResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationErrorDetail,
+			},
+		}, fmt.Errorf("service: input validation error %w", err)
+	}
+	err = service.limitPasswordReset(ctx, data.Email, data.remoteIP)
+	if err != nil {
+		var lockedOut *lockedOutError
+		if errors.As(err, &lockedOut) {
+			return schema.Response[passwordResponse]{
+				Status: "fail",
+				Code:   http.StatusTooManyRequests,
+				Error: schema.Error{
+					Message: fmt.Sprintf("too many password reset requests, please try again in %d seconds", lockedOut.retryAfterSeconds()),
+				},
+			}, err
+		}
+		return schema.Response[passwordResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to process your request, please try again later",
+			},
+		}, err
+	}
+	// same response whether the email is registered or not and whether the email went out,
+	// so this can't be used to enumerate accounts
+	successResponse := schema.Response[passwordResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: passwordResponse{
+			Message: "if the email is registered, a password reset link has been sent to it",
+		},
+	}
+
+	resetId, err := uuid.NewV7()
+	if err != nil {
+		return schema.Response[passwordResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to process your request, please try again later",
+			},
+		}, fmt.Errorf("service: fail generate password reset id, %w", err)
+	}
+	token, err := generateToken()
+	if err != nil {
+		return schema.Response[passwordResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to process your request, please try again later",
+			},
+		}, fmt.Errorf("service: fail generate password reset token, %w", err)
+	}
+	now := time.Now()
+	result, err := service.Repository.createPasswordReset(ctx, data.Email, passwordReset{
+		id:        resetId.String(),
+		tokenHash: hashToken(token),
+		expiresAt: now.Add(service.config.passwordResetLifetime()).Unix(),
+		createdAt: now.Unix(),
+	})
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) && appError.Code == http.StatusNotFound {
+			return successResponse, nil
+		}
+		return schema.Response[passwordResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to process your request, please try again later",
+			},
+		}, err
+	}
+	err = service.mailer.Send(ctx, mailer.Message{
+		To:      result.Email,
+		Subject: "Reset your Code Roast password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nSomeone asked to reset the password of your Code Roast account. Open the link below to choose a new one:\n\n%s/reset-password?token=%s\n\nThe link expires in %s and can only be used once. If it wasn't you, just ignore this email.\n",
+			result.Fullname,
+			service.config.AppURL,
+			url.QueryEscape(token),
+			service.config.passwordResetLifetime(),
+		),
+	})
+	if err != nil {
+		service.config.logger().LogAttrs(ctx, slog.LevelError, "PASSWORD_RESET_MAIL_ERROR",
+			slog.String("user_id", result.Id),
+			slog.String("error", err.Error()),
+		)
+	}
+	return successResponse, nil
+}
+
+func (service *ServiceImpl) resetPassword(ctx context.Context, data resetPasswordRequest) (schema.Response[passwordResponse], error) {
+	if data.Token != "" {
+		owner, err := service.Repository.findPasswordReset(ctx, hashToken(data.Token), time.Now().Unix())
+		if err != nil {
+			var appError *apperror.AppError
+			if errors.As(err, &appError) {
+				return schema.Response[passwordResponse]{
+					Status: "fail",
+					Code:   appError.Code,
+					Error: schema.Error{
+						Message: appError.Message,
+					},
+				}, err
+			}
+			return schema.Response[passwordResponse]{
+				Status: "fail",
+				Code:   http.StatusInternalServerError,
+				Error: schema.Error{
+					Message: "fail to reset your password, please try again later",
+				},
+			}, err
+		}
+		data.email, data.fullname = owner.Email, owner.Fullname
+	}
+	err := service.v.Struct(data)
+	if err != nil {
+		validationErrorDetail := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[passwordResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationErrorDetail,
+			},
+		}, fmt.Errorf("service: input validation error %w", err)
+	}
+	hashedPassword, err := service.passwords.Hash(data.Password)
+	if err != nil {
+		return schema.Response[passwordResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to reset your password, please try again later",
+			},
+		}, fmt.Errorf("service: fail generate hash from user password, %w", err)
+	}
+	err = service.Repository.resetPassword(ctx, hashToken(data.Token), hashedPassword, time.Now().Unix())
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[passwordResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[passwordResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to reset your password, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[passwordResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: passwordResponse{
+			Message: "your password has been changed, please sign in again",
+		},
+	}, nil
+}
+
+func (service *ServiceImpl) sendVerificationEmail(ctx context.Context, userId string, fullname string, email string) error {
+	token, err := service.signPurposeToken(TOKEN_PURPOSE_EMAIL_VERIFICATION, userId, email, service.config.emailVerificationLifetime())
+	if err != nil {
+		return fmt.Errorf("service: fail to sign email verification token %w", err)
+	}
+	err = service.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your Code Roast email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nWelcome to Code Roast! Open the link below to verify your email address:\n\n%s/verify-email?token=%s\n\nThe link expires in %s.\n",
+			fullname,
+			service.config.AppURL,
+			url.QueryEscape(token),
+			service.config.emailVerificationLifetime(),
+		),
+	})
+	if err != nil {
+		return fmt.Errorf("service: fail to send verification email %w", err)
+	}
+	return nil
+}
+
+func (service *ServiceImpl) verifyEmail(ctx context.Context, data verifyEmailRequest) (schema.Response[emailVerificationResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationErrorDetail := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[emailVerificationResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationErrorDetail,
+			},
+		}, fmt.Errorf("service: input validation error %w", err)
+	}
+	claims, err := service.parsePurposeToken(data.Token, TOKEN_PURPOSE_EMAIL_VERIFICATION)
+	if err != nil {
+		return schema.Response[emailVerificationResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: "verification link is invalid or has expired",
+			},
+		}, fmt.Errorf("service: %w", err)
+	}
+	err = service.Repository.verifyEmail(ctx, claims.Subject, claims.Email, time.Now().Unix())
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[emailVerificationResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[emailVerificationResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to verify your email, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[emailVerificationResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: emailVerificationResponse{
+			Message: "your email has been verified, refresh your access token to use it",
+		},
+	}, nil
+}
+
+func (service *ServiceImpl) resendVerification(ctx context.Context, userId string) (schema.Response[emailVerificationResponse], error) {
+	now := time.Now()
+	result, err := service.Repository.markVerificationSent(ctx, userId, now.Unix(), now.Add(-service.config.verificationResendCooldown()).Unix())
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[emailVerificationResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[emailVerificationResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to send verification email, please try again later",
+			},
+		}, err
+	}
+	err = service.sendVerificationEmail(ctx, result.Id, result.Fullname, result.Email)
+	if err != nil {
+		return schema.Response[emailVerificationResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to send verification email, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[emailVerificationResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: emailVerificationResponse{
+			Message: "verification email has been sent",
+		},
+	}, nil
+}
+
+func (service *ServiceImpl) jwks() jsonWebKeySet {
+	return service.keys.JWKS()
+}
+
+// startOAuth build the url of the provider consent screen, state and pkce verifier are returned
+// signed so the api stay stateless between the redirect and the callback
+func (service *ServiceImpl) startOAuth(ctx context.Context, providerName string) (schema.Response[oauthStartResponse], error) {
+	provider, ok := service.config.OAuthProviders[providerName]
+	if !ok {
+		return schema.Response[oauthStartResponse]{
+			Status: "fail",
+			Code:   http.StatusNotFound,
+			Error: schema.Error{
+				Message: "sign in provider not found",
+			},
+		}, fmt.Errorf("service: unknown oauth provider %s", providerName)
+	}
+	state, err := randomURLSafe(24)
+	if err != nil {
+		return schema.Response[oauthStartResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to process your request, please try again later",
+			},
+		}, fmt.Errorf("service: %w", err)
+	}
+	verifier, err := randomURLSafe(32)
+	if err != nil {
+		return schema.Response[oauthStartResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to process your request, please try again later",
+			},
+		}, fmt.Errorf("service: %w", err)
+	}
+	stateToken, err := service.signOAuthState(providerName, state, verifier)
+	if err != nil {
+		return schema.Response[oauthStartResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to process your request, please try again later",
+			},
+		}, fmt.Errorf("service: %w", err)
+	}
+	return schema.Response[oauthStartResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: oauthStartResponse{
+			AuthorizationURL: provider.authorizationURL(state, verifier),
+			stateToken:       stateToken,
+		},
+	}, nil
+}
+
+func (service *ServiceImpl) oauthCallback(ctx context.Context, data oauthCallbackRequest) (schema.Response[authResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationErrorDetail := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[authResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationErrorDetail,
+			},
+		}, fmt.Errorf("service: input validation error %w", err)
+	}
+	provider, ok := service.config.OAuthProviders[data.Provider]
+	if !ok {
+		return schema.Response[authResponse]{
+			Status: "fail",
+			Code:   http.StatusNotFound,
+			Error: schema.Error{
+				Message: "sign in provider not found",
+			},
+		}, fmt.Errorf("service: unknown oauth provider %s", data.Provider)
+	}
+	// the state must come back the same browser that started the flow, otherwise it's csrf
+	state, err := service.parseOAuthState(data.stateToken)
+	if err != nil || state.ID != data.State || state.Provider != data.Provider {
+		return schema.Response[authResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: "sign in attempt is invalid or has expired, please try again",
+			},
+		}, fmt.Errorf("service: oauth state mismatch %w", err)
+	}
+	accessToken, err := provider.exchangeCode(ctx, data.Code, state.CodeVerifier)
+	if err != nil {
+		return schema.Response[authResponse]{
+			Status: "fail",
+			Code:   http.StatusBadGateway,
+			Error: schema.Error{
+				Message: "fail to sign in with " + data.Provider + ", please try again",
+			},
+		}, fmt.Errorf("service: %w", err)
+	}
+	identity, err := provider.fetchIdentity(ctx, data.Provider, accessToken)
+	if err != nil {
+		return schema.Response[authResponse]{
+			Status: "fail",
+			Code:   http.StatusBadGateway,
+			Error: schema.Error{
+				Message: "fail to sign in with " + data.Provider + ", please try again",
+			},
+		}, fmt.Errorf("service: %w", err)
+	}
+	result, err := service.findOrCreateOAuthUser(ctx, identity)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[authResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[authResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail process your request, please try again later",
+			},
+		}, err
+	}
+	return service.completeSignin(ctx, result, data.remoteIP, data.agent)
+}
+
+// findOrCreateOAuthUser resolve the identity to a local user. identity with email verified by the provider
+// is linked to the existing account with that email when its owner verified it too, otherwise a new member account is created
+func (service *ServiceImpl) findOrCreateOAuthUser(ctx context.Context, identity oauthIdentity) (user.User, error) {
+	var appError *apperror.AppError
+	result, err := service.Repository.findUserByIdentity(ctx, identity.provider, identity.subject)
+	if err == nil {
+		return result, nil
+	}
+	if !errors.As(err, &appError) || appError.Code != http.StatusNotFound {
+		return user.User{}, err
+	}
+
+	identityId, err := uuid.NewV7()
+	if err != nil {
+		return user.User{}, fmt.Errorf("service: fail generate identity id, %w", err)
+	}
+	now := time.Now().Unix()
+	newIdentity := userIdentity{
+		id:        identityId.String(),
+		provider:  identity.provider,
+		subject:   identity.subject,
+		email:     identity.email,
+		createdAt: now,
+	}
+	if identity.emailVerified {
+		result, err = service.Repository.linkIdentity(ctx, identity.email, newIdentity)
+		if err == nil {
+			return result, nil
+		}
+		if !errors.As(err, &appError) || appError.Code != http.StatusNotFound {
+			return user.User{}, err
+		}
+	}
+
+	newUserId, err := uuid.NewV7()
+	if err != nil {
+		return user.User{}, fmt.Errorf("service: fail generate new user id, %w", err)
+	}
+	newUser := user.User{
+		Id:       newUserId.String(),
+		Fullname: identity.name,
+		Email:    identity.email,
+		Handle:   user.DefaultHandle(newUserId.String()),
+		// no password, bcrypt never match an empty hash so password sign in is impossible until reset
+		Password:  "",
+		CreatedAt: now,
+	}
+	if identity.emailVerified {
+		newUser.EmailVerifiedAt = now
+	}
+	newIdentity.userId = newUser.Id
+	return service.Repository.createOAuthUser(ctx, newUser, newIdentity)
+}
+
+// createPersonalToken only grant roles the caller hold both now and in its access token,
+// a personal access token can't mint other tokens
+func (service *ServiceImpl) createPersonalToken(ctx context.Context, caller *CustomJWTClaims, data personalTokenRequest) (schema.Response[personalTokenResponse], error) {
+	if caller.PersonalToken {
+		return schema.Response[personalTokenResponse]{
+			Status: "fail",
+			Code:   http.StatusForbidden,
+			Error: schema.Error{
+				Message: PERSONAL_TOKEN_FORBIDDEN_MESSAGE,
+			},
+		}, errors.New("service: personal access token used to create a personal access token")
+	}
+	userId := caller.Id
+	err := service.v.Struct(data)
+	if err != nil {
+		validationErrorDetail := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[personalTokenResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationErrorDetail,
+			},
+		}, fmt.Errorf("service: input validation error %w", err)
+	}
+	owner, err := service.Repository.findUserById(ctx, userId)
+	if err != nil {
+		return schema.Response[personalTokenResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to create token, please try again later",
+			},
+		}, err
+	}
+	callerRoles := map[int]bool{}
+	for _, role := range caller.Roles {
+		callerRoles[role.Id] = true
+	}
+	heldRoles := map[int]bool{}
+	for _, role := range owner.Roles {
+		heldRoles[role.Id] = callerRoles[role.Id]
+	}
+	roleIds := []int{}
+	requested := map[int]bool{}
+	for _, roleId := range data.RoleIds {
+		if !heldRoles[roleId] {
+			return schema.Response[personalTokenResponse]{
+				Status: "fail",
+				Code:   http.StatusForbidden,
+				Error: schema.Error{
+					Message: fmt.Sprintf("you can't grant role %d you don't have to a token", roleId),
+				},
+			}, fmt.Errorf("service: user %s doesn't hold role %d", userId, roleId)
+		}
+		if !requested[roleId] {
+			requested[roleId] = true
+			roleIds = append(roleIds, roleId)
+		}
+	}
+
+	tokenId, err := uuid.NewV7()
+	if err != nil {
+		return schema.Response[personalTokenResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to create token, please try again later",
+			},
+		}, fmt.Errorf("service: fail generate personal token id, %w", err)
+	}
+	secret, err := generateToken()
+	if err != nil {
+		return schema.Response[personalTokenResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to create token, please try again later",
+			},
+		}, fmt.Errorf("service: %w", err)
+	}
+	token := PERSONAL_TOKEN_PREFIX + secret
+	now := time.Now()
+	newToken := personalToken{
+		id:        tokenId.String(),
+		userId:    userId,
+		name:      data.Name,
+		tokenHash: hashToken(token),
+		roleIds:   roleIds,
+		createdAt: now.Unix(),
+	}
+	if data.ExpiresInDays > 0 {
+		newToken.expiresAt = now.AddDate(0, 0, data.ExpiresInDays).Unix()
+	}
+	err = service.Repository.createPersonalToken(ctx, newToken)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[personalTokenResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[personalTokenResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to create token, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[personalTokenResponse]{
+		Status: "success",
+		Code:   http.StatusCreated,
+		Data: personalTokenResponse{
+			Token: personalTokenDetail{
+				Id:        newToken.id,
+				Name:      newToken.name,
+				RoleIds:   newToken.roleIds,
+				ExpiresAt: newToken.expiresAt,
+				CreatedAt: newToken.createdAt,
+				Token:     token,
+			},
+		},
+	}, nil
+}
+
+func (service *ServiceImpl) listPersonalTokens(ctx context.Context, userId string) (schema.Response[personalTokensResponse], error) {
+	result, err := service.Repository.findPersonalTokens(ctx, userId)
+	if err != nil {
+		return schema.Response[personalTokensResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to get your tokens, please try again later",
+			},
+		}, err
+	}
+	tokens := []personalTokenDetail{}
+	for _, token := range result {
+		tokens = append(tokens, personalTokenDetail{
+			Id:         token.id,
+			Name:       token.name,
+			RoleIds:    token.roleIds,
+			LastUsedAt: token.lastUsedAt,
+			ExpiresAt:  token.expiresAt,
+			CreatedAt:  token.createdAt,
+		})
+	}
+	return schema.Response[personalTokensResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: personalTokensResponse{
+			Tokens: tokens,
+		},
+	}, nil
+}
+
+func (service *ServiceImpl) revokePersonalToken(ctx context.Context, userId string, tokenId string) (schema.Response[personalTokenResponse], error) {
+	err := service.Repository.deletePersonalToken(ctx, userId, tokenId)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[personalTokenResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[personalTokenResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to revoke token, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[personalTokenResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: personalTokenResponse{
+			Token: personalTokenDetail{
+				Id: tokenId,
+			},
+		},
+	}, nil
+}
+
+// AuthenticatePersonalToken turn a personal access token into the same claims an access token carry,
+// so every handler and middleware after it doesn't need to know which one was used
+func (service *ServiceImpl) AuthenticatePersonalToken(ctx context.Context, token string) (*CustomJWTClaims, error) {
+	now := time.Now()
+	result, owner, err := service.Repository.findPersonalTokenOwner(ctx, hashToken(token), now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	err = service.Repository.touchPersonalToken(ctx, result.id, now.Unix(), now.Add(-PERSONAL_TOKEN_TOUCH_INTERVAL).Unix())
+	if err != nil {
+		return nil, err
+	}
+	return &CustomJWTClaims{
+		Id:            owner.Id,
+		Email:         owner.Email,
+		Fullname:      owner.Fullname,
+		Roles:         owner.Roles,
+		EmailVerified: owner.EmailVerifiedAt != 0,
+		// roles are read fresh on every request, so the token is never stale
+		TokenVersion:  owner.TokenVersion,
+		PersonalToken: true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:      result.id,
+			Subject: owner.Id,
+		},
+	}, nil
+}
+
+// confirmPassword is asked before every change that can lock the owner out of the account. it is guarded
+// by the same lockout as sign in, a stolen access token must not become a password oracle
+func (service *ServiceImpl) confirmPassword(ctx context.Context, userId string, password string, remoteIP string) (user.User, error) {
+	result, err := service.Repository.findUserById(ctx, userId)
+	if err != nil {
+		return user.User{}, err
+	}
+	if result.Password == "" {
+		// account created with oauth
+		return user.User{}, apperror.New(http.StatusBadRequest, "your account has no password yet, set one with forgot password first", nil)
+	}
+	keys := []string{accountAttemptKey(result.Email)}
+	if remoteIP != "" {
+		keys = append(keys, ipAttemptKey(remoteIP))
+	}
+	err = service.checkLockout(ctx, keys...)
+	if err != nil {
+		return user.User{}, err
+	}
+	err = service.passwords.Verify(result.Password, password)
+	if err != nil {
+		if err := service.recordLoginFailure(ctx, result.Email, remoteIP); err != nil {
+			return user.User{}, err
+		}
+		return user.User{}, apperror.New(http.StatusBadRequest, "current password is incorrect", err)
+	}
+	err = service.attempts.Reset(ctx, accountAttemptKey(result.Email))
+	if err != nil {
+		return user.User{}, fmt.Errorf("service: fail to reset sign in attempts %w", err)
+	}
+	return result, nil
+}
+
+func (service *ServiceImpl) changePassword(ctx context.Context, userId string, data changePasswordRequest) (schema.Response[accountResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationErrorDetail := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[accountResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationErrorDetail,
+			},
+		}, fmt.Errorf("service: input validation error %w", err)
+	}
+	_, err = service.confirmPassword(ctx, userId, data.CurrentPassword, data.remoteIP)
+	if err == nil {
+		var hashedPassword string
+		hashedPassword, err = service.passwords.Hash(data.Password)
+		if err != nil {
+			err = fmt.Errorf("service: fail generate hash from user password, %w", err)
+		} else {
+			err = service.Repository.changePassword(ctx, userId, hashedPassword, data.refreshToken, time.Now().Unix())
+		}
+	}
+	if err != nil {
+		var lockedOut *lockedOutError
+		if errors.As(err, &lockedOut) {
+			return lockoutResponse[accountResponse](err), err
+		}
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[accountResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[accountResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to change your password, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[accountResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: accountResponse{
+			Message: "your password has been changed, every other device and personal access token has been signed out",
+		},
+	}, nil
+}
+
+func (service *ServiceImpl) changeEmail(ctx context.Context, userId string, data changeEmailRequest) (schema.Response[accountResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationErrorDetail := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[accountResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationErrorDetail,
+			},
+		}, fmt.Errorf("service: input validation error %w", err)
+	}
+	result, err := service.confirmPassword(ctx, userId, data.Password, data.remoteIP)
+	if err == nil && strings.EqualFold(result.Email, data.Email) {
+		err = apperror.New(http.StatusBadRequest, "this is already your email", nil)
+	}
+	if err == nil {
+		err = service.Repository.changeEmail(ctx, userId, data.Email, time.Now().Unix())
+	}
+	if err != nil {
+		var lockedOut *lockedOutError
+		if errors.As(err, &lockedOut) {
+			return lockoutResponse[accountResponse](err), err
+		}
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[accountResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[accountResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to change your email, please try again later",
+			},
+		}, err
+	}
+
+	// the change is already saved, failing to mail only mean user has to ask for another link
+	err = service.sendVerificationEmail(ctx, userId, result.Fullname, data.Email)
+	if err != nil {
+		return schema.Response[accountResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "your email has been changed but we fail to send the verification email, please request another one",
+			},
+		}, err
+	}
+	// let the old address know, in case someone else did this
+	err = service.mailer.Send(ctx, mailer.Message{
+		To:      result.Email,
+		Subject: "Your Code Roast email address was changed",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nThe email address of your Code Roast account was changed to %s.\n\nIf you didn't do this, reset your password right away at %s/forgot-password.\n",
+			result.Fullname,
+			data.Email,
+			service.config.AppURL,
+		),
+	})
+	if err != nil {
+		return schema.Response[accountResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to change your email, please try again later",
+			},
+		}, fmt.Errorf("service: fail to send email change notice %w", err)
+	}
+	return schema.Response[accountResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: accountResponse{
+			Message: "your email has been changed, open the link we sent to verify it",
+		},
+	}, nil
+}
+
+func (service *ServiceImpl) deleteAccount(ctx context.Context, userId string, data deleteAccountRequest) (schema.Response[accountResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationErrorDetail := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[accountResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationErrorDetail,
+			},
+		}, fmt.Errorf("service: input validation error %w", err)
+	}
+	_, err = service.confirmPassword(ctx, userId, data.Password, data.remoteIP)
+	if err == nil {
+		err = service.Repository.deleteAccount(ctx, userId, service.config.accountDeletionPolicy(), time.Now().Unix())
+	}
+	if err != nil {
+		var lockedOut *lockedOutError
+		if errors.As(err, &lockedOut) {
+			return lockoutResponse[accountResponse](err), err
+		}
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[accountResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[accountResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to delete your account, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[accountResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: accountResponse{
+			Message: "your account has been deleted",
+		},
+	}, nil
+}
@@ -2,6 +2,8 @@ package auth
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"net/http"
@@ -13,6 +15,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	apperror "github.com/zulfikarrosadi/code_roast/internal/app-error"
+	"github.com/zulfikarrosadi/code_roast/internal/mailer"
 	"github.com/zulfikarrosadi/code_roast/internal/user"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -26,16 +29,202 @@ func (m *mockRepository) register(ctx context.Context, newUser user.User, auth a
 	return args.Get(0).(publicUserData), args.Error(1)
 }
 
-func (m *mockRepository) loginByEmail(ctx context.Context, email string, auth authentication) (user.User, error) {
-	args := m.Called(ctx, email, auth)
+func (m *mockRepository) loginByEmail(ctx context.Context, email string) (user.User, error) {
+	args := m.Called(ctx, email)
 	return args.Get(0).(user.User), args.Error(1)
 }
 
-func (m *mockRepository) findRefreshToken(ctx context.Context, token string) (publicUserData, error) {
-	args := m.Called(ctx, token)
+func (m *mockRepository) findUserById(ctx context.Context, userId string) (user.User, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(user.User), args.Error(1)
+}
+
+func (m *mockRepository) createAuthentication(ctx context.Context, auth authentication) error {
+	args := m.Called(ctx, auth)
+	return args.Error(0)
+}
+
+func (m *mockRepository) rotateRefreshToken(ctx context.Context, token string, next *authentication, idleCutoff int64) (publicUserData, error) {
+	args := m.Called(ctx, token, next, idleCutoff)
 	return args.Get(0).(publicUserData), args.Error(1)
 }
 
+func (m *mockRepository) revokeRefreshToken(ctx context.Context, token string) (int64, error) {
+	args := m.Called(ctx, token)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockRepository) revokeAllRefreshTokens(ctx context.Context, userId string) (int64, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockRepository) deleteExpiredSessions(ctx context.Context, now int64, idleCutoff int64) (int64, error) {
+	args := m.Called(ctx, now, idleCutoff)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockRepository) findSessions(ctx context.Context, userId string, now int64, idleCutoff int64) ([]authentication, error) {
+	args := m.Called(ctx, userId, now, idleCutoff)
+	return args.Get(0).([]authentication), args.Error(1)
+}
+
+func (m *mockRepository) revokeSession(ctx context.Context, userId string, familyId string) error {
+	args := m.Called(ctx, userId, familyId)
+	return args.Error(0)
+}
+
+func (m *mockRepository) createPasswordReset(ctx context.Context, email string, reset passwordReset) (user.User, error) {
+	args := m.Called(ctx, email, reset)
+	return args.Get(0).(user.User), args.Error(1)
+}
+
+func (m *mockRepository) findPasswordReset(ctx context.Context, tokenHash string, now int64) (user.User, error) {
+	args := m.Called(ctx, tokenHash, now)
+	return args.Get(0).(user.User), args.Error(1)
+}
+
+func (m *mockRepository) resetPassword(ctx context.Context, tokenHash string, hashedPassword string, now int64) error {
+	args := m.Called(ctx, tokenHash, hashedPassword, now)
+	return args.Error(0)
+}
+
+// generated once, rsa key generation is too slow to do for every test
+var testKeySet = func() *KeySet {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	key, err := NewSigningKey("test", private)
+	if err != nil {
+		panic(err)
+	}
+	keySet, err := NewKeySet("test", key)
+	if err != nil {
+		panic(err)
+	}
+	return keySet
+}()
+
+func newTestService(repo Repository) *ServiceImpl {
+	v := validator.New()
+	RegisterPasswordPolicy(v, PasswordPolicy{})
+	return &ServiceImpl{
+		Repository: repo,
+		v:          v,
+		mailer:     mailer.NewMemoryMailer(),
+		attempts:   NewMemoryAttemptStore(),
+		keys:       testKeySet,
+		passwords:  NewPasswordHasher(PasswordConfig{BcryptCost: bcrypt.MinCost}),
+		config:     Config{AppURL: "http://localhost"},
+	}
+}
+
+func (m *mockRepository) verifyEmail(ctx context.Context, userId string, email string, now int64) error {
+	args := m.Called(ctx, userId, email, now)
+	return args.Error(0)
+}
+
+func (m *mockRepository) markVerificationSent(ctx context.Context, userId string, now int64, cooldownCutoff int64) (user.User, error) {
+	args := m.Called(ctx, userId, now, cooldownCutoff)
+	return args.Get(0).(user.User), args.Error(1)
+}
+
+func (m *mockRepository) findTOTP(ctx context.Context, userId string) (totp, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(totp), args.Error(1)
+}
+
+func (m *mockRepository) useTOTPStep(ctx context.Context, userId string, step int64) error {
+	args := m.Called(ctx, userId, step)
+	return args.Error(0)
+}
+
+func (m *mockRepository) saveTOTPSecret(ctx context.Context, userId string, secret string) error {
+	args := m.Called(ctx, userId, secret)
+	return args.Error(0)
+}
+
+func (m *mockRepository) enableTOTP(ctx context.Context, userId string, now int64, codes []recoveryCode) error {
+	args := m.Called(ctx, userId, now, codes)
+	return args.Error(0)
+}
+
+func (m *mockRepository) disableTOTP(ctx context.Context, userId string) error {
+	args := m.Called(ctx, userId)
+	return args.Error(0)
+}
+
+func (m *mockRepository) findTokenVersion(ctx context.Context, userId string) (int64, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockRepository) findUserByIdentity(ctx context.Context, provider string, subject string) (user.User, error) {
+	args := m.Called(ctx, provider, subject)
+	return args.Get(0).(user.User), args.Error(1)
+}
+
+func (m *mockRepository) linkIdentity(ctx context.Context, email string, identity userIdentity) (user.User, error) {
+	args := m.Called(ctx, email, identity)
+	return args.Get(0).(user.User), args.Error(1)
+}
+
+func (m *mockRepository) createOAuthUser(ctx context.Context, newUser user.User, identity userIdentity) (user.User, error) {
+	args := m.Called(ctx, newUser, identity)
+	return args.Get(0).(user.User), args.Error(1)
+}
+
+func (m *mockRepository) createPersonalToken(ctx context.Context, token personalToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *mockRepository) findPersonalTokens(ctx context.Context, userId string) ([]personalToken, error) {
+	args := m.Called(ctx, userId)
+	return args.Get(0).([]personalToken), args.Error(1)
+}
+
+func (m *mockRepository) deletePersonalToken(ctx context.Context, userId string, tokenId string) error {
+	args := m.Called(ctx, userId, tokenId)
+	return args.Error(0)
+}
+
+func (m *mockRepository) findPersonalTokenOwner(ctx context.Context, tokenHash string, now int64) (personalToken, user.User, error) {
+	args := m.Called(ctx, tokenHash, now)
+	return args.Get(0).(personalToken), args.Get(1).(user.User), args.Error(2)
+}
+
+func (m *mockRepository) touchPersonalToken(ctx context.Context, tokenId string, now int64, usedCutoff int64) error {
+	args := m.Called(ctx, tokenId, now, usedCutoff)
+	return args.Error(0)
+}
+
+func (m *mockRepository) changePassword(ctx context.Context, userId string, hashedPassword string, keepRefreshToken string, now int64) error {
+	args := m.Called(ctx, userId, hashedPassword, keepRefreshToken, now)
+	return args.Error(0)
+}
+
+func (m *mockRepository) changeEmail(ctx context.Context, userId string, email string, now int64) error {
+	args := m.Called(ctx, userId, email, now)
+	return args.Error(0)
+}
+
+func (m *mockRepository) deleteAccount(ctx context.Context, userId string, policy string, now int64) error {
+	args := m.Called(ctx, userId, policy, now)
+	return args.Error(0)
+}
+
+func (m *mockRepository) updatePasswordHash(ctx context.Context, userId string, oldHash string, newHash string) error {
+	args := m.Called(ctx, userId, oldHash, newHash)
+	return args.Error(0)
+}
+
+func (m *mockRepository) useRecoveryCode(ctx context.Context, userId string, codeHash string, now int64) error {
+	args := m.Called(ctx, userId, codeHash, now)
+	return args.Error(0)
+}
+
 func TestServiceImpl_register(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -51,8 +240,8 @@ func TestServiceImpl_register(t *testing.T) {
 			request: registrationRequest{
 				Fullname:             "Test User",
 				Email:                "test@example.com",
-				Password:             "password123",
-				PasswordConfirmation: "password123",
+				Password:             "roast-Kettle-42",
+				PasswordConfirmation: "roast-Kettle-42",
 				Agent:                "Mozilla",
 				RemoteIp:             "127.0.0.1",
 			},
@@ -86,8 +275,8 @@ func TestServiceImpl_register(t *testing.T) {
 			request: registrationRequest{
 				Fullname:             "Test User",
 				Email:                "test@example.com",
-				Password:             "password123",
-				PasswordConfirmation: "password123",
+				Password:             "roast-Kettle-42",
+				PasswordConfirmation: "roast-Kettle-42",
 				Agent:                "Mozilla",
 				RemoteIp:             "127.0.0.1",
 			},
@@ -102,8 +291,7 @@ func TestServiceImpl_register(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo := new(mockRepository)
-			validator := validator.New()
-			service := &ServiceImpl{Repository: mockRepo, v: validator}
+			service := newTestService(mockRepo)
 
 			mockRepo.On("register", mock.Anything, mock.Anything, mock.Anything).Return(tt.repoResponse, tt.repoError)
 
@@ -135,6 +323,7 @@ func TestServiceImpl_loginByEmail(t *testing.T) {
 		expectSuccess bool
 		expectStatus  string
 		expectCode    int
+		expectSession bool
 	}{
 		{
 			name: "Successful login",
@@ -157,6 +346,29 @@ func TestServiceImpl_loginByEmail(t *testing.T) {
 			expectSuccess: true,
 			expectStatus:  "success",
 			expectCode:    http.StatusOK,
+			expectSession: true,
+		},
+		{
+			name: "Two-factor enabled",
+			request: loginRequest{
+				Email:    "test@example.com",
+				Password: "password123",
+				authentication: authentication{
+					remoteIP:  "127.0.0.1",
+					lastLogin: time.Now().Unix(),
+				},
+			},
+			repoResponse: user.User{
+				Id:               "user-id",
+				Fullname:         "Test User",
+				Email:            "test@example.com",
+				Password:         string(hashedPassword),
+				TwoFactorEnabled: true,
+			},
+			repoError:     nil,
+			expectSuccess: true,
+			expectStatus:  "success",
+			expectCode:    http.StatusAccepted,
 		},
 		{
 			name: "Password compare failed",
@@ -216,23 +428,38 @@ func TestServiceImpl_loginByEmail(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo := new(mockRepository)
-			validator := validator.New()
-			service := &ServiceImpl{Repository: mockRepo, v: validator}
+			service := newTestService(mockRepo)
 
 			if tt.name == "User not found" {
-				mockRepo.On("loginByEmail", context.Background(), "non-existent user", mock.Anything).Return(tt.repoResponse, tt.repoError)
+				mockRepo.On("loginByEmail", context.Background(), "non-existent user").Return(tt.repoResponse, tt.repoError)
 			} else {
-				mockRepo.On("loginByEmail", context.Background(), "test@example.com", mock.Anything).Return(tt.repoResponse, tt.repoError)
+				mockRepo.On("loginByEmail", context.Background(), "test@example.com").Return(tt.repoResponse, tt.repoError)
+			}
+			if tt.expectSession {
+				mockRepo.On("createAuthentication", context.Background(), mock.MatchedBy(func(a authentication) bool {
+					return a.userId == tt.repoResponse.Id && a.familyId == a.id && !a.twoFactor
+				})).Return(nil)
 			}
 
 			resp, err := service.login(context.Background(), tt.request)
-			if tt.expectSuccess {
+			if tt.expectSuccess && tt.expectSession {
 				require.NoError(t, err)
 				assert.Equal(t, tt.expectStatus, resp.Status)
 				assert.Equal(t, tt.expectCode, resp.Code)
 				assert.Equal(t, tt.repoResponse.Id, resp.Data.User.ID)
 				assert.Equal(t, tt.repoResponse.Email, resp.Data.User.Email)
 				assert.Equal(t, tt.repoResponse.Fullname, resp.Data.User.Fullname)
+				assert.NotEmpty(t, resp.Data.RefreshToken)
+			} else if tt.expectSuccess {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectCode, resp.Code)
+				assert.True(t, resp.Data.TwoFactorRequired)
+				assert.Empty(t, resp.Data.AccessToken)
+				assert.Empty(t, resp.Data.RefreshToken)
+
+				claims, err := service.parsePurposeToken(resp.Data.ChallengeToken, TOKEN_PURPOSE_TWO_FACTOR)
+				require.NoError(t, err)
+				assert.Equal(t, tt.repoResponse.Id, claims.Subject)
 			} else {
 				assert.Error(t, err)
 				assert.Equal(t, tt.expectStatus, resp.Status)
@@ -241,3 +468,694 @@ func TestServiceImpl_loginByEmail(t *testing.T) {
 		})
 	}
 }
+
+func TestServiceImpl_loginLockout(t *testing.T) {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), 10)
+	mockRepo := new(mockRepository)
+	service := newTestService(mockRepo)
+	service.config.Lockout = LockoutConfig{MaxAccountAttempts: 2, BaseLockout: time.Minute}
+	mockRepo.On("loginByEmail", context.Background(), "test@example.com").Return(user.User{
+		Id:       "user-id",
+		Email:    "test@example.com",
+		Password: string(hashedPassword),
+	}, nil)
+
+	wrongPassword := loginRequest{
+		Email:          "test@example.com",
+		Password:       "wrong password",
+		authentication: authentication{remoteIP: "127.0.0.1"},
+	}
+	for i := 0; i < 2; i++ {
+		resp, err := service.login(context.Background(), wrongPassword)
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	}
+
+	// even the correct password is rejected while locked, without touching the repository
+	resp, err := service.login(context.Background(), loginRequest{
+		Email:          "TEST@example.com",
+		Password:       "password123",
+		authentication: authentication{remoteIP: "127.0.0.1"},
+	})
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	var lockedOut *lockedOutError
+	require.ErrorAs(t, err, &lockedOut)
+	assert.Equal(t, int64(60), lockedOut.retryAfterSeconds())
+	mockRepo.AssertNumberOfCalls(t, "loginByEmail", 2)
+
+	unlockResp, err := service.unlock(context.Background(), unlockRequest{Email: "test@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, unlockResp.Code)
+
+	mockRepo.On("createAuthentication", context.Background(), mock.Anything).Return(nil)
+	resp, err = service.login(context.Background(), loginRequest{
+		Email:          "test@example.com",
+		Password:       "password123",
+		authentication: authentication{remoteIP: "127.0.0.1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestServiceImpl_loginTwoFactor(t *testing.T) {
+	secret, err := generateTOTPSecret()
+	require.NoError(t, err)
+	code, err := totpCode(secret, time.Now())
+	require.NoError(t, err)
+	challengeToken, err := newTestService(nil).signPurposeToken(TOKEN_PURPOSE_TWO_FACTOR, "user-id", "", TWO_FACTOR_CHALLENGE_LIFETIME)
+	require.NoError(t, err)
+	verificationToken, err := newTestService(nil).signPurposeToken(TOKEN_PURPOSE_EMAIL_VERIFICATION, "user-id", "test@example.com", time.Minute)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		request    twoFactorLoginRequest
+		mockRepo   func(*mockRepository)
+		expectCode int
+	}{
+		{
+			name:    "Valid totp code",
+			request: twoFactorLoginRequest{ChallengeToken: challengeToken, Code: code},
+			mockRepo: func(m *mockRepository) {
+				m.On("findTOTP", context.Background(), "user-id").Return(totp{secret: secret, enabled: true}, nil)
+				m.On("useTOTPStep", context.Background(), "user-id", mock.Anything).Return(nil)
+				m.On("findUserById", context.Background(), "user-id").Return(user.User{Id: "user-id", Email: "test@example.com"}, nil)
+				m.On("createAuthentication", context.Background(), mock.MatchedBy(func(a authentication) bool {
+					return a.userId == "user-id" && a.twoFactor
+				})).Return(nil)
+			},
+			expectCode: http.StatusOK,
+		},
+		{
+			name:    "Replayed totp code",
+			request: twoFactorLoginRequest{ChallengeToken: challengeToken, Code: code},
+			mockRepo: func(m *mockRepository) {
+				m.On("findTOTP", context.Background(), "user-id").Return(totp{secret: secret, enabled: true}, nil)
+				m.On("useTOTPStep", context.Background(), "user-id", mock.Anything).Return(
+					apperror.New(http.StatusBadRequest, "two-factor code has already been used, wait for the next one", nil),
+				)
+			},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:    "Code older than the last accepted one",
+			request: twoFactorLoginRequest{ChallengeToken: challengeToken, Code: code},
+			mockRepo: func(m *mockRepository) {
+				m.On("findTOTP", context.Background(), "user-id").Return(totp{secret: secret, enabled: true, lastStep: time.Now().Unix()/TOTP_PERIOD + TOTP_SKEW}, nil)
+			},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:    "Valid recovery code",
+			request: twoFactorLoginRequest{ChallengeToken: challengeToken, RecoveryCode: " ABCD-EFGH "},
+			mockRepo: func(m *mockRepository) {
+				m.On("findTOTP", context.Background(), "user-id").Return(totp{secret: secret, enabled: true}, nil)
+				m.On("useRecoveryCode", context.Background(), "user-id", hashToken("abcd-efgh"), mock.Anything).Return(nil)
+				m.On("findUserById", context.Background(), "user-id").Return(user.User{Id: "user-id", Email: "test@example.com"}, nil)
+				m.On("createAuthentication", context.Background(), mock.Anything).Return(nil)
+			},
+			expectCode: http.StatusOK,
+		},
+		{
+			name:    "Wrong totp code",
+			request: twoFactorLoginRequest{ChallengeToken: challengeToken, Code: "000000"},
+			mockRepo: func(m *mockRepository) {
+				m.On("findTOTP", context.Background(), "user-id").Return(totp{secret: secret, enabled: true}, nil)
+			},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Token minted for another purpose",
+			request:    twoFactorLoginRequest{ChallengeToken: verificationToken, Code: code},
+			mockRepo:   func(m *mockRepository) {},
+			expectCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "Missing code",
+			request:    twoFactorLoginRequest{ChallengeToken: challengeToken},
+			mockRepo:   func(m *mockRepository) {},
+			expectCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(mockRepository)
+			tt.mockRepo(mockRepo)
+			service := newTestService(mockRepo)
+
+			resp, err := service.loginTwoFactor(context.Background(), tt.request)
+			assert.Equal(t, tt.expectCode, resp.Code)
+			if tt.expectCode == http.StatusOK {
+				require.NoError(t, err)
+				assert.NotEmpty(t, resp.Data.AccessToken)
+				assert.NotEmpty(t, resp.Data.RefreshToken)
+			} else {
+				assert.Error(t, err)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestServiceImpl_CheckTokenVersion(t *testing.T) {
+	mockRepo := new(mockRepository)
+	service := newTestService(mockRepo)
+	mockRepo.On("findTokenVersion", context.Background(), "user-id").Return(int64(3), nil)
+
+	assert.NoError(t, service.CheckTokenVersion(context.Background(), &CustomJWTClaims{Id: "user-id", TokenVersion: 3}))
+	assert.ErrorIs(t, service.CheckTokenVersion(context.Background(), &CustomJWTClaims{Id: "user-id", TokenVersion: 2}), ErrStaleToken)
+}
+
+func TestServiceImpl_signoutAll(t *testing.T) {
+	tests := []struct {
+		name         string
+		userId       string
+		repoResponse int64
+		repoError    error
+		expectStatus string
+		expectCode   int
+	}{
+		{
+			name:         "Successful signout from all devices",
+			userId:       "user-id",
+			repoResponse: 3,
+			repoError:    nil,
+			expectStatus: "success",
+			expectCode:   http.StatusOK,
+		},
+		{
+			name:         "Repository error",
+			userId:       "user-id",
+			repoResponse: 0,
+			repoError:    errors.New("database error"),
+			expectStatus: "fail",
+			expectCode:   http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(mockRepository)
+			service := newTestService(mockRepo)
+
+			mockRepo.On("revokeAllRefreshTokens", context.Background(), tt.userId).Return(tt.repoResponse, tt.repoError)
+
+			resp, err := service.signoutAll(context.Background(), tt.userId)
+			if tt.repoError != nil {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.repoResponse, resp.Data.RevokedSessions)
+			}
+			assert.Equal(t, tt.expectStatus, resp.Status)
+			assert.Equal(t, tt.expectCode, resp.Code)
+		})
+	}
+}
+
+func TestServiceImpl_refreshToken(t *testing.T) {
+	tests := []struct {
+		name         string
+		token        string
+		repoResponse publicUserData
+		repoError    error
+		// set by the repository when a concurrent refresh already rotated the token
+		successor    string
+		expectStatus string
+		expectCode   int
+	}{
+		{
+			name:  "Successful rotation",
+			token: "old-refresh-token",
+			repoResponse: publicUserData{
+				id:       "user-id",
+				email:    "test@example.com",
+				fullname: "Test User",
+				roles:    []user.Roles{},
+			},
+			repoError:    nil,
+			expectStatus: "success",
+			expectCode:   http.StatusOK,
+		},
+		{
+			name:         "Token rotated by a concurrent refresh",
+			token:        "old-refresh-token",
+			repoResponse: publicUserData{id: "user-id", roles: []user.Roles{}},
+			successor:    "successor-refresh-token",
+			expectStatus: "success",
+			expectCode:   http.StatusOK,
+		},
+		{
+			name:         "Rotated token reused",
+			token:        "old-refresh-token",
+			repoResponse: publicUserData{},
+			repoError:    apperror.New(http.StatusUnauthorized, "refresh token is no longer valid, please sign in again", nil),
+			expectStatus: "fail",
+			expectCode:   http.StatusUnauthorized,
+		},
+		{
+			name:         "Repository error",
+			token:        "old-refresh-token",
+			repoResponse: publicUserData{},
+			repoError:    errors.New("database error"),
+			expectStatus: "fail",
+			expectCode:   http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(mockRepository)
+			service := newTestService(mockRepo)
+
+			mockRepo.On("rotateRefreshToken", context.Background(), tt.token, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				if tt.successor != "" {
+					args.Get(2).(*authentication).refreshToken = tt.successor
+				}
+			}).Return(tt.repoResponse, tt.repoError)
+
+			resp, err := service.refreshToken(context.Background(), refreshTokenRequest{
+				token:    tt.token,
+				remoteIP: "127.0.0.1",
+				agent:    "Mozilla",
+			})
+			if tt.repoError != nil {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.NotEqual(t, tt.token, resp.Data.RefreshToken)
+				if tt.successor != "" {
+					assert.Equal(t, tt.successor, resp.Data.RefreshToken)
+				}
+				assert.Equal(t, tt.repoResponse.id, resp.Data.User.ID)
+			}
+			assert.Equal(t, tt.expectStatus, resp.Status)
+			assert.Equal(t, tt.expectCode, resp.Code)
+		})
+	}
+}
+
+func TestServiceImpl_listSessions(t *testing.T) {
+	mockRepo := new(mockRepository)
+	service := newTestService(mockRepo)
+
+	mockRepo.On("findSessions", context.Background(), "user-id", mock.Anything, mock.Anything).Return([]authentication{
+		{familyId: "family-1", refreshToken: "token-1", remoteIP: "127.0.0.1", agent: "Mozilla"},
+		{familyId: "family-2", refreshToken: "token-2", remoteIP: "10.0.0.1", agent: "curl"},
+	}, nil)
+
+	resp, err := service.listSessions(context.Background(), "user-id", "token-2")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	require.Len(t, resp.Data.Sessions, 2)
+	assert.Equal(t, "family-1", resp.Data.Sessions[0].Id)
+	assert.False(t, resp.Data.Sessions[0].Current)
+	assert.True(t, resp.Data.Sessions[1].Current)
+}
+
+func TestServiceImpl_forgotPassword(t *testing.T) {
+	tests := []struct {
+		name         string
+		email        string
+		repoResponse user.User
+		repoError    error
+		mailError    error
+		expectStatus string
+		expectCode   int
+		expectMails  int
+	}{
+		{
+			name:  "Reset link sent",
+			email: "test@example.com",
+			repoResponse: user.User{
+				Id:       "user-id",
+				Fullname: "Test User",
+				Email:    "test@example.com",
+			},
+			repoError:    nil,
+			expectStatus: "success",
+			expectCode:   http.StatusOK,
+			expectMails:  1,
+		},
+		{
+			name:         "Unregistered email looks the same",
+			email:        "nobody@example.com",
+			repoResponse: user.User{},
+			repoError:    apperror.New(http.StatusNotFound, "user not found", nil),
+			expectStatus: "success",
+			expectCode:   http.StatusOK,
+			expectMails:  0,
+		},
+		{
+			name:  "Undelivered email looks the same",
+			email: "test@example.com",
+			repoResponse: user.User{
+				Id:       "user-id",
+				Fullname: "Test User",
+				Email:    "test@example.com",
+			},
+			mailError:    errors.New("smtp: connection refused"),
+			expectStatus: "success",
+			expectCode:   http.StatusOK,
+			expectMails:  0,
+		},
+		{
+			name:         "Validation error",
+			email:        "invalid-email",
+			expectStatus: "fail",
+			expectCode:   http.StatusBadRequest,
+			expectMails:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(mockRepository)
+			memoryMailer := mailer.NewMemoryMailer()
+			service := &ServiceImpl{Repository: mockRepo, v: validator.New(), mailer: memoryMailer, attempts: NewMemoryAttemptStore(), config: Config{AppURL: "http://localhost"}}
+			if tt.mailError != nil {
+				service.mailer = failingMailer{err: tt.mailError}
+			}
+
+			mockRepo.On("createPasswordReset", context.Background(), tt.email, mock.Anything).Return(tt.repoResponse, tt.repoError)
+
+			resp, _ := service.forgotPassword(context.Background(), forgotPasswordRequest{Email: tt.email})
+			assert.Equal(t, tt.expectStatus, resp.Status)
+			assert.Equal(t, tt.expectCode, resp.Code)
+
+			mails := memoryMailer.Messages()
+			require.Len(t, mails, tt.expectMails)
+			if tt.expectMails > 0 {
+				reset := mockRepo.Calls[0].Arguments.Get(2).(passwordReset)
+				assert.Equal(t, tt.email, mails[0].To)
+				// only the hash is stored, the raw token only travel inside the email
+				assert.NotContains(t, mails[0].Body, reset.tokenHash)
+				assert.Contains(t, mails[0].Body, "http://localhost/reset-password?token=")
+			}
+		})
+	}
+}
+
+// failingMailer never deliver
+type failingMailer struct {
+	err error
+}
+
+func (m failingMailer) Send(ctx context.Context, message mailer.Message) error {
+	return m.err
+}
+
+func TestServiceImpl_forgotPasswordLimit(t *testing.T) {
+	notFound := apperror.New(http.StatusNotFound, "user not found", nil)
+	mockRepo := new(mockRepository)
+	mockRepo.On("createPasswordReset", context.Background(), mock.Anything, mock.Anything).Return(user.User{}, notFound)
+	service := newTestService(mockRepo)
+	service.config.PasswordResetMaxPerEmail = 2
+	service.config.PasswordResetMaxPerIP = 3
+
+	// unregistered email is limited the same as a registered one
+	for i := 0; i < 2; i++ {
+		resp, err := service.forgotPassword(context.Background(), forgotPasswordRequest{Email: "nobody@example.com", remoteIP: "127.0.0.1"})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+	resp, err := service.forgotPassword(context.Background(), forgotPasswordRequest{Email: "nobody@example.com", remoteIP: "127.0.0.2"})
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	var lockedOut *lockedOutError
+	require.ErrorAs(t, err, &lockedOut)
+	assert.Equal(t, DEFAULT_PASSWORD_RESET_WINDOW, lockedOut.retryAfter)
+
+	// third request of the ip, the fourth is refused whatever the email
+	resp, err = service.forgotPassword(context.Background(), forgotPasswordRequest{Email: "other@example.com", remoteIP: "127.0.0.1"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resp, _ = service.forgotPassword(context.Background(), forgotPasswordRequest{Email: "another@example.com", remoteIP: "127.0.0.1"})
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+}
+
+func TestServiceImpl_verifyEmail(t *testing.T) {
+	validToken, err := newTestService(nil).signPurposeToken(TOKEN_PURPOSE_EMAIL_VERIFICATION, "user-id", "test@example.com", time.Hour)
+	require.NoError(t, err)
+	expiredToken, err := newTestService(nil).signPurposeToken(TOKEN_PURPOSE_EMAIL_VERIFICATION, "user-id", "test@example.com", -time.Hour)
+	require.NoError(t, err)
+	wrongPurposeToken, err := newTestService(nil).signPurposeToken("something_else", "user-id", "test@example.com", time.Hour)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		token        string
+		expectRepo   bool
+		expectStatus string
+		expectCode   int
+	}{
+		{
+			name:         "Successful verification",
+			token:        validToken,
+			expectRepo:   true,
+			expectStatus: "success",
+			expectCode:   http.StatusOK,
+		},
+		{
+			name:         "Expired link",
+			token:        expiredToken,
+			expectStatus: "fail",
+			expectCode:   http.StatusBadRequest,
+		},
+		{
+			name:         "Token minted for other purpose",
+			token:        wrongPurposeToken,
+			expectStatus: "fail",
+			expectCode:   http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(mockRepository)
+			service := newTestService(mockRepo)
+
+			mockRepo.On("verifyEmail", context.Background(), "user-id", "test@example.com", mock.Anything).Return(nil)
+
+			resp, _ := service.verifyEmail(context.Background(), verifyEmailRequest{Token: tt.token})
+			assert.Equal(t, tt.expectStatus, resp.Status)
+			assert.Equal(t, tt.expectCode, resp.Code)
+			if tt.expectRepo {
+				mockRepo.AssertCalled(t, "verifyEmail", context.Background(), "user-id", "test@example.com", mock.Anything)
+			} else {
+				mockRepo.AssertNotCalled(t, "verifyEmail", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestServiceImpl_createPersonalToken(t *testing.T) {
+	owner := user.User{
+		Id:    "user-id",
+		Email: "test@example.com",
+		Roles: []user.Roles{{Id: user.ROLE_ID_CREATE_SUBFORUM}},
+	}
+	caller := &CustomJWTClaims{Id: "user-id", Roles: owner.Roles}
+	tests := []struct {
+		name       string
+		caller     *CustomJWTClaims
+		request    personalTokenRequest
+		expectCode int
+	}{
+		{
+			name:       "Token scoped to held role",
+			caller:     caller,
+			request:    personalTokenRequest{Name: "ci", RoleIds: []int{user.ROLE_ID_CREATE_SUBFORUM}, ExpiresInDays: 30},
+			expectCode: http.StatusCreated,
+		},
+		{
+			name:       "Token scoped to role the user doesn't hold",
+			caller:     caller,
+			request:    personalTokenRequest{Name: "ci", RoleIds: []int{user.ROLE_ID_MANAGE_USERS}},
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:       "Token scoped to role missing from the caller claims",
+			caller:     &CustomJWTClaims{Id: "user-id"},
+			request:    personalTokenRequest{Name: "ci", RoleIds: []int{user.ROLE_ID_CREATE_SUBFORUM}},
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:       "Caller is a personal access token",
+			caller:     &CustomJWTClaims{Id: "user-id", Roles: owner.Roles, PersonalToken: true},
+			request:    personalTokenRequest{Name: "ci", RoleIds: []int{user.ROLE_ID_CREATE_SUBFORUM}},
+			expectCode: http.StatusForbidden,
+		},
+		{
+			name:       "Missing name",
+			caller:     caller,
+			request:    personalTokenRequest{},
+			expectCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(mockRepository)
+			service := newTestService(mockRepo)
+
+			mockRepo.On("findUserById", context.Background(), "user-id").Return(owner, nil)
+			mockRepo.On("createPersonalToken", context.Background(), mock.Anything).Return(nil)
+
+			resp, _ := service.createPersonalToken(context.Background(), tt.caller, tt.request)
+			assert.Equal(t, tt.expectCode, resp.Code)
+			if tt.expectCode != http.StatusCreated {
+				mockRepo.AssertNotCalled(t, "createPersonalToken", mock.Anything, mock.Anything)
+				return
+			}
+			token := resp.Data.Token.Token
+			assert.True(t, IsPersonalToken(token))
+			// only the hash is stored, the token itself is shown once
+			mockRepo.AssertCalled(t, "createPersonalToken", context.Background(), mock.MatchedBy(func(pt personalToken) bool {
+				return pt.tokenHash == hashToken(token) && pt.tokenHash != token && pt.expiresAt > 0
+			}))
+		})
+	}
+}
+
+func TestServiceImpl_AuthenticatePersonalToken(t *testing.T) {
+	mockRepo := new(mockRepository)
+	service := newTestService(mockRepo)
+
+	token := PERSONAL_TOKEN_PREFIX + "secret"
+	mockRepo.On("findPersonalTokenOwner", context.Background(), hashToken(token), mock.Anything).Return(
+		personalToken{id: "token-id"},
+		user.User{Id: "user-id", TokenVersion: 3, Roles: []user.Roles{{Id: user.ROLE_ID_CREATE_SUBFORUM}}},
+		nil,
+	)
+	mockRepo.On("touchPersonalToken", context.Background(), "token-id", mock.Anything, mock.Anything).Return(nil)
+
+	claims, err := service.AuthenticatePersonalToken(context.Background(), token)
+	require.NoError(t, err)
+	assert.Equal(t, "user-id", claims.Id)
+	assert.Equal(t, int64(3), claims.TokenVersion)
+	assert.False(t, claims.TwoFactor)
+	assert.True(t, claims.PersonalToken)
+	require.Len(t, claims.Roles, 1)
+
+	mockRepo.On("findPersonalTokenOwner", context.Background(), hashToken("crpat_revoked"), mock.Anything).Return(
+		personalToken{}, user.User{}, apperror.New(http.StatusUnauthorized, "invalid or revoked personal access token", errors.New("not found")),
+	)
+	_, err = service.AuthenticatePersonalToken(context.Background(), "crpat_revoked")
+	assert.Error(t, err)
+}
+
+func TestServiceImpl_changePassword(t *testing.T) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("old-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	owner := user.User{Id: "user-id", Email: "test@example.com", Password: string(hashedPassword)}
+
+	tests := []struct {
+		name       string
+		request    changePasswordRequest
+		lockIP     bool
+		expectCode int
+	}{
+		{
+			name:       "Correct current password",
+			request:    changePasswordRequest{CurrentPassword: "old-password", Password: "new-password", PasswordConfirmation: "new-password", refreshToken: "token-1"},
+			expectCode: http.StatusOK,
+		},
+		{
+			name:       "Wrong current password",
+			request:    changePasswordRequest{CurrentPassword: "guess", Password: "new-password", PasswordConfirmation: "new-password"},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Confirmation mismatch",
+			request:    changePasswordRequest{CurrentPassword: "old-password", Password: "new-password", PasswordConfirmation: "typo"},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Current password guessed too often",
+			request:    changePasswordRequest{CurrentPassword: "old-password", Password: "new-password", PasswordConfirmation: "new-password", remoteIP: "203.0.113.7"},
+			lockIP:     true,
+			expectCode: http.StatusTooManyRequests,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(mockRepository)
+			service := newTestService(mockRepo)
+
+			mockRepo.On("findUserById", context.Background(), "user-id").Return(owner, nil)
+			mockRepo.On("changePassword", context.Background(), "user-id", mock.Anything, "token-1", mock.Anything).Return(nil)
+			if tt.lockIP {
+				require.NoError(t, service.attempts.Lock(context.Background(), ipAttemptKey(tt.request.remoteIP), time.Now().Add(time.Minute)))
+			}
+
+			resp, _ := service.changePassword(context.Background(), "user-id", tt.request)
+			assert.Equal(t, tt.expectCode, resp.Code)
+			if tt.expectCode == http.StatusOK {
+				mockRepo.AssertCalled(t, "changePassword", context.Background(), "user-id", mock.MatchedBy(func(hash string) bool {
+					return bcrypt.CompareHashAndPassword([]byte(hash), []byte("new-password")) == nil
+				}), "token-1", mock.Anything)
+			} else {
+				mockRepo.AssertNotCalled(t, "changePassword", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestServiceImpl_deleteAccount(t *testing.T) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		policy       string
+		expectPolicy string
+	}{
+		{
+			name:         "Anonymize by default",
+			policy:       "",
+			expectPolicy: ACCOUNT_DELETION_ANONYMIZE,
+		},
+		{
+			name:         "Hard delete when configured",
+			policy:       ACCOUNT_DELETION_HARD_DELETE,
+			expectPolicy: ACCOUNT_DELETION_HARD_DELETE,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(mockRepository)
+			service := newTestService(mockRepo)
+			service.config.AccountDeletionPolicy = tt.policy
+
+			mockRepo.On("findUserById", context.Background(), "user-id").Return(user.User{Id: "user-id", Password: string(hashedPassword)}, nil)
+			mockRepo.On("deleteAccount", context.Background(), "user-id", tt.expectPolicy, mock.Anything).Return(nil)
+
+			resp, err := service.deleteAccount(context.Background(), "user-id", deleteAccountRequest{Password: "password"})
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.Code)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestServiceImpl_loginRehash(t *testing.T) {
+	mockRepo := new(mockRepository)
+	service := newTestService(mockRepo)
+	service.passwords = NewPasswordHasher(testArgon2Config)
+
+	oldHash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	require.NoError(t, err)
+	mockRepo.On("loginByEmail", context.Background(), "test@example.com").Return(user.User{
+		Id:       "user-id",
+		Email:    "test@example.com",
+		Password: string(oldHash),
+	}, nil)
+	mockRepo.On("updatePasswordHash", context.Background(), "user-id", string(oldHash), mock.MatchedBy(func(hash string) bool {
+		return service.passwords.Verify(hash, "password123") == nil && !service.passwords.NeedsRehash(hash)
+	})).Return(nil)
+	mockRepo.On("createAuthentication", context.Background(), mock.Anything).Return(nil)
+
+	resp, err := service.login(context.Background(), loginRequest{
+		Email:          "test@example.com",
+		Password:       "password123",
+		authentication: authentication{remoteIP: "127.0.0.1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	DEFAULT_SESSION_ABSOLUTE_LIFETIME = time.Hour * 24 * 30
+	DEFAULT_SESSION_IDLE_LIFETIME     = time.Hour * 24 * 7
+	DEFAULT_SESSION_SWEEP_INTERVAL    = time.Hour
+	// tabs of the same browser refreshing at once all present the same token, the ones that lose
+	// the race get the token the winner was given instead of revoking the family for reuse
+	REFRESH_TOKEN_REUSE_GRACE = time.Second * 10
+
+	// size of authentication.agent
+	MAX_SESSION_AGENT_LENGTH = 255
+)
+
+// SessionConfig control how long a row in authentication table is honored.
+// absolute lifetime is counted from the first sign in of the token family and survive rotation,
+// idle lifetime is counted from the last time the session is refreshed
+type SessionConfig struct {
+	AbsoluteLifetime time.Duration
+	IdleLifetime     time.Duration
+	SweepInterval    time.Duration
+}
+
+func (config SessionConfig) absoluteLifetime() time.Duration {
+	if config.AbsoluteLifetime <= 0 {
+		return DEFAULT_SESSION_ABSOLUTE_LIFETIME
+	}
+	return config.AbsoluteLifetime
+}
+
+func (config SessionConfig) idleLifetime() time.Duration {
+	if config.IdleLifetime <= 0 {
+		return DEFAULT_SESSION_IDLE_LIFETIME
+	}
+	return config.IdleLifetime
+}
+
+func (config SessionConfig) sweepInterval() time.Duration {
+	if config.SweepInterval <= 0 {
+		return DEFAULT_SESSION_SWEEP_INTERVAL
+	}
+	return config.SweepInterval
+}
+
+// sessionRemoteIP is what is stored as the address of a session. without its zone an address always fit
+// authentication.remote_ip, anything that isn't an ip address is stored empty instead of failing the sign in
+func sessionRemoteIP(remoteIP string) string {
+	addr, err := netip.ParseAddr(remoteIP)
+	if err != nil {
+		return ""
+	}
+	return addr.WithZone("").String()
+}
+
+// sessionAgent cut user agent longer than the column, without splitting a character in half
+func sessionAgent(agent string) string {
+	if len(agent) <= MAX_SESSION_AGENT_LENGTH {
+		return agent
+	}
+	cut := MAX_SESSION_AGENT_LENGTH
+	for cut > 0 && !utf8.RuneStart(agent[cut]) {
+		cut--
+	}
+	return agent[:cut]
+}
+
+// sessions last refreshed before this unix time are considered idle
+func (config SessionConfig) idleCutoff(now time.Time) int64 {
+	return now.Add(-config.idleLifetime()).Unix()
+}
+
+type SessionSweeper struct {
+	*slog.Logger
+	repo   Repository
+	config SessionConfig
+}
+
+func NewSessionSweeper(logger *slog.Logger, repo Repository, config SessionConfig) *SessionSweeper {
+	return &SessionSweeper{
+		Logger: logger,
+		repo:   repo,
+		config: config,
+	}
+}
+
+// Run periodically purge expired sessions until ctx is canceled, call it in its own goroutine
+func (sweeper *SessionSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(sweeper.config.sweepInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sweeper.sweep(ctx)
+		}
+	}
+}
+
+func (sweeper *SessionSweeper) sweep(ctx context.Context) {
+	now := time.Now()
+	deleted, err := sweeper.repo.deleteExpiredSessions(ctx, now.Unix(), sweeper.config.idleCutoff(now))
+	if err != nil {
+		sweeper.Logger.LogAttrs(ctx, slog.LevelError, "SESSION_SWEEP_ERROR",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	sweeper.Logger.LogAttrs(ctx, slog.LevelInfo, "SESSION_SWEEP",
+		slog.Int64("deleted", deleted),
+	)
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionRemoteIP(t *testing.T) {
+	tests := []struct {
+		remoteIP string
+		expected string
+	}{
+		{remoteIP: "203.0.113.7", expected: "203.0.113.7"},
+		{remoteIP: "2001:db8::1", expected: "2001:db8::1"},
+		{remoteIP: "fe80::1%eth0", expected: "fe80::1"},
+		{remoteIP: "::ffff:192.0.2.1", expected: "::ffff:192.0.2.1"},
+		{remoteIP: "", expected: ""},
+		{remoteIP: "203.0.113.7, 10.0.0.1", expected: ""},
+		{remoteIP: strings.Repeat("a", 100), expected: ""},
+	}
+	for _, tt := range tests {
+		result := sessionRemoteIP(tt.remoteIP)
+		assert.Equal(t, tt.expected, result, tt.remoteIP)
+		assert.LessOrEqual(t, len(result), 45)
+	}
+}
+
+func TestSessionAgent(t *testing.T) {
+	tests := []struct {
+		name     string
+		agent    string
+		expected string
+	}{
+		{name: "Short agent is kept", agent: "Mozilla/5.0", expected: "Mozilla/5.0"},
+		{name: "Long agent is cut", agent: strings.Repeat("a", 300), expected: strings.Repeat("a", MAX_SESSION_AGENT_LENGTH)},
+		{name: "Character across the cut is dropped whole", agent: strings.Repeat("a", 254) + "é" + "tail", expected: strings.Repeat("a", 254)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, sessionAgent(tt.agent))
+		})
+	}
+}
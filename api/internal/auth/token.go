@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	TOKEN_PURPOSE_EMAIL_VERIFICATION = "email_verification"
+	TOKEN_PURPOSE_TWO_FACTOR         = "two_factor"
+
+	// user has this long to enter the code after the password is accepted
+	TWO_FACTOR_CHALLENGE_LIFETIME = time.Minute * 5
+
+	// prefix make personal access token easy to tell apart from jwt and easy to find by secret scanners
+	PERSONAL_TOKEN_PREFIX = "crpat_"
+	// last used timestamp of personal token is updated at most once per this interval
+	PERSONAL_TOKEN_TOUCH_INTERVAL = time.Minute
+	// account, session and token management need a real sign in, a leaked token must not take the account over
+	PERSONAL_TOKEN_FORBIDDEN_MESSAGE = "personal access tokens can't be used for this operation, sign in instead"
+)
+
+// purposeClaims is used for signed links, the purpose is stored as audience so the token
+// can't be replayed for another purpose nor as access token
+type purposeClaims struct {
+	Email string `json:"email,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// generate random opaque token that is handed to the user once, only its hash is stored
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random token %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (service *ServiceImpl) signPurposeToken(purpose string, subject string, email string, lifetime time.Duration) (string, error) {
+	token, err := service.keys.Sign(purposeClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{purpose},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(lifetime)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to sign %s token %w", purpose, err)
+	}
+	return token, nil
+}
+
+func (service *ServiceImpl) parsePurposeToken(token string, purpose string) (*purposeClaims, error) {
+	claims := &purposeClaims{}
+	_, err := jwt.ParseWithClaims(
+		token,
+		claims,
+		service.keys.Keyfunc,
+		jwt.WithAudience(purpose),
+		jwt.WithValidMethods(service.keys.ValidMethods()),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s token %w", purpose, err)
+	}
+	return claims, nil
+}
+
+func IsPersonalToken(token string) bool {
+	return strings.HasPrefix(token, PERSONAL_TOKEN_PREFIX)
+}
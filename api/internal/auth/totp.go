@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RFC 6238 parameters, these are the defaults every authenticator app understand
+const (
+	TOTP_ISSUER          = "Code Roast"
+	TOTP_DIGITS          = 6
+	TOTP_PERIOD          = 30
+	TOTP_SKEW            = 1
+	TOTP_SECRET_SIZE     = 20
+	RECOVERY_CODE_AMOUNT = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func generateTOTPSecret() (string, error) {
+	secret := make([]byte, TOTP_SECRET_SIZE)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate totp secret %w", err)
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// otpauth uri is what the qr code shown to the user contains
+func totpURI(account string, secret string) string {
+	label := url.PathEscape(TOTP_ISSUER + ":" + account)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", TOTP_ISSUER)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(TOTP_DIGITS))
+	query.Set("period", fmt.Sprint(TOTP_PERIOD))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// hotp as described in RFC 4226, totp is hotp with time step as the counter
+func hotp(secret string, counter uint64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid totp secret %w", err)
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < TOTP_DIGITS; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTP_DIGITS, value%mod), nil
+}
+
+func totpCode(secret string, t time.Time) (string, error) {
+	return hotp(secret, uint64(t.Unix())/TOTP_PERIOD)
+}
+
+// accept code from the previous and next time step too, to tolerate clock drift.
+// steps up to lastStep were already used and never match again, the matching step is returned
+func validateTOTP(secret string, code string, now time.Time, lastStep int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != TOTP_DIGITS {
+		return 0, false
+	}
+	counter := int64(uint64(now.Unix()) / TOTP_PERIOD)
+	var step int64
+	valid := false
+	for i := -TOTP_SKEW; i <= TOTP_SKEW; i++ {
+		expected, err := hotp(secret, uint64(counter+int64(i)))
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 && counter+int64(i) > lastStep {
+			step = counter + int64(i)
+			valid = true
+		}
+	}
+	return step, valid
+}
+
+// recovery code looks like "abcd-efgh", they are shown once and only the hash is stored
+func generateRecoveryCodes() ([]string, error) {
+	codes := []string{}
+	for i := 0; i < RECOVERY_CODE_AMOUNT; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code %w", err)
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(b))
+		codes = append(codes, code[:4]+"-"+code[4:])
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// base32 of the ascii seed "12345678901234567890" used by RFC 6238 appendix B
+const rfcTestSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTotpCode(t *testing.T) {
+	// RFC 6238 test vectors for SHA1, truncated to 6 digits
+	tests := []struct {
+		unix     int64
+		expected string
+	}{
+		{unix: 59, expected: "287082"},
+		{unix: 1111111109, expected: "081804"},
+		{unix: 1111111111, expected: "050471"},
+		{unix: 1234567890, expected: "005924"},
+		{unix: 2000000000, expected: "279037"},
+	}
+	for _, tt := range tests {
+		code, err := totpCode(rfcTestSecret, time.Unix(tt.unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, code)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current, err := totpCode(rfcTestSecret, now)
+	require.NoError(t, err)
+	previous, err := totpCode(rfcTestSecret, now.Add(-TOTP_PERIOD*time.Second))
+	require.NoError(t, err)
+	tooOld, err := totpCode(rfcTestSecret, now.Add(-3*TOTP_PERIOD*time.Second))
+	require.NoError(t, err)
+
+	counter := now.Unix() / TOTP_PERIOD
+
+	step, ok := validateTOTP(rfcTestSecret, current, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, counter, step)
+	step, ok = validateTOTP(rfcTestSecret, previous, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, counter-1, step)
+	_, ok = validateTOTP(rfcTestSecret, tooOld, now, 0)
+	assert.False(t, ok)
+	_, ok = validateTOTP(rfcTestSecret, "12345", now, 0)
+	assert.False(t, ok)
+
+	// a used step can't be replayed, nor can an older code once a newer one was accepted
+	_, ok = validateTOTP(rfcTestSecret, current, now, counter)
+	assert.False(t, ok)
+	_, ok = validateTOTP(rfcTestSecret, previous, now, counter)
+	assert.False(t, ok)
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := generateRecoveryCodes()
+	require.NoError(t, err)
+	require.Len(t, codes, RECOVERY_CODE_AMOUNT)
+	seen := map[string]bool{}
+	for _, code := range codes {
+		assert.Len(t, code, 9)
+		assert.False(t, seen[code])
+		seen[code] = true
+	}
+}
@@ -0,0 +1,767 @@
+package comment
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/labstack/echo/v4"
+	apperror "github.com/zulfikarrosadi/code_roast/internal/app-error"
+	"github.com/zulfikarrosadi/code_roast/internal/auth"
+	"github.com/zulfikarrosadi/code_roast/pkg/schema"
+)
+
+type service interface {
+	create(context.Context, commentCreateRequest) (schema.Response[commentResponse], error)
+	update(context.Context, commentUpdateRequest) (schema.Response[commentResponse], error)
+	delete(context.Context, commentDeleteRequest) (schema.Response[commentResponse], error)
+	list(context.Context, commentListRequest) (schema.Response[commentListResponse], error)
+	vote(context.Context, commentVoteRequest) (schema.Response[commentVoteResponse], error)
+	react(context.Context, commentReactionRequest) (schema.Response[commentReactionResponse], error)
+}
+
+type ApiImpl struct {
+	service service
+	*slog.Logger
+}
+
+func NewApi(service service, logger *slog.Logger) *ApiImpl {
+	return &ApiImpl{
+		service: service,
+		Logger:  logger,
+	}
+}
+
+const (
+	REQUEST_ID_KEY = "REQUEST_ID"
+)
+
+func (api *ApiImpl) Create(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := auth.GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	data := commentCreateRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	data.userId = user.Id
+
+	response, err := api.service.create(ctx, data)
+	if err != nil {
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiImpl) Update(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := auth.GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	data := commentUpdateRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	data.userId = user.Id
+
+	response, err := api.service.update(ctx, data)
+	if err != nil {
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiImpl) Delete(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := auth.GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	data := commentDeleteRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	data.userId = user.Id
+	data.roles = user.Roles
+
+	response, err := api.service.delete(ctx, data)
+	if err != nil {
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+// List send the top level comments of a post
+
+func (api *ApiImpl) List(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	data := commentListRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	data.PostId = c.Param("id")
+
+	response, err := api.service.list(ctx, data)
+	if err != nil {
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+// Replies is the "load more" of a comment, next replies come after the cursor
+
+func (api *ApiImpl) Replies(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	data := commentListRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	data.CommentId = c.Param("id")
+
+	response, err := api.service.list(ctx, data)
+	if err != nil {
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiImpl) Vote(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := auth.GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	data := commentVoteRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	data.userId = user.Id
+
+	response, err := api.service.vote(ctx, data)
+	if err != nil {
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+func (api *ApiImpl) React(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := auth.GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	data := commentReactionRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	data.userId = user.Id
+
+	response, err := api.service.react(ctx, data)
+	if err != nil {
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
+
+// Unreact clear the reaction of the user, it is React without a reaction
+
+func (api *ApiImpl) Unreact(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	user, err := auth.GetUserFromContext(c)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	data := commentReactionRequest{
+		CommentId: c.Param("id"),
+		userId:    user.Id,
+	}
+
+	response, err := api.service.react(ctx, data)
+	if err != nil {
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
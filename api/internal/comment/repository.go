@@ -0,0 +1,618 @@
+package comment
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	apperror "github.com/zulfikarrosadi/code_roast/internal/app-error"
+	"github.com/zulfikarrosadi/code_roast/internal/post"
+	"github.com/zulfikarrosadi/code_roast/internal/user"
+)
+
+const (
+	// replies deeper than this are rejected, it also keep the path short enough to be indexed
+	MAX_COMMENT_DEPTH = 8
+	// separate ancestor ids in the path, never appear in uuid
+	PATH_SEPARATOR = "/"
+)
+
+type RepositoryImpl struct {
+	DB *sql.DB
+}
+
+func NewRepository(db *sql.DB) *RepositoryImpl {
+	return &RepositoryImpl{
+		DB: db,
+	}
+}
+
+// comment store its thread position as a materialized path: ids of every ancestor and itself
+// e.g root/child/. uuid v7 sort by time, so ordering by path walk the tree depth first, oldest first
+type comment struct {
+	id       string
+	postId   string
+	parentId sql.NullString
+	path     string
+	depth    int
+	// null once deleted
+	content sql.NullString
+	// direct replies, deleted ones included since they still hold their own replies
+	replyCount int
+	upvotes    int
+	downvotes  int
+	score      int
+	// reaction key to count, keys out of the catalog are included
+	reactions map[string]int
+	user      user.Author
+	createdAt int64
+	updatedAt sql.NullInt64
+	deletedAt sql.NullInt64
+}
+
+type newComment struct {
+	id        string
+	postId    string
+	parentId  string
+	userId    string
+	content   string
+	createdAt int64
+}
+
+const commentColumns = `
+	c.id, c.post_id, c.parent_id, c.path, c.depth, c.content, c.reply_count, c.upvotes, c.downvotes, c.score,
+	COALESCE(u.id, ''), COALESCE(u.fullname, ''), COALESCE(u.handle, ''), COALESCE(u.avatar, ''),
+	c.created_at, c.updated_at, c.deleted_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanComment(row scanner) (comment, error) {
+	result := comment{}
+	err := row.Scan(
+		&result.id,
+		&result.postId,
+		&result.parentId,
+		&result.path,
+		&result.depth,
+		&result.content,
+		&result.replyCount,
+		&result.upvotes,
+		&result.downvotes,
+		&result.score,
+		&result.user.Id,
+		&result.user.Fullname,
+		&result.user.Handle,
+		&result.user.Avatar,
+		&result.createdAt,
+		&result.updatedAt,
+		&result.deletedAt,
+	)
+	return result, err
+}
+
+func (repo *RepositoryImpl) postStatus(ctx context.Context, postId string) (string, error) {
+	var status string
+	err := repo.DB.QueryRowContext(ctx, "SELECT status FROM posts WHERE id = ?", postId).Scan(&status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", apperror.New(http.StatusNotFound, "post not found", err)
+		}
+		return "", fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	return status, nil
+}
+
+func (repo *RepositoryImpl) create(ctx context.Context, data newComment) (comment, error) {
+	tx, err := repo.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return comment{}, fmt.Errorf("repository: transaction begin error: %w", err)
+	}
+	defer func() {
+		// handle panic in extreamely rare case condition e.g driver fails
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	path := data.id + PATH_SEPARATOR
+	depth := 0
+	var parentId sql.NullString
+	if data.parentId != "" {
+		parent := comment{}
+		// lock the parent so its reply count and deletion don't race with this reply
+		err = tx.QueryRowContext(
+			ctx,
+			"SELECT post_id, path, depth, deleted_at FROM comments WHERE id = ? FOR UPDATE",
+			data.parentId,
+		).Scan(&parent.postId, &parent.path, &parent.depth, &parent.deletedAt)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				err = apperror.New(http.StatusNotFound, "the comment you reply to is not found", err)
+				return comment{}, err
+			}
+			return comment{}, fmt.Errorf("repository: db query scan failed, %w", err)
+		}
+		if parent.postId != data.postId {
+			err = apperror.New(http.StatusNotFound, "the comment you reply to is not found", nil)
+			return comment{}, err
+		}
+		if parent.deletedAt.Valid {
+			err = apperror.New(http.StatusGone, "the comment you reply to has been deleted", nil)
+			return comment{}, err
+		}
+		if parent.depth+1 > MAX_COMMENT_DEPTH {
+			err = apperror.New(http.StatusBadRequest, "this thread is too deep, reply to an earlier comment instead", nil)
+			return comment{}, err
+		}
+		path = parent.path + path
+		depth = parent.depth + 1
+		parentId = sql.NullString{String: data.parentId, Valid: true}
+
+		_, err = tx.ExecContext(ctx, "UPDATE comments SET reply_count = reply_count + 1 WHERE id = ?", data.parentId)
+		if err != nil {
+			return comment{}, fmt.Errorf("repository: failed to update reply count %w", err)
+		}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO comments (id, post_id, user_id, parent_id, path, depth, content, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		data.id,
+		data.postId,
+		data.userId,
+		parentId,
+		path,
+		depth,
+		data.content,
+		data.createdAt,
+	)
+	if err != nil {
+		return comment{}, fmt.Errorf("repository: failed to insert comment %w", err)
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE posts SET comment_count = comment_count + 1 WHERE id = ?", data.postId)
+	if err != nil {
+		return comment{}, fmt.Errorf("repository: failed to update comment count %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return comment{}, fmt.Errorf("repository: failed to commit transaction %w", err)
+	}
+	return repo.findById(ctx, data.id)
+}
+
+func (repo *RepositoryImpl) findById(ctx context.Context, commentId string) (comment, error) {
+	result, err := scanComment(repo.DB.QueryRowContext(
+		ctx,
+		fmt.Sprintf(`
+		SELECT %s
+		FROM comments c
+		LEFT JOIN users u
+		ON c.user_id = u.id
+		WHERE c.id = ?`, commentColumns),
+		commentId,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return comment{}, apperror.New(http.StatusNotFound, "comment not found", err)
+		}
+		return comment{}, fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	comments := []comment{result}
+	err = repo.attachReactions(ctx, comments)
+	if err != nil {
+		return comment{}, err
+	}
+	return comments[0], nil
+}
+
+func (repo *RepositoryImpl) update(ctx context.Context, commentId string, content string, now int64) error {
+	result, err := repo.DB.ExecContext(
+		ctx,
+		"UPDATE comments SET content = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL",
+		content,
+		now,
+		commentId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to update comment %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repository: failed to get affected rows %w", err)
+	}
+	if affected == 0 {
+		return apperror.New(http.StatusNotFound, "comment not found", nil)
+	}
+	return nil
+}
+
+// softDelete drop the content but keep the row, its replies still need somewhere to hang from.
+// the placeholder no longer count toward the comment count of the post
+func (repo *RepositoryImpl) softDelete(ctx context.Context, commentId string, now int64) error {
+	tx, err := repo.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("repository: transaction begin error: %w", err)
+	}
+	defer func() {
+		// handle panic in extreamely rare case condition e.g driver fails
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	result, err := tx.ExecContext(
+		ctx,
+		"UPDATE comments SET content = NULL, deleted_at = ? WHERE id = ? AND deleted_at IS NULL",
+		now,
+		commentId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to delete comment %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("repository: failed to get affected rows %w", err)
+	}
+	if affected == 0 {
+		err = apperror.New(http.StatusNotFound, "comment not found", nil)
+		return err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE posts p JOIN comments c ON c.post_id = p.id SET p.comment_count = p.comment_count - 1 WHERE c.id = ?",
+		commentId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to update comment count %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("repository: failed to commit transaction %w", err)
+	}
+	return nil
+}
+
+type commentVote struct {
+	commentId string
+	userId    string
+	// post.VOTE_UP, post.VOTE_DOWN or post.VOTE_RETRACT
+	value     int
+	createdAt int64
+}
+
+// commentVoteState is the tally of a comment after the change and the vote of the user
+type commentVoteState struct {
+	upvotes   int
+	downvotes int
+	score     int
+	value     int
+}
+
+// vote work like post votes, voting the same value twice keep one vote and post.VOTE_RETRACT remove it
+func (repo *RepositoryImpl) vote(ctx context.Context, data commentVote) (commentVoteState, error) {
+	tx, err := repo.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return commentVoteState{}, fmt.Errorf("repository: transaction begin error: %w", err)
+	}
+	defer func() {
+		// handle panic in extreamely rare case condition e.g driver fails
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var deletedAt sql.NullInt64
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT deleted_at FROM comments WHERE id = ? FOR UPDATE",
+		data.commentId,
+	).Scan(&deletedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = apperror.New(http.StatusNotFound, "comment not found", err)
+			return commentVoteState{}, err
+		}
+		return commentVoteState{}, fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	if deletedAt.Valid {
+		err = apperror.New(http.StatusNotFound, "comment not found", nil)
+		return commentVoteState{}, err
+	}
+
+	if data.value == post.VOTE_RETRACT {
+		_, err = tx.ExecContext(
+			ctx,
+			"DELETE FROM comment_votes WHERE comment_id = ? AND user_id = ?",
+			data.commentId,
+			data.userId,
+		)
+	} else {
+		_, err = tx.ExecContext(
+			ctx,
+			"INSERT INTO comment_votes (comment_id, user_id, value, created_at) VALUES (?,?,?,?) ON DUPLICATE KEY UPDATE value = VALUES(value)",
+			data.commentId,
+			data.userId,
+			data.value,
+			data.createdAt,
+		)
+	}
+	if err != nil {
+		return commentVoteState{}, fmt.Errorf("repository: failed to change vote of comment %w", err)
+	}
+	// recount instead of incrementing, so a missed update never stick
+	_, err = tx.ExecContext(
+		ctx,
+		`
+		UPDATE comments
+		SET upvotes = (SELECT COUNT(comment_id) FROM comment_votes WHERE comment_id = ? AND value = ?),
+		downvotes = (SELECT COUNT(comment_id) FROM comment_votes WHERE comment_id = ? AND value = ?),
+		score = upvotes - downvotes
+		WHERE id = ?`,
+		data.commentId,
+		post.VOTE_UP,
+		data.commentId,
+		post.VOTE_DOWN,
+		data.commentId,
+	)
+	if err != nil {
+		return commentVoteState{}, fmt.Errorf("repository: failed to update comment score %w", err)
+	}
+	state := commentVoteState{}
+	err = tx.QueryRowContext(
+		ctx,
+		`
+		SELECT c.upvotes, c.downvotes, c.score,
+		COALESCE((SELECT v.value FROM comment_votes v WHERE v.comment_id = c.id AND v.user_id = ?), 0)
+		FROM comments c
+		WHERE c.id = ?`,
+		data.userId,
+		data.commentId,
+	).Scan(&state.upvotes, &state.downvotes, &state.score, &state.value)
+	if err != nil {
+		return commentVoteState{}, fmt.Errorf("repository: failed to get comment score, %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return commentVoteState{}, fmt.Errorf("repository: failed to commit transaction %w", err)
+	}
+	return state, nil
+}
+
+// attachReactions fill the reaction counts of comments in one query
+func (repo *RepositoryImpl) attachReactions(ctx context.Context, comments []comment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+	commentIds := []interface{}{}
+	for _, c := range comments {
+		commentIds = append(commentIds, c.id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(commentIds)), ",")
+	rows, err := repo.DB.QueryContext(
+		ctx,
+		fmt.Sprintf("SELECT comment_id, reaction, COUNT(user_id) FROM comment_reactions WHERE comment_id IN (%s) GROUP BY comment_id, reaction", placeholders),
+		commentIds...,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to get comment reactions %w", err)
+	}
+	defer rows.Close()
+
+	reactions := map[string]map[string]int{}
+	for rows.Next() {
+		var commentId, reaction string
+		var count int
+		if err := rows.Scan(&commentId, &reaction, &count); err != nil {
+			return fmt.Errorf("repository: failed to scan comment reactions %w", err)
+		}
+		if reactions[commentId] == nil {
+			reactions[commentId] = map[string]int{}
+		}
+		reactions[commentId][reaction] = count
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("repository: failed to read comment reactions %w", err)
+	}
+	for i := range comments {
+		comments[i].reactions = reactions[comments[i].id]
+	}
+	return nil
+}
+
+type commentReaction struct {
+	commentId string
+	userId    string
+	// empty clear the reaction
+	reaction  string
+	createdAt int64
+}
+
+// react replace the reaction the user already put on the comment, one reaction per user per comment
+func (repo *RepositoryImpl) react(ctx context.Context, data commentReaction) (map[string]int, error) {
+	tx, err := repo.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("repository: transaction begin error: %w", err)
+	}
+	defer func() {
+		// handle panic in extreamely rare case condition e.g driver fails
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var deletedAt sql.NullInt64
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT deleted_at FROM comments WHERE id = ? FOR SHARE",
+		data.commentId,
+	).Scan(&deletedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = apperror.New(http.StatusNotFound, "comment not found", err)
+			return nil, err
+		}
+		return nil, fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	if deletedAt.Valid {
+		err = apperror.New(http.StatusNotFound, "comment not found", nil)
+		return nil, err
+	}
+
+	if data.reaction == "" {
+		_, err = tx.ExecContext(
+			ctx,
+			"DELETE FROM comment_reactions WHERE comment_id = ? AND user_id = ?",
+			data.commentId,
+			data.userId,
+		)
+	} else {
+		_, err = tx.ExecContext(
+			ctx,
+			"INSERT INTO comment_reactions (comment_id, user_id, reaction, created_at) VALUES (?,?,?,?) ON DUPLICATE KEY UPDATE reaction = VALUES(reaction), created_at = VALUES(created_at)",
+			data.commentId,
+			data.userId,
+			data.reaction,
+			data.createdAt,
+		)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to change reaction to comment %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to commit transaction %w", err)
+	}
+	comments := []comment{{id: data.commentId}}
+	err = repo.attachReactions(ctx, comments)
+	if err != nil {
+		return nil, err
+	}
+	return comments[0].reactions, nil
+}
+
+// commentPage is one page of direct replies of parentId, empty parentId is the top level comments
+type commentPage struct {
+	postId   string
+	parentId string
+	after    string
+	limit    int
+}
+
+func (repo *RepositoryImpl) children(ctx context.Context, page commentPage) ([]comment, error) {
+	condition := "c.post_id = ? AND c.parent_id IS NULL"
+	args := []interface{}{page.postId}
+	if page.parentId != "" {
+		condition = "c.post_id = ? AND c.parent_id = ?"
+		args = append(args, page.parentId)
+	}
+	if page.after != "" {
+		condition += " AND c.id > ?"
+		args = append(args, page.after)
+	}
+	args = append(args, page.limit)
+
+	rows, err := repo.DB.QueryContext(
+		ctx,
+		fmt.Sprintf(`
+		SELECT %s
+		FROM comments c
+		LEFT JOIN users u
+		ON c.user_id = u.id
+		WHERE %s
+		ORDER BY c.id
+		LIMIT ?`, commentColumns, condition),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to get comments %w", err)
+	}
+	defer rows.Close()
+
+	comments := []comment{}
+	for rows.Next() {
+		result, err := scanComment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("repository: failed to scan comment %w", err)
+		}
+		comments = append(comments, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository: failed to read comments %w", err)
+	}
+	err = repo.attachReactions(ctx, comments)
+	if err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// descendants return replies of roots up to depth levels below them, in path order.
+// only the first childLimit replies of every comment are returned, the rest is loaded on demand
+func (repo *RepositoryImpl) descendants(ctx context.Context, roots []comment, depth int, childLimit int) ([]comment, error) {
+	if len(roots) == 0 || depth <= 0 {
+		return []comment{}, nil
+	}
+	pathConditions := []string{}
+	args := []interface{}{roots[0].postId}
+	maxDepth := 0
+	for _, root := range roots {
+		pathConditions = append(pathConditions, "c.path LIKE ?")
+		args = append(args, root.path+"_%")
+		maxDepth = max(maxDepth, root.depth+depth)
+	}
+	args = append(args, maxDepth, childLimit)
+
+	rows, err := repo.DB.QueryContext(
+		ctx,
+		fmt.Sprintf(`
+		SELECT %s
+		FROM (
+			SELECT c.*, ROW_NUMBER() OVER (PARTITION BY c.parent_id ORDER BY c.id) AS position
+			FROM comments c
+			WHERE c.post_id = ? AND (%s) AND c.depth <= ?
+		) c
+		LEFT JOIN users u
+		ON c.user_id = u.id
+		WHERE c.position <= ?
+		ORDER BY c.path`, commentColumns, strings.Join(pathConditions, " OR ")),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to get replies %w", err)
+	}
+	defer rows.Close()
+
+	comments := []comment{}
+	for rows.Next() {
+		result, err := scanComment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("repository: failed to scan reply %w", err)
+		}
+		comments = append(comments, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository: failed to read replies %w", err)
+	}
+	err = repo.attachReactions(ctx, comments)
+	if err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
@@ -0,0 +1,767 @@
+package comment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	apperror "github.com/zulfikarrosadi/code_roast/internal/app-error"
+	"github.com/zulfikarrosadi/code_roast/internal/post"
+	"github.com/zulfikarrosadi/code_roast/internal/user"
+	"github.com/zulfikarrosadi/code_roast/pkg/schema"
+)
+
+const (
+	DEFAULT_COMMENT_LIMIT = 20
+	// levels of replies sent along with every comment of a page
+	COMMENT_TREE_DEPTH = 3
+	// replies sent per comment, the client ask for the rest with "load more"
+	COMMENT_CHILDREN_LIMIT = 5
+)
+
+type repository interface {
+	postStatus(context.Context, string) (string, error)
+	create(context.Context, newComment) (comment, error)
+	findById(context.Context, string) (comment, error)
+	update(context.Context, string, string, int64) error
+	softDelete(context.Context, string, int64) error
+	children(context.Context, commentPage) ([]comment, error)
+	descendants(context.Context, []comment, int, int) ([]comment, error)
+	vote(context.Context, commentVote) (commentVoteState, error)
+	react(context.Context, commentReaction) (map[string]int, error)
+}
+
+type ServiceImpl struct {
+	repo      repository
+	v         *validator.Validate
+	reactions post.ReactionCatalog
+}
+
+// reactions is the same catalog posts use, so one picker work for both
+func NewService(repo repository, v *validator.Validate, reactions post.ReactionCatalog) *ServiceImpl {
+	post.RegisterReactionCatalog(v, reactions)
+	return &ServiceImpl{
+		repo:      repo,
+		v:         v,
+		reactions: reactions,
+	}
+}
+
+type commentCreateRequest struct {
+	userId   string
+	PostId   string `param:"id" validate:"required"`
+	ParentId string `json:"parent_id" validate:"omitempty,uuid"`
+	Content  string `json:"content" validate:"required,max=10000"`
+}
+
+type commentUpdateRequest struct {
+	userId    string
+	CommentId string `param:"id" validate:"required"`
+	Content   string `json:"content" validate:"required,max=10000"`
+}
+
+type commentDeleteRequest struct {
+	userId    string
+	roles     []user.Roles
+	CommentId string `param:"id" validate:"required"`
+}
+
+// commentListRequest is a page of top level comments of a post, or a page of replies of a comment
+type commentListRequest struct {
+	PostId    string
+	CommentId string
+	Cursor    string `query:"cursor" validate:"omitempty,uuid"`
+	Limit     int    `query:"limit" validate:"omitempty,min=1,max=50"`
+}
+
+// commentDetail of a deleted comment is a placeholder, only its position in the thread is left
+type commentDetail struct {
+	Id        string       `json:"id"`
+	PostId    string       `json:"post_id"`
+	ParentId  string       `json:"parent_id"`
+	Depth     int          `json:"depth"`
+	Content   string       `json:"content"`
+	User      *user.Author `json:"user"`
+	Deleted   bool         `json:"deleted"`
+	Edited    bool         `json:"edited"`
+	CreatedAt int64        `json:"created_at"`
+	UpdatedAt int64        `json:"updated_at"`
+	// reply_count bigger than len(replies) means there is more to load from /comments/:id/replies
+	ReplyCount int             `json:"reply_count"`
+	Replies    []commentDetail `json:"replies"`
+	Upvotes    int             `json:"upvotes"`
+	Downvotes  int             `json:"downvotes"`
+	Score      int             `json:"score"`
+	// reaction key to count, every reaction of the catalog is present
+	Reactions map[string]int `json:"reactions"`
+}
+
+type commentResponse struct {
+	Comment commentDetail `json:"comment"`
+}
+
+type commentListResponse struct {
+	Comments []commentDetail `json:"comments"`
+	// empty on the last page
+	NextCursor string `json:"next_cursor"`
+}
+
+func (service *ServiceImpl) toCommentDetail(result comment) commentDetail {
+	detail := commentDetail{
+		Id:         result.id,
+		PostId:     result.postId,
+		ParentId:   result.parentId.String,
+		Depth:      result.depth,
+		Deleted:    result.deletedAt.Valid,
+		CreatedAt:  result.createdAt,
+		ReplyCount: result.replyCount,
+		Replies:    []commentDetail{},
+		Upvotes:    result.upvotes,
+		Downvotes:  result.downvotes,
+		Score:      result.score,
+		Reactions:  service.reactions.Counts(result.reactions),
+	}
+	if detail.Deleted {
+		return detail
+	}
+	detail.Content = result.content.String
+	detail.Edited = result.updatedAt.Valid
+	detail.UpdatedAt = result.updatedAt.Int64
+	// author account can be hard deleted while the comment stay
+	if result.user.Id != "" {
+		author := result.user
+		detail.User = &author
+	}
+	return detail
+}
+
+// buildTree hang descendants under their page comment. descendants are in path order so
+// a parent always come before its replies, reply whose parent was cut by the limit is dropped
+func (service *ServiceImpl) buildTree(page []comment, descendants []comment) []commentDetail {
+	nodes := map[string]*commentDetail{}
+	children := map[string][]string{}
+	for _, c := range append(page, descendants...) {
+		detail := service.toCommentDetail(c)
+		nodes[c.id] = &detail
+		if c.parentId.Valid {
+			children[c.parentId.String] = append(children[c.parentId.String], c.id)
+		}
+	}
+	var assemble func(id string) commentDetail
+	assemble = func(id string) commentDetail {
+		node := *nodes[id]
+		for _, childId := range children[id] {
+			node.Replies = append(node.Replies, assemble(childId))
+		}
+		return node
+	}
+
+	tree := []commentDetail{}
+	for _, c := range page {
+		tree = append(tree, assemble(c.id))
+	}
+	return tree
+}
+
+// checkPost only let people read and write comments of published posts
+func (service *ServiceImpl) checkPost(ctx context.Context, postId string) error {
+	status, err := service.repo.postStatus(ctx, postId)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case post.POST_STATUS_TAKE_DOWN:
+		return apperror.New(http.StatusUnavailableForLegalReasons, "this post has been removed by moderators", nil)
+	case post.POST_STATUS_PUBLISHED:
+		return nil
+	default:
+		return apperror.New(http.StatusNotFound, "post not found", nil)
+	}
+}
+
+func (service *ServiceImpl) create(ctx context.Context, data commentCreateRequest) (schema.Response[commentResponse], error) {
+	data.Content = strings.TrimSpace(data.Content)
+	err := service.v.Struct(data)
+	if err != nil {
+		validationError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[commentResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationError,
+			},
+		}, fmt.Errorf("service: create comment validation error %w", err)
+	}
+	err = service.checkPost(ctx, data.PostId)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[commentResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[commentResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to create comment, please try again later",
+			},
+		}, err
+	}
+	commentId, err := uuid.NewV7()
+	if err != nil {
+		return schema.Response[commentResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "something went wrong, please try again later",
+			},
+		}, fmt.Errorf("service: fail to generate comment uuid %w", err)
+	}
+	result, err := service.repo.create(ctx, newComment{
+		id:        commentId.String(),
+		postId:    data.PostId,
+		parentId:  data.ParentId,
+		userId:    data.userId,
+		content:   data.Content,
+		createdAt: time.Now().Unix(),
+	})
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[commentResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[commentResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to create comment, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[commentResponse]{
+		Status: "success",
+		Code:   http.StatusCreated,
+		Data: commentResponse{
+			Comment: service.toCommentDetail(result),
+		},
+	}, nil
+}
+
+func (service *ServiceImpl) update(ctx context.Context, data commentUpdateRequest) (schema.Response[commentResponse], error) {
+	data.Content = strings.TrimSpace(data.Content)
+	err := service.v.Struct(data)
+	if err != nil {
+		validationError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[commentResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationError,
+			},
+		}, fmt.Errorf("service: update comment validation error %w", err)
+	}
+	result, err := service.repo.findById(ctx, data.CommentId)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[commentResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[commentResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to update comment, please try again later",
+			},
+		}, err
+	}
+	if result.deletedAt.Valid {
+		return schema.Response[commentResponse]{
+			Status: "fail",
+			Code:   http.StatusNotFound,
+			Error: schema.Error{
+				Message: "comment not found",
+			},
+		}, errors.New("service: comment is deleted")
+	}
+	// comments of a post taken down or waiting for review are frozen like the post
+	err = service.checkPost(ctx, result.postId)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[commentResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[commentResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to update comment, please try again later",
+			},
+		}, err
+	}
+	if result.user.Id != data.userId {
+		return schema.Response[commentResponse]{
+			Status: "fail",
+			Code:   http.StatusForbidden,
+			Error: schema.Error{
+				Message: "you can only edit your own comment",
+			},
+		}, errors.New("service: edit comment of other user")
+	}
+	now := time.Now().Unix()
+	err = service.repo.update(ctx, data.CommentId, data.Content, now)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[commentResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[commentResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to update comment, please try again later",
+			},
+		}, err
+	}
+	result.content.String = data.Content
+	result.updatedAt.Int64, result.updatedAt.Valid = now, true
+	return schema.Response[commentResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: commentResponse{
+			Comment: service.toCommentDetail(result),
+		},
+	}, nil
+}
+
+// delete is allowed to the author and moderators, the comment become a placeholder
+func (service *ServiceImpl) delete(ctx context.Context, data commentDeleteRequest) (schema.Response[commentResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[commentResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationError,
+			},
+		}, fmt.Errorf("service: delete comment validation error %w", err)
+	}
+	result, err := service.repo.findById(ctx, data.CommentId)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[commentResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[commentResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to delete comment, please try again later",
+			},
+		}, err
+	}
+	if result.deletedAt.Valid {
+		return schema.Response[commentResponse]{
+			Status: "fail",
+			Code:   http.StatusNotFound,
+			Error: schema.Error{
+				Message: "comment not found",
+			},
+		}, errors.New("service: comment is already deleted")
+	}
+	err = service.checkPost(ctx, result.postId)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[commentResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[commentResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to delete comment, please try again later",
+			},
+		}, err
+	}
+	if result.user.Id != data.userId && !post.CanModerate(data.roles) {
+		return schema.Response[commentResponse]{
+			Status: "fail",
+			Code:   http.StatusForbidden,
+			Error: schema.Error{
+				Message: "you can only delete your own comment",
+			},
+		}, errors.New("service: delete comment of other user")
+	}
+	now := time.Now().Unix()
+	err = service.repo.softDelete(ctx, data.CommentId, now)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[commentResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[commentResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to delete comment, please try again later",
+			},
+		}, err
+	}
+	result.deletedAt.Int64, result.deletedAt.Valid = now, true
+	return schema.Response[commentResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: commentResponse{
+			Comment: service.toCommentDetail(result),
+		},
+	}, nil
+}
+
+// list return a page of comments with the first levels of their replies already attached
+func (service *ServiceImpl) list(ctx context.Context, data commentListRequest) (schema.Response[commentListResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[commentListResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationError,
+			},
+		}, fmt.Errorf("service: list comment validation error %w", err)
+	}
+	page := commentPage{
+		postId:   data.PostId,
+		parentId: data.CommentId,
+		after:    data.Cursor,
+		limit:    data.Limit,
+	}
+	if page.limit == 0 {
+		page.limit = DEFAULT_COMMENT_LIMIT
+	}
+	if page.parentId != "" {
+		// "load more" of a comment, its post is looked up from the comment itself
+		parent, err := service.repo.findById(ctx, page.parentId)
+		if err != nil {
+			var appError *apperror.AppError
+			if errors.As(err, &appError) {
+				return schema.Response[commentListResponse]{
+					Status: "fail",
+					Code:   appError.Code,
+					Error: schema.Error{
+						Message: appError.Message,
+					},
+				}, err
+			}
+			return schema.Response[commentListResponse]{
+				Status: "fail",
+				Code:   http.StatusInternalServerError,
+				Error: schema.Error{
+					Message: "something went wrong, please try again later",
+				},
+			}, err
+		}
+		page.postId = parent.postId
+	}
+	err = service.checkPost(ctx, page.postId)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[commentListResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[commentListResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "something went wrong, please try again later",
+			},
+		}, err
+	}
+
+	// one extra comment tell us whether there is a next page
+	page.limit++
+	result, err := service.repo.children(ctx, page)
+	if err != nil {
+		return schema.Response[commentListResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "something went wrong, please try again later",
+			},
+		}, err
+	}
+	nextCursor := ""
+	if len(result) == page.limit {
+		result = result[:len(result)-1]
+		nextCursor = result[len(result)-1].id
+	}
+	descendants, err := service.repo.descendants(ctx, result, COMMENT_TREE_DEPTH-1, COMMENT_CHILDREN_LIMIT)
+	if err != nil {
+		return schema.Response[commentListResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "something went wrong, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[commentListResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: commentListResponse{
+			Comments:   service.buildTree(result, descendants),
+			NextCursor: nextCursor,
+		},
+	}, nil
+}
+
+type commentVoteRequest struct {
+	userId    string
+	CommentId string `param:"id" validate:"required"`
+	// pointer so a missing value isn't mistaken for post.VOTE_RETRACT
+	Value *int `json:"value" validate:"required,oneof=-1 0 1"`
+}
+
+type commentVoteDetail struct {
+	Id        string `json:"id"`
+	Upvotes   int    `json:"upvotes"`
+	Downvotes int    `json:"downvotes"`
+	Score     int    `json:"score"`
+	MyVote    int    `json:"my_vote"`
+}
+
+type commentVoteResponse struct {
+	Comment commentVoteDetail `json:"comment"`
+}
+
+func (service *ServiceImpl) vote(ctx context.Context, data commentVoteRequest) (schema.Response[commentVoteResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[commentVoteResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationError,
+			},
+		}, fmt.Errorf("service: vote comment validation error %w", err)
+	}
+	result, err := service.repo.findById(ctx, data.CommentId)
+	if err == nil {
+		// comments of a removed post are frozen along with it
+		err = service.checkPost(ctx, result.postId)
+	}
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[commentVoteResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[commentVoteResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to vote this comment, please try again later",
+			},
+		}, err
+	}
+	state, err := service.repo.vote(ctx, commentVote{
+		commentId: data.CommentId,
+		userId:    data.userId,
+		value:     *data.Value,
+		createdAt: time.Now().Unix(),
+	})
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[commentVoteResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[commentVoteResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to vote this comment, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[commentVoteResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: commentVoteResponse{
+			Comment: commentVoteDetail{
+				Id:        data.CommentId,
+				Upvotes:   state.upvotes,
+				Downvotes: state.downvotes,
+				Score:     state.score,
+				MyVote:    state.value,
+			},
+		},
+	}, nil
+}
+
+// commentReactionRequest with empty Reaction clear the reaction of the user
+type commentReactionRequest struct {
+	userId    string
+	CommentId string `param:"id" validate:"required"`
+	Reaction  string `json:"reaction" validate:"omitempty,reaction"`
+}
+
+type commentReactionDetail struct {
+	Id        string         `json:"id"`
+	Reactions map[string]int `json:"reactions"`
+	// empty after the reaction is cleared
+	MyReaction string `json:"my_reaction"`
+}
+
+type commentReactionResponse struct {
+	Comment commentReactionDetail `json:"comment"`
+}
+
+func (service *ServiceImpl) react(ctx context.Context, data commentReactionRequest) (schema.Response[commentReactionResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[commentReactionResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationError,
+			},
+		}, fmt.Errorf("service: react comment validation error %w", err)
+	}
+	result, err := service.repo.findById(ctx, data.CommentId)
+	if err == nil {
+		// comments of a removed post are frozen along with it
+		err = service.checkPost(ctx, result.postId)
+	}
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[commentReactionResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[commentReactionResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to react to this comment, please try again later",
+			},
+		}, err
+	}
+	reactions, err := service.repo.react(ctx, commentReaction{
+		commentId: data.CommentId,
+		userId:    data.userId,
+		reaction:  data.Reaction,
+		createdAt: time.Now().Unix(),
+	})
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[commentReactionResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[commentReactionResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to react to this comment, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[commentReactionResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: commentReactionResponse{
+			Comment: commentReactionDetail{
+				Id:         data.CommentId,
+				Reactions:  service.reactions.Counts(reactions),
+				MyReaction: data.Reaction,
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,63 @@
+package comment
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/zulfikarrosadi/code_roast/internal/post"
+)
+
+func reply(id string, parentId string) comment {
+	return comment{id: id, parentId: sql.NullString{String: parentId, Valid: true}}
+}
+
+// ids flatten the tree depth first, replies right after their parent
+func ids(tree []commentDetail) []string {
+	result := []string{}
+	for _, node := range tree {
+		result = append(result, node.Id)
+		result = append(result, ids(node.Replies)...)
+	}
+	return result
+}
+
+func TestServiceImpl_buildTree(t *testing.T) {
+	tests := []struct {
+		name        string
+		page        []comment
+		descendants []comment
+		expected    []string
+	}{
+		{
+			name:     "Page without replies",
+			page:     []comment{{id: "a"}, {id: "b"}},
+			expected: []string{"a", "b"},
+		},
+		{
+			name:        "Replies hang under their parent",
+			page:        []comment{{id: "a"}, {id: "b"}},
+			descendants: []comment{reply("a1", "a"), reply("a1x", "a1"), reply("a2", "a"), reply("b1", "b")},
+			expected:    []string{"a", "a1", "a1x", "a2", "b", "b1"},
+		},
+		{
+			name:        "Reply whose parent was cut by the limit is dropped",
+			page:        []comment{{id: "a"}},
+			descendants: []comment{reply("a1", "a"), reply("x1", "x"), reply("x1a", "x1")},
+			expected:    []string{"a", "a1"},
+		},
+		{
+			name:        "Reply page hang from a parent outside of it",
+			page:        []comment{reply("a1", "a"), reply("a2", "a")},
+			descendants: []comment{reply("a2x", "a2")},
+			expected:    []string{"a1", "a2", "a2x"},
+		},
+	}
+	service := NewService(nil, validator.New(), post.DEFAULT_REACTIONS)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ids(service.buildTree(tt.page, tt.descendants)))
+		})
+	}
+}
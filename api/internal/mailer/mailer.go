@@ -0,0 +1,123 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is implemented by anything that can deliver a plain text email
+type Mailer interface {
+	Send(context.Context, Message) error
+}
+
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(host string, port string, username string, password string, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPMailer{
+		addr: host + ":" + port,
+		from: from,
+		auth: auth,
+	}
+}
+
+func (mailer *SMTPMailer) Send(ctx context.Context, message Message) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("mailer: context done before sending %w", err)
+	}
+	err := smtp.SendMail(mailer.addr, mailer.auth, mailer.from, []string{message.To}, format(mailer.from, message))
+	if err != nil {
+		return fmt.Errorf("mailer: failed to send email to %s %w", message.To, err)
+	}
+	return nil
+}
+
+// MemoryMailer keep every message in memory, useful for tests
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (mailer *MemoryMailer) Send(ctx context.Context, message Message) error {
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+	mailer.messages = append(mailer.messages, message)
+	return nil
+}
+
+func (mailer *MemoryMailer) Messages() []Message {
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+	messages := make([]Message, len(mailer.messages))
+	copy(messages, mailer.messages)
+	return messages
+}
+
+// FileMailer write every message as .eml file inside dir, useful for local development
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir string, from string) *FileMailer {
+	return &FileMailer{
+		dir:  dir,
+		from: from,
+	}
+}
+
+func (mailer *FileMailer) Send(ctx context.Context, message Message) error {
+	if err := os.MkdirAll(mailer.dir, 0o755); err != nil {
+		return fmt.Errorf("mailer: failed to create mail directory %w", err)
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.NewReplacer("@", "_at_", "/", "_").Replace(message.To))
+	err := os.WriteFile(filepath.Join(mailer.dir, name), format(mailer.from, message), 0o644)
+	if err != nil {
+		return fmt.Errorf("mailer: failed to write email to file %w", err)
+	}
+	return nil
+}
+
+// headerValue keep a value on its own header line, a line break in a subject built from user input
+// would otherwise let it add headers or start the body
+func headerValue(value string) string {
+	return strings.Join(strings.FieldsFunc(value, func(r rune) bool {
+		return r == '\r' || r == '\n'
+	}), " ")
+}
+
+func format(from string, message Message) []byte {
+	return []byte(
+		"From: " + headerValue(from) + "\r\n" +
+			"To: " + headerValue(message.To) + "\r\n" +
+			"Subject: " + mime.QEncoding.Encode("utf-8", headerValue(message.Subject)) + "\r\n" +
+			"MIME-Version: 1.0\r\n" +
+			"Content-Type: text/plain; charset=\"utf-8\"\r\n" +
+			"\r\n" +
+			message.Body,
+	)
+}
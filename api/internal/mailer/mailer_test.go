@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name          string
+		message       Message
+		expectSubject string
+	}{
+		{
+			name:          "Plain subject",
+			message:       Message{To: "user@example.com", Subject: "Your post in golang was approved"},
+			expectSubject: "Subject: Your post in golang was approved",
+		},
+		{
+			name:          "Line break can't add a header",
+			message:       Message{To: "user@example.com", Subject: "Your post in x\r\nBcc: victim@example.com was approved"},
+			expectSubject: "Subject: Your post in x Bcc: victim@example.com was approved",
+		},
+		{
+			name:          "Non ascii subject is encoded",
+			message:       Message{To: "user@example.com", Subject: "Your post in café was approved"},
+			expectSubject: "Subject: =?utf-8?q?Your_post_in_caf=C3=A9_was_approved?=",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, _, _ := strings.Cut(string(format("noreply@example.com", tt.message)), "\r\n\r\n")
+			lines := strings.Split(header, "\r\n")
+			assert.Contains(t, lines, tt.expectSubject)
+			assert.Len(t, lines, 5)
+		})
+	}
+}
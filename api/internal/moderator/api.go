@@ -128,3 +128,90 @@ func (api *ApiImpl) AddRoles(c echo.Context) error {
 	}
 	return nil
 }
+
+func (api *ApiImpl) RemoveRoles(c echo.Context) error {
+	ctx := context.WithValue(context.TODO(), REQUEST_ID_KEY, c.Response().Header().Get(echo.HeaderXRequestID))
+	data := updateRoleRequest{}
+	if err := c.Bind(&data); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusBadRequest),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusBadRequest, "fail to process your request, send correct data and try again")
+	}
+	response, err := api.service.removeRoles(ctx, data)
+	if err != nil {
+		if response.Error.Message == apperror.VALIDATION_ERROR {
+			api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+				slog.Int("status", response.Code),
+				slog.Group("request",
+					slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+					slog.String("method", c.Request().Method),
+					slog.String("path", c.Request().URL.Path),
+					slog.String("user_agent", c.Request().UserAgent()),
+					slog.String("ip", c.Request().RemoteAddr),
+					slog.Any("authorization", c.Request().Header.Get("Authorization")),
+				),
+				slog.String("error", err.Error()),
+				slog.String("trace", string(debug.Stack())),
+			)
+			if err = c.JSON(response.Code, response); err != nil {
+				api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+					slog.Int("status", http.StatusInternalServerError),
+					slog.Group("request",
+						slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+						slog.String("method", c.Request().Method),
+						slog.String("path", c.Request().URL.Path),
+						slog.String("user_agent", c.Request().UserAgent()),
+						slog.String("ip", c.Request().RemoteAddr),
+						slog.Any("authorization", c.Request().Header.Get("Authorization")),
+					),
+					slog.String("error", err.Error()),
+					slog.String("trace", string(debug.Stack())),
+				)
+				return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+			}
+			return nil
+		}
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", response.Code),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(response.Code, response.Error.Message)
+	}
+	if err = c.JSON(response.Code, response); err != nil {
+		api.Logger.LogAttrs(ctx, slog.LevelDebug, "REQUEST_DEBUG",
+			slog.Int("status", http.StatusInternalServerError),
+			slog.Group("request",
+				slog.String("id", ctx.Value(REQUEST_ID_KEY).(string)),
+				slog.String("method", c.Request().Method),
+				slog.String("path", c.Request().URL.Path),
+				slog.String("user_agent", c.Request().UserAgent()),
+				slog.String("ip", c.Request().RemoteAddr),
+				slog.Any("authorization", c.Request().Header.Get("Authorization")),
+			),
+			slog.String("error", err.Error()),
+			slog.String("trace", string(debug.Stack())),
+		)
+		return echo.NewHTTPError(http.StatusInternalServerError, "something went wrong, please try again later")
+	}
+	return nil
+}
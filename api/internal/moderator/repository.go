@@ -79,6 +79,10 @@ func (repo *repositoryImpl) addRoles(
 	if rowsAffectd == 0 {
 		return userAndRole{}, fmt.Errorf("repository: add new role failed, 0 rows affected %w", err)
 	}
+	err = repo.bumpTokenVersion(ctx, tx, data.UserId)
+	if err != nil {
+		return userAndRole{}, err
+	}
 	rows, err := tx.QueryContext(
 		ctx,
 		`
@@ -165,11 +169,15 @@ func (repo *repositoryImpl) removeRoles(
 			return userAndRole{}, apperror.New(http.StatusBadRequest, "remove roles failed, enter correct user and role data and try again", err)
 		}
 	}
+	err = repo.bumpTokenVersion(ctx, tx, data.UserId)
+	if err != nil {
+		return userAndRole{}, err
+	}
 
 	rows, err := tx.QueryContext(
 		ctx,
 		`
-		SELECT ur.id, ur.name
+		SELECT r.id, r.name
 		FROM user_roles ur
 		JOIN roles r
 		ON ur.role_id = r.id
@@ -201,3 +209,17 @@ func (repo *repositoryImpl) removeRoles(
 		roles:  userRoles,
 	}, nil
 }
+
+// every role change invalidate access tokens issued before it, so the user has to refresh
+// and pick up the new roles instead of keeping the old ones until the token expires
+func (repo *repositoryImpl) bumpTokenVersion(ctx context.Context, tx *sql.Tx, userId string) error {
+	_, err := tx.ExecContext(
+		ctx,
+		"UPDATE users SET token_version = token_version + 1 WHERE id = ?",
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to bump token version of user %s %w", userId, err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package moderator
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const selectUserRoles = "SELECT r.id, r.name FROM user_roles ur JOIN roles r ON ur.role_id = r.id WHERE ur.user_id = ?"
+
+func TestRepositoryImpl_addRoles(t *testing.T) {
+	tests := []struct {
+		name     string
+		failBump bool
+	}{
+		{name: "New roles bump the token version"},
+		{name: "Failed bump roll the roles back", failBump: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, sqlMock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+			repo := NewRepository(db)
+
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_roles (user_id, role_id) VALUES (?,?),(?,?)")).
+				WithArgs("user-1", 2, "user-1", 3).
+				WillReturnResult(sqlmock.NewResult(0, 2))
+			bump := sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE users SET token_version = token_version + 1 WHERE id = ?")).
+				WithArgs("user-1")
+			if tt.failBump {
+				bump.WillReturnError(errors.New("connection reset"))
+				sqlMock.ExpectRollback()
+			} else {
+				bump.WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectQuery(regexp.QuoteMeta(selectUserRoles)).
+					WithArgs("user-1").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "moderator").AddRow(3, "admin"))
+				sqlMock.ExpectCommit()
+			}
+
+			result, err := repo.addRoles(context.Background(), updateRoleRequest{UserId: "user-1", RoleId: []int{2, 3}})
+			if tt.failBump {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, []roles{{Id: 2, Name: "moderator"}, {Id: 3, Name: "admin"}}, result.roles)
+			}
+			assert.NoError(t, sqlMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRepositoryImpl_removeRoles(t *testing.T) {
+	db, sqlMock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewRepository(db)
+
+	sqlMock.ExpectBegin()
+	for _, role := range []int{2, 3} {
+		sqlMock.ExpectExec(regexp.QuoteMeta("DELETE FROM user_roles WHERE user_id = ? AND role_id = ?")).
+			WithArgs("user-1", role).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE users SET token_version = token_version + 1 WHERE id = ?")).
+		WithArgs("user-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectQuery(regexp.QuoteMeta(selectUserRoles)).
+		WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "user"))
+	sqlMock.ExpectCommit()
+
+	result, err := repo.removeRoles(context.Background(), updateRoleRequest{UserId: "user-1", RoleId: []int{2, 3}})
+	require.NoError(t, err)
+	assert.Equal(t, []roles{{Id: 1, Name: "user"}}, result.roles)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+}
@@ -0,0 +1,182 @@
+package post
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloudinary/cloudinary-go/v2"
+	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
+)
+
+const (
+	DEFAULT_MEDIA_CLEANUP_INTERVAL     = time.Minute
+	DEFAULT_MEDIA_CLEANUP_BASE_BACKOFF = time.Minute
+	DEFAULT_MEDIA_CLEANUP_MAX_BACKOFF  = time.Hour * 24
+	DEFAULT_MEDIA_CLEANUP_BATCH_SIZE   = 50
+)
+
+// MediaCleanupConfig control how often queued media are deleted from cloudinary and how failed deletions are retried.
+// a failed deletion wait BaseBackoff, doubled on every attempt up to MaxBackoff, it is retried until it succeed
+type MediaCleanupConfig struct {
+	Interval    time.Duration
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	BatchSize   int
+}
+
+func (config MediaCleanupConfig) interval() time.Duration {
+	if config.Interval <= 0 {
+		return DEFAULT_MEDIA_CLEANUP_INTERVAL
+	}
+	return config.Interval
+}
+
+func (config MediaCleanupConfig) baseBackoff() time.Duration {
+	if config.BaseBackoff <= 0 {
+		return DEFAULT_MEDIA_CLEANUP_BASE_BACKOFF
+	}
+	return config.BaseBackoff
+}
+
+func (config MediaCleanupConfig) maxBackoff() time.Duration {
+	if config.MaxBackoff <= 0 {
+		return DEFAULT_MEDIA_CLEANUP_MAX_BACKOFF
+	}
+	return config.MaxBackoff
+}
+
+func (config MediaCleanupConfig) batchSize() int {
+	if config.BatchSize <= 0 {
+		return DEFAULT_MEDIA_CLEANUP_BATCH_SIZE
+	}
+	return config.BatchSize
+}
+
+// backoff is how long to wait after the given number of failed attempts
+func (config MediaCleanupConfig) backoff(attempts int) time.Duration {
+	wait := config.baseBackoff()
+	for i := 1; i < attempts && wait < config.maxBackoff(); i++ {
+		wait *= 2
+	}
+	return min(wait, config.maxBackoff())
+}
+
+// MediaCleaner delete media of deleted posts from cloudinary, deleting the post only queue its media
+// so the request doesn't wait for cloudinary and a failed deletion is retried instead of leaking the asset
+type MediaCleaner struct {
+	*slog.Logger
+	repo   repository
+	cld    *cloudinary.Cloudinary
+	config MediaCleanupConfig
+}
+
+func NewMediaCleaner(logger *slog.Logger, repo repository, cld *cloudinary.Cloudinary, config MediaCleanupConfig) *MediaCleaner {
+	return &MediaCleaner{
+		Logger: logger,
+		repo:   repo,
+		cld:    cld,
+		config: config,
+	}
+}
+
+// Run periodically delete queued media until ctx is canceled, call it in its own goroutine
+func (cleaner *MediaCleaner) Run(ctx context.Context) {
+	ticker := time.NewTicker(cleaner.config.interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cleaner.clean(ctx)
+		}
+	}
+}
+
+func (cleaner *MediaCleaner) clean(ctx context.Context) {
+	now := time.Now()
+	deletions, err := cleaner.repo.dueMediaDeletions(ctx, now.Unix(), cleaner.config.batchSize())
+	if err != nil {
+		cleaner.Logger.LogAttrs(ctx, slog.LevelError, "MEDIA_CLEANUP_ERROR",
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	deleted, failed := 0, 0
+	for _, deletion := range deletions {
+		err := cleaner.destroy(ctx, deletion.mediaUrl)
+		if err == nil {
+			err = cleaner.repo.finishMediaDeletion(ctx, deletion.id)
+			if err == nil {
+				deleted++
+				continue
+			}
+		}
+		failed++
+		attempts := deletion.attempts + 1
+		cleaner.Logger.LogAttrs(ctx, slog.LevelWarn, "MEDIA_CLEANUP_RETRY",
+			slog.String("media_url", deletion.mediaUrl),
+			slog.Int("attempts", attempts),
+			slog.String("error", err.Error()),
+		)
+		nextAttemptAt := now.Add(cleaner.config.backoff(attempts)).Unix()
+		if err := cleaner.repo.retryMediaDeletion(ctx, deletion.id, nextAttemptAt, err.Error()); err != nil {
+			cleaner.Logger.LogAttrs(ctx, slog.LevelError, "MEDIA_CLEANUP_ERROR",
+				slog.String("media_url", deletion.mediaUrl),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+	if len(deletions) > 0 {
+		cleaner.Logger.LogAttrs(ctx, slog.LevelInfo, "MEDIA_CLEANUP",
+			slog.Int("deleted", deleted),
+			slog.Int("failed", failed),
+		)
+	}
+}
+
+// destroy treat an asset that is already gone as deleted
+func (cleaner *MediaCleaner) destroy(ctx context.Context, mediaUrl string) error {
+	publicId, err := cloudinaryPublicId(mediaUrl)
+	if err != nil {
+		return err
+	}
+	result, err := cleaner.cld.Upload.Destroy(ctx, uploader.DestroyParams{
+		PublicID:     publicId,
+		ResourceType: "image",
+	})
+	if err != nil {
+		return fmt.Errorf("cloudinary: failed to destroy %s %w", publicId, err)
+	}
+	if result.Result != "ok" && result.Result != "not found" {
+		return fmt.Errorf("cloudinary: failed to destroy %s, result %q %s", publicId, result.Result, result.Error.Message)
+	}
+	return nil
+}
+
+var cloudinaryVersionPattern = regexp.MustCompile(`^v[0-9]+$`)
+
+// cloudinaryPublicId read the public id out of a delivery url
+// e.g https://res.cloudinary.com/<cloud>/image/upload/v1700000000/folder/name.jpg is folder/name
+func cloudinaryPublicId(mediaUrl string) (string, error) {
+	parsed, err := url.Parse(mediaUrl)
+	if err != nil {
+		return "", fmt.Errorf("cloudinary: invalid media url %w", err)
+	}
+	_, rest, ok := strings.Cut(parsed.Path, "/upload/")
+	if !ok || rest == "" {
+		return "", fmt.Errorf("cloudinary: %s is not an uploaded asset url", mediaUrl)
+	}
+	segments := strings.Split(rest, "/")
+	if len(segments) > 1 && cloudinaryVersionPattern.MatchString(segments[0]) {
+		segments = segments[1:]
+	}
+	publicId := strings.Join(segments, "/")
+	return strings.TrimSuffix(publicId, path.Ext(publicId)), nil
+}
@@ -0,0 +1,79 @@
+package post
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloudinaryPublicId(t *testing.T) {
+	tests := []struct {
+		name      string
+		mediaUrl  string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "Versioned url in folder",
+			mediaUrl: "https://res.cloudinary.com/demo/image/upload/v1700000000/posts/abc.jpg",
+			expected: "posts/abc",
+		},
+		{
+			name:     "Url without version",
+			mediaUrl: "https://res.cloudinary.com/demo/image/upload/abc.png",
+			expected: "abc",
+		},
+		{
+			name:     "Folder named like a version is kept when it is not the first segment",
+			mediaUrl: "https://res.cloudinary.com/demo/image/upload/posts/v2/abc.webp",
+			expected: "posts/v2/abc",
+		},
+		{
+			name:     "Dotted name only lose its extension",
+			mediaUrl: "https://res.cloudinary.com/demo/image/upload/v1/my.photo.jpg",
+			expected: "my.photo",
+		},
+		{
+			name:     "Version alone is the public id",
+			mediaUrl: "https://res.cloudinary.com/demo/image/upload/v1700000000",
+			expected: "v1700000000",
+		},
+		{name: "Not an upload url", mediaUrl: "https://example.com/images/abc.jpg", expectErr: true},
+		{name: "Nothing after upload", mediaUrl: "https://res.cloudinary.com/demo/image/upload/", expectErr: true},
+		{name: "Invalid url", mediaUrl: "://res.cloudinary.com", expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publicId, err := cloudinaryPublicId(tt.mediaUrl)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, publicId)
+		})
+	}
+}
+
+func TestMediaCleanupConfig_backoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   MediaCleanupConfig
+		attempts int
+		expected time.Duration
+	}{
+		{name: "First failure wait the base", config: MediaCleanupConfig{BaseBackoff: time.Minute, MaxBackoff: time.Hour}, attempts: 1, expected: time.Minute},
+		{name: "Doubled on every attempt", config: MediaCleanupConfig{BaseBackoff: time.Minute, MaxBackoff: time.Hour}, attempts: 4, expected: time.Minute * 8},
+		{name: "Capped at max", config: MediaCleanupConfig{BaseBackoff: time.Minute, MaxBackoff: time.Hour}, attempts: 7, expected: time.Hour},
+		{name: "Many attempts don't overflow", config: MediaCleanupConfig{BaseBackoff: time.Minute, MaxBackoff: time.Hour}, attempts: 1000, expected: time.Hour},
+		{name: "Base above max is capped", config: MediaCleanupConfig{BaseBackoff: time.Hour * 2, MaxBackoff: time.Hour}, attempts: 1, expected: time.Hour},
+		{name: "Zero config use the defaults", config: MediaCleanupConfig{}, attempts: 2, expected: DEFAULT_MEDIA_CLEANUP_BASE_BACKOFF * 2},
+		{name: "Zero config is capped at the default max", config: MediaCleanupConfig{}, attempts: 100, expected: DEFAULT_MEDIA_CLEANUP_MAX_BACKOFF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.config.backoff(tt.attempts))
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package post
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apperror "github.com/zulfikarrosadi/code_roast/internal/app-error"
+	"github.com/zulfikarrosadi/code_roast/internal/user"
+)
+
+// detailRepository only answer findById, any other repository call panic on the nil interface
+type detailRepository struct {
+	repository
+	post     postWithViewer
+	viewerId string
+}
+
+func (repo *detailRepository) findById(ctx context.Context, postId string, viewerId string) (postWithViewer, error) {
+	repo.viewerId = viewerId
+	if postId != repo.post.id {
+		return postWithViewer{}, apperror.New(http.StatusNotFound, "post not found", nil)
+	}
+	return repo.post, nil
+}
+
+func TestServiceImpl_findById(t *testing.T) {
+	moderator := []user.Roles{{Id: user.ROLE_ID_TAKE_DOWN_POST}}
+	member := []user.Roles{{Id: user.ROLE_ID_MEMBER}}
+	tests := []struct {
+		name         string
+		status       string
+		myVote       int
+		request      postDetailRequest
+		expectCode   int
+		expectViewer viewerState
+	}{
+		{
+			name:       "Anonymous viewer",
+			status:     POST_STATUS_PUBLISHED,
+			request:    postDetailRequest{PostId: "post-1"},
+			expectCode: http.StatusOK,
+		},
+		{
+			name:         "Liked by the viewer",
+			status:       POST_STATUS_PUBLISHED,
+			myVote:       VOTE_UP,
+			request:      postDetailRequest{PostId: "post-1", viewerId: "viewer-1", viewerRoles: member},
+			expectCode:   http.StatusOK,
+			expectViewer: viewerState{LikedByMe: true, MyVote: VOTE_UP},
+		},
+		{
+			name:         "Downvoted by the viewer",
+			status:       POST_STATUS_PUBLISHED,
+			myVote:       VOTE_DOWN,
+			request:      postDetailRequest{PostId: "post-1", viewerId: "viewer-1"},
+			expectCode:   http.StatusOK,
+			expectViewer: viewerState{MyVote: VOTE_DOWN},
+		},
+		{
+			name:         "Author",
+			status:       POST_STATUS_PUBLISHED,
+			request:      postDetailRequest{PostId: "post-1", viewerId: "author-1"},
+			expectCode:   http.StatusOK,
+			expectViewer: viewerState{IsAuthor: true},
+		},
+		{
+			name:         "Moderator",
+			status:       POST_STATUS_PUBLISHED,
+			request:      postDetailRequest{PostId: "post-1", viewerId: "viewer-1", viewerRoles: moderator},
+			expectCode:   http.StatusOK,
+			expectViewer: viewerState{CanModerate: true},
+		},
+		{
+			name:       "Missing post",
+			status:     POST_STATUS_PUBLISHED,
+			request:    postDetailRequest{PostId: "post-2"},
+			expectCode: http.StatusNotFound,
+		},
+		{
+			name:       "Taken down post is hidden from everyone",
+			status:     POST_STATUS_TAKE_DOWN,
+			request:    postDetailRequest{PostId: "post-1", viewerId: "author-1", viewerRoles: moderator},
+			expectCode: http.StatusUnavailableForLegalReasons,
+		},
+		{
+			name:       "Pending post is hidden from other people",
+			status:     POST_STATUS_PENDING,
+			request:    postDetailRequest{PostId: "post-1", viewerId: "viewer-1", viewerRoles: member},
+			expectCode: http.StatusNotFound,
+		},
+		{
+			name:         "Pending post is shown to its author",
+			status:       POST_STATUS_PENDING,
+			request:      postDetailRequest{PostId: "post-1", viewerId: "author-1"},
+			expectCode:   http.StatusOK,
+			expectViewer: viewerState{IsAuthor: true},
+		},
+		{
+			name:         "Rejected post is shown to moderators",
+			status:       POST_STATUS_REJECTED,
+			request:      postDetailRequest{PostId: "post-1", viewerId: "viewer-1", viewerRoles: moderator},
+			expectCode:   http.StatusOK,
+			expectViewer: viewerState{CanModerate: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &detailRepository{post: postWithViewer{
+				feedPost: feedPost{id: "post-1", caption: "roast my code", user: user.Author{Id: "author-1"}},
+				status:   tt.status,
+				myVote:   tt.myVote,
+			}}
+			service := NewService(repo, validator.New(), nil, DEFAULT_REACTIONS, nil, "")
+
+			resp, err := service.findById(context.Background(), tt.request)
+			assert.Equal(t, tt.expectCode, resp.Code)
+			assert.Equal(t, tt.request.viewerId, repo.viewerId)
+			if tt.expectCode != http.StatusOK {
+				assert.Error(t, err)
+				assert.Empty(t, resp.Data.Post.Caption, "nothing of the post is sent")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "roast my code", resp.Data.Post.Caption)
+			assert.Equal(t, tt.expectViewer, resp.Data.Viewer)
+		})
+	}
+}
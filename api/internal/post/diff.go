@@ -0,0 +1,140 @@
+package post
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	DIFF_EQUAL  = "equal"
+	DIFF_INSERT = "insert"
+	DIFF_DELETE = "delete"
+
+	// longest common subsequence table is len(a) * len(b), past this the whole text is replaced.
+	// captions are capped at 5000 characters but this is on a public route, keep the table small
+	MAX_DIFF_CELLS = 250_000
+)
+
+type diffChunk struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// tokenize split text into words and the whitespace between them, so a diff never cut a word in half
+// and joining the tokens give back the exact text
+func tokenize(text string) []string {
+	tokens := []string{}
+	start := 0
+	runes := []rune(text)
+	for i := 1; i <= len(runes); i++ {
+		if i == len(runes) || unicode.IsSpace(runes[i]) != unicode.IsSpace(runes[i-1]) {
+			tokens = append(tokens, string(runes[start:i]))
+			start = i
+		}
+	}
+	return tokens
+}
+
+// diffText return the word level changes that turn from into to, consecutive tokens of the same op are merged
+func diffText(from string, to string) []diffChunk {
+	a, b := tokenize(from), tokenize(to)
+	chunks := []diffChunk{}
+	add := func(op string, text string) {
+		if text == "" {
+			return
+		}
+		if last := len(chunks) - 1; last >= 0 && chunks[last].Op == op {
+			chunks[last].Text += text
+			return
+		}
+		chunks = append(chunks, diffChunk{Op: op, Text: text})
+	}
+
+	// unchanged start and end are not part of the table, a small edit of a long caption stay cheap
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		add(DIFF_EQUAL, a[prefix])
+		prefix++
+	}
+	suffix := []string{}
+	for len(a) > prefix && len(b) > prefix && a[len(a)-1] == b[len(b)-1] {
+		suffix = append(suffix, a[len(a)-1])
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	a, b = a[prefix:], b[prefix:]
+
+	if len(a)*len(b) > MAX_DIFF_CELLS {
+		add(DIFF_DELETE, strings.Join(a, ""))
+		add(DIFF_INSERT, strings.Join(b, ""))
+	} else {
+		diffTokens(a, b, add)
+	}
+	for i := len(suffix) - 1; i >= 0; i-- {
+		add(DIFF_EQUAL, suffix[i])
+	}
+	return chunks
+}
+
+// diffTokens walk the longest common subsequence of a and b and report every token to add
+func diffTokens(a []string, b []string, add func(op string, text string)) {
+
+	// lcs[i][j] is the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			add(DIFF_EQUAL, a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add(DIFF_DELETE, a[i])
+			i++
+		default:
+			add(DIFF_INSERT, b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		add(DIFF_DELETE, a[i])
+	}
+	for ; j < len(b); j++ {
+		add(DIFF_INSERT, b[j])
+	}
+}
+
+// diffMedia return the media urls only in to and only in from
+func diffMedia(from []string, to []string) ([]string, []string) {
+	inFrom := map[string]bool{}
+	for _, url := range from {
+		inFrom[url] = true
+	}
+	inTo := map[string]bool{}
+	added := []string{}
+	for _, url := range to {
+		inTo[url] = true
+		if !inFrom[url] {
+			added = append(added, url)
+		}
+	}
+	removed := []string{}
+	for _, url := range from {
+		if !inTo[url] {
+			removed = append(removed, url)
+		}
+	}
+	return added, removed
+}
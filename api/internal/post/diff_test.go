@@ -0,0 +1,131 @@
+package post
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{text: "", expected: []string{}},
+		{text: "roast", expected: []string{"roast"}},
+		{text: "roast my  code", expected: []string{"roast", " ", "my", "  ", "code"}},
+		{text: " lead and trail\n", expected: []string{" ", "lead", " ", "and", " ", "trail", "\n"}},
+		{text: "héllo\twörld", expected: []string{"héllo", "\t", "wörld"}},
+	}
+	for _, tt := range tests {
+		tokens := tokenize(tt.text)
+		assert.Equal(t, tt.expected, tokens, tt.text)
+		assert.Equal(t, tt.text, strings.Join(tokens, ""))
+	}
+}
+
+// applyDiff rebuild both texts out of the chunks
+func applyDiff(chunks []diffChunk) (string, string) {
+	from, to := "", ""
+	for _, chunk := range chunks {
+		if chunk.Op != DIFF_INSERT {
+			from += chunk.Text
+		}
+		if chunk.Op != DIFF_DELETE {
+			to += chunk.Text
+		}
+	}
+	return from, to
+}
+
+func TestDiffText(t *testing.T) {
+	long := strings.Repeat("word ", 2000)
+	tests := []struct {
+		name     string
+		from     string
+		to       string
+		expected []diffChunk
+	}{
+		{
+			name:     "Unchanged",
+			from:     "roast my code",
+			to:       "roast my code",
+			expected: []diffChunk{{Op: DIFF_EQUAL, Text: "roast my code"}},
+		},
+		{
+			name: "Word inserted",
+			from: "hello world",
+			to:   "hello big world",
+			expected: []diffChunk{
+				{Op: DIFF_EQUAL, Text: "hello "},
+				{Op: DIFF_INSERT, Text: "big "},
+				{Op: DIFF_EQUAL, Text: "world"},
+			},
+		},
+		{
+			name: "Word deleted",
+			from: "hello big world",
+			to:   "hello world",
+			expected: []diffChunk{
+				{Op: DIFF_EQUAL, Text: "hello "},
+				{Op: DIFF_DELETE, Text: "big "},
+				{Op: DIFF_EQUAL, Text: "world"},
+			},
+		},
+		{
+			name: "Word replaced",
+			from: "the cat sat",
+			to:   "the dog sat",
+			expected: []diffChunk{
+				{Op: DIFF_EQUAL, Text: "the "},
+				{Op: DIFF_DELETE, Text: "cat"},
+				{Op: DIFF_INSERT, Text: "dog"},
+				{Op: DIFF_EQUAL, Text: " sat"},
+			},
+		},
+		{
+			name:     "From empty",
+			from:     "",
+			to:       "fresh caption",
+			expected: []diffChunk{{Op: DIFF_INSERT, Text: "fresh caption"}},
+		},
+		{
+			name:     "To empty",
+			from:     "old caption",
+			to:       "",
+			expected: []diffChunk{{Op: DIFF_DELETE, Text: "old caption"}},
+		},
+		{
+			name: "Small edit of a long caption is diffed word by word",
+			from: long + "old " + long,
+			to:   long + "new " + long,
+			expected: []diffChunk{
+				{Op: DIFF_EQUAL, Text: long},
+				{Op: DIFF_DELETE, Text: "old"},
+				{Op: DIFF_INSERT, Text: "new"},
+				{Op: DIFF_EQUAL, Text: " " + long},
+			},
+		},
+		{
+			name: "Change past the table budget replace the whole middle",
+			from: "start " + strings.Repeat("a ", 300) + "end",
+			to:   "start " + strings.Repeat("b ", 300) + "end",
+			expected: []diffChunk{
+				{Op: DIFF_EQUAL, Text: "start "},
+				{Op: DIFF_DELETE, Text: strings.TrimSuffix(strings.Repeat("a ", 300), " ")},
+				{Op: DIFF_INSERT, Text: strings.TrimSuffix(strings.Repeat("b ", 300), " ")},
+				{Op: DIFF_EQUAL, Text: " end"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := diffText(tt.from, tt.to)
+			assert.Equal(t, tt.expected, chunks)
+			from, to := applyDiff(chunks)
+			assert.Equal(t, tt.from, from)
+			assert.Equal(t, tt.to, to)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package post
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// feedRepository only answer feed, any other repository call panic on the nil interface
+type feedRepository struct {
+	repository
+	posts []feedPost
+	query feedQuery
+}
+
+func (repo *feedRepository) feed(ctx context.Context, query feedQuery) ([]feedPost, error) {
+	repo.query = query
+	return repo.posts, nil
+}
+
+func TestFeedCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor feedCursor
+	}{
+		{name: "New", cursor: feedCursor{Sort: FEED_SORT_NEW, Id: "0190b6f2-7c8a-7000-8000-000000000001"}},
+		{name: "Ranked", cursor: feedCursor{Sort: FEED_SORT_HOT, Window: "week", Id: "0190b6f2-7c8a-7000-8000-000000000002", Rank: 39_123_456_789}},
+		{name: "Negative rank", cursor: feedCursor{Sort: FEED_SORT_TOP, Id: "0190b6f2-7c8a-7000-8000-000000000003", Rank: -12}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := decodeFeedCursor(encodeFeedCursor(tt.cursor))
+			require.NoError(t, err)
+			assert.Equal(t, tt.cursor, decoded)
+		})
+	}
+
+	for _, value := range []string{"not base64!", "bm90IGpzb24", "e30"} {
+		_, err := decodeFeedCursor(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestServiceImpl_feed(t *testing.T) {
+	posts := []feedPost{
+		{id: "post-3", rank: 30},
+		{id: "post-2", rank: 20},
+		{id: "post-1", rank: 10},
+	}
+	tests := []struct {
+		name         string
+		request      feedRequest
+		expectCode   int
+		expectAfter  feedCursor
+		expectPosts  int
+		expectCursor feedCursor
+	}{
+		{
+			name:         "First page",
+			request:      feedRequest{Sort: FEED_SORT_HOT, Limit: 2},
+			expectCode:   http.StatusOK,
+			expectPosts:  2,
+			expectCursor: feedCursor{Sort: FEED_SORT_HOT, Id: "post-2", Rank: 20},
+		},
+		{
+			name:         "Next page",
+			request:      feedRequest{Sort: FEED_SORT_HOT, Limit: 2, Cursor: encodeFeedCursor(feedCursor{Sort: FEED_SORT_HOT, Id: "post-4", Rank: 40})},
+			expectCode:   http.StatusOK,
+			expectAfter:  feedCursor{Sort: FEED_SORT_HOT, Id: "post-4", Rank: 40},
+			expectPosts:  2,
+			expectCursor: feedCursor{Sort: FEED_SORT_HOT, Id: "post-2", Rank: 20},
+		},
+		{
+			name:        "Last page",
+			request:     feedRequest{Limit: 5},
+			expectCode:  http.StatusOK,
+			expectPosts: 3,
+		},
+		{
+			name:       "Cursor of other sort",
+			request:    feedRequest{Sort: FEED_SORT_TOP, Cursor: encodeFeedCursor(feedCursor{Sort: FEED_SORT_HOT, Id: "post-4", Rank: 40})},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Cursor of other window",
+			request:    feedRequest{Sort: FEED_SORT_HOT, Window: "day", Cursor: encodeFeedCursor(feedCursor{Sort: FEED_SORT_HOT, Window: "week", Id: "post-4", Rank: 40})},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Default sort reject cursor of ranked sort",
+			request:    feedRequest{Cursor: encodeFeedCursor(feedCursor{Sort: FEED_SORT_BEST, Id: "post-4", Rank: 40})},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Broken cursor",
+			request:    feedRequest{Cursor: "broken"},
+			expectCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &feedRepository{posts: posts}
+			service := NewService(repo, validator.New(), nil, DEFAULT_REACTIONS, nil, "")
+
+			resp, err := service.feed(context.Background(), tt.request)
+			assert.Equal(t, tt.expectCode, resp.Code)
+			if tt.expectCode != http.StatusOK {
+				assert.Error(t, err)
+				assert.Empty(t, repo.query.sort, "repository must not be queried")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectAfter, repo.query.after)
+			assert.Len(t, resp.Data.Posts, tt.expectPosts)
+			if tt.expectCursor.Id == "" {
+				assert.Empty(t, resp.Data.NextCursor)
+				return
+			}
+			next, err := decodeFeedCursor(resp.Data.NextCursor)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectCursor, next)
+		})
+	}
+}
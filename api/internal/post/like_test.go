@@ -0,0 +1,172 @@
+package post
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apperror "github.com/zulfikarrosadi/code_roast/internal/app-error"
+)
+
+// likeRepository keep the likes in memory, any other repository call panic on the nil interface
+type likeRepository struct {
+	repository
+	votes map[string]int
+	err   error
+}
+
+func (repo *likeRepository) state(userId string, changed bool) voteState {
+	state := voteState{value: repo.votes[userId], changed: changed}
+	for _, value := range repo.votes {
+		if value == VOTE_UP {
+			state.upvotes++
+		} else if value == VOTE_DOWN {
+			state.downvotes++
+		}
+	}
+	state.score = state.upvotes - state.downvotes
+	return state
+}
+
+func (repo *likeRepository) vote(ctx context.Context, data newVote) (voteState, error) {
+	if repo.err != nil {
+		return voteState{}, repo.err
+	}
+	current, ok := repo.votes[data.userId]
+	if data.value == VOTE_RETRACT {
+		delete(repo.votes, data.userId)
+		return repo.state(data.userId, ok), nil
+	}
+	repo.votes[data.userId] = data.value
+	return repo.state(data.userId, current != data.value), nil
+}
+
+func (repo *likeRepository) unlike(ctx context.Context, postId string, userId string) (voteState, error) {
+	if repo.err != nil {
+		return voteState{}, repo.err
+	}
+	changed := repo.votes[userId] == VOTE_UP
+	if changed {
+		delete(repo.votes, userId)
+	}
+	return repo.state(userId, changed), nil
+}
+
+func TestServiceImpl_like(t *testing.T) {
+	tests := []struct {
+		name        string
+		votes       map[string]int
+		expectCode  int
+		expectCount int
+	}{
+		{name: "First like", votes: map[string]int{"other": VOTE_UP}, expectCode: http.StatusCreated, expectCount: 2},
+		{name: "Liking again change nothing", votes: map[string]int{"user-1": VOTE_UP}, expectCode: http.StatusOK, expectCount: 1},
+		{name: "Like over a downvote flip it", votes: map[string]int{"user-1": VOTE_DOWN}, expectCode: http.StatusCreated, expectCount: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewService(&likeRepository{votes: tt.votes}, validator.New(), nil, DEFAULT_REACTIONS, nil, "")
+
+			resp, err := service.like(context.Background(), postActionRequest{UserId: "user-1", PostId: "post-1"})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectCode, resp.Code)
+			assert.Equal(t, likeDetail{PostId: "post-1", LikeCount: tt.expectCount, LikedByMe: true}, resp.Data.Post)
+		})
+	}
+}
+
+func TestServiceImpl_unlike(t *testing.T) {
+	tests := []struct {
+		name        string
+		votes       map[string]int
+		expectCount int
+		expectVotes map[string]int
+	}{
+		{name: "Liked post", votes: map[string]int{"user-1": VOTE_UP, "other": VOTE_UP}, expectCount: 1, expectVotes: map[string]int{"other": VOTE_UP}},
+		{name: "Unliking again change nothing", votes: map[string]int{"other": VOTE_UP}, expectCount: 1, expectVotes: map[string]int{"other": VOTE_UP}},
+		{name: "Downvote is left alone", votes: map[string]int{"user-1": VOTE_DOWN}, expectCount: 0, expectVotes: map[string]int{"user-1": VOTE_DOWN}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &likeRepository{votes: tt.votes}
+			service := NewService(repo, validator.New(), nil, DEFAULT_REACTIONS, nil, "")
+
+			resp, err := service.unlike(context.Background(), postActionRequest{UserId: "user-1", PostId: "post-1"})
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, likeDetail{PostId: "post-1", LikeCount: tt.expectCount}, resp.Data.Post)
+			assert.Equal(t, tt.expectVotes, repo.votes)
+		})
+	}
+}
+
+func TestServiceImpl_likeUnavailablePost(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		expectCode int
+	}{
+		{name: "Missing or not yet published", err: apperror.New(http.StatusNotFound, "post not found", nil), expectCode: http.StatusNotFound},
+		{name: "Taken down", err: apperror.New(http.StatusUnavailableForLegalReasons, "this post has been removed by moderators", nil), expectCode: http.StatusUnavailableForLegalReasons},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewService(&likeRepository{err: tt.err}, validator.New(), nil, DEFAULT_REACTIONS, nil, "")
+			request := postActionRequest{UserId: "user-1", PostId: "post-1"}
+
+			resp, err := service.like(context.Background(), request)
+			assert.Error(t, err)
+			assert.Equal(t, tt.expectCode, resp.Code)
+
+			resp, err = service.unlike(context.Background(), request)
+			assert.Error(t, err)
+			assert.Equal(t, tt.expectCode, resp.Code)
+		})
+	}
+}
+
+func TestLockVotablePost(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     string
+		expectCode int
+	}{
+		{name: "Published", status: POST_STATUS_PUBLISHED},
+		{name: "Missing", expectCode: http.StatusNotFound},
+		{name: "Waiting for approval", status: POST_STATUS_PENDING, expectCode: http.StatusNotFound},
+		{name: "Rejected", status: POST_STATUS_REJECTED, expectCode: http.StatusNotFound},
+		{name: "Taken down", status: POST_STATUS_TAKE_DOWN, expectCode: http.StatusUnavailableForLegalReasons},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, sqlMock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			sqlMock.ExpectBegin()
+			rows := sqlmock.NewRows([]string{"status"})
+			if tt.status != "" {
+				rows.AddRow(tt.status)
+			}
+			sqlMock.ExpectQuery(regexp.QuoteMeta("SELECT status FROM posts WHERE id = ? FOR UPDATE")).
+				WithArgs("post-1").
+				WillReturnRows(rows)
+			tx, err := db.Begin()
+			require.NoError(t, err)
+
+			err = lockVotablePost(context.Background(), tx, "post-1")
+			if tt.expectCode == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var appError *apperror.AppError
+			require.ErrorAs(t, err, &appError)
+			assert.Equal(t, tt.expectCode, appError.Code)
+		})
+	}
+}
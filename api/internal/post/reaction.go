@@ -0,0 +1,87 @@
+package post
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	// validator tag of fields holding a reaction key, apperror.HandlerValidatorError turn it into message
+	REACTION_TAG = "reaction"
+)
+
+// Reaction is an emoji people can put on posts and comments, Key is what clients send and what is stored
+type Reaction struct {
+	Key   string `json:"key"`
+	Emoji string `json:"emoji"`
+}
+
+// ReactionCatalog is the reactions on offer in the order clients should show them.
+// removing a reaction hide its counts, the stored reactions are kept in case it come back
+type ReactionCatalog []Reaction
+
+var DEFAULT_REACTIONS = ReactionCatalog{
+	{Key: "roast", Emoji: "🔥"},
+	{Key: "laugh", Emoji: "😂"},
+	{Key: "mindblown", Emoji: "🤯"},
+	{Key: "dead", Emoji: "💀"},
+}
+
+var reactionKeyPattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// ParseReactionCatalog read reactions written as key:emoji pairs separated by comma e.g roast:🔥,laugh:😂
+func ParseReactionCatalog(value string) (ReactionCatalog, error) {
+	catalog := ReactionCatalog{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, emoji, ok := strings.Cut(pair, ":")
+		key, emoji = strings.TrimSpace(key), strings.TrimSpace(emoji)
+		if !ok || emoji == "" {
+			return nil, fmt.Errorf("reaction %q must be written as key:emoji", pair)
+		}
+		if !reactionKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("reaction key %q can only contain lowercase letters, numbers and underscore", key)
+		}
+		if catalog.Has(key) {
+			return nil, fmt.Errorf("reaction key %q is listed twice", key)
+		}
+		catalog = append(catalog, Reaction{Key: key, Emoji: emoji})
+	}
+	if len(catalog) == 0 {
+		return nil, errors.New("reaction catalog is empty")
+	}
+	return catalog, nil
+}
+
+func (catalog ReactionCatalog) Has(key string) bool {
+	for _, reaction := range catalog {
+		if reaction.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Counts drop reactions no longer in the catalog and fill the missing ones with zero,
+// so clients always get the same keys
+func (catalog ReactionCatalog) Counts(stored map[string]int) map[string]int {
+	counts := map[string]int{}
+	for _, reaction := range catalog {
+		counts[reaction.Key] = stored[reaction.Key]
+	}
+	return counts
+}
+
+// RegisterReactionCatalog make the reaction tag of v accept only keys of catalog
+func RegisterReactionCatalog(v *validator.Validate, catalog ReactionCatalog) {
+	v.RegisterValidation(REACTION_TAG, func(fl validator.FieldLevel) bool {
+		return catalog.Has(fl.Field().String())
+	})
+}
@@ -0,0 +1,62 @@
+package post
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReactionCatalog(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		expected  ReactionCatalog
+		expectErr bool
+	}{
+		{
+			name:     "Pairs in order",
+			value:    "roast:🔥,laugh:😂",
+			expected: ReactionCatalog{{Key: "roast", Emoji: "🔥"}, {Key: "laugh", Emoji: "😂"}},
+		},
+		{
+			name:     "Spaces and empty pairs are ignored",
+			value:    " roast : 🔥 ,, dead_2:💀, ",
+			expected: ReactionCatalog{{Key: "roast", Emoji: "🔥"}, {Key: "dead_2", Emoji: "💀"}},
+		},
+		{name: "Empty", value: " , ", expectErr: true},
+		{name: "Missing emoji", value: "roast:", expectErr: true},
+		{name: "Missing separator", value: "roast", expectErr: true},
+		{name: "Uppercase key", value: "Roast:🔥", expectErr: true},
+		{name: "Key too long", value: "abcdefghijklmnopqrstuvwxyz0123456:🔥", expectErr: true},
+		{name: "Duplicate key", value: "roast:🔥,roast:😂", expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalog, err := ParseReactionCatalog(tt.value)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, catalog)
+		})
+	}
+}
+
+func TestReactionCatalog_Counts(t *testing.T) {
+	catalog := ReactionCatalog{{Key: "roast", Emoji: "🔥"}, {Key: "laugh", Emoji: "😂"}}
+	tests := []struct {
+		name     string
+		stored   map[string]int
+		expected map[string]int
+	}{
+		{name: "Nothing stored", stored: nil, expected: map[string]int{"roast": 0, "laugh": 0}},
+		{name: "Missing key is zero", stored: map[string]int{"roast": 3}, expected: map[string]int{"roast": 3, "laugh": 0}},
+		{name: "Key out of the catalog is hidden", stored: map[string]int{"laugh": 2, "retired": 7}, expected: map[string]int{"roast": 0, "laugh": 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, catalog.Counts(tt.stored))
+		})
+	}
+}
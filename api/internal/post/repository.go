@@ -3,8 +3,11 @@ package post
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 
 	apperror "github.com/zulfikarrosadi/code_roast/internal/app-error"
@@ -40,12 +43,14 @@ type post struct {
 }
 
 type newPost struct {
-	id        string
-	caption   string
+	id      string
+	caption string
+	// POST_STATUS_PENDING when the subforum require approval
+	status    string
 	mediaUrl  []string
 	createdAt int64
 	updatedAt sql.NullInt64
-	user      user.User
+	user      user.Author
 	subforum  subforum.Subforum
 }
 
@@ -57,6 +62,8 @@ const (
 	POST_STATUS_PUBLISHED = "published"
 	POST_STATUS_PENDING   = "pending"
 	POST_STATUS_TAKE_DOWN = "take_down"
+	// turned down from the moderation queue, only the author and moderators can still see it
+	POST_STATUS_REJECTED = "rejected"
 )
 
 func (repo *RepositoryImpl) create(
@@ -88,10 +95,23 @@ func (repo *RepositoryImpl) create(
 		}
 	}()
 
+	var requireApproval bool
+	err = tx.QueryRowContext(ctx, "SELECT require_approval FROM subforums WHERE id = ?", data.subforumId).Scan(&requireApproval)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = apperror.New(http.StatusNotFound, "subforum not found", err)
+			return createPostResult{}, err
+		}
+		return createPostResult{}, fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	status := POST_STATUS_PUBLISHED
+	if requireApproval {
+		status = POST_STATUS_PENDING
+	}
 	_, err = tx.ExecContext(
 		ctx,
-		"INSERT INTO posts (id, caption, created_at, user_id, subforum_id) VALUES (?,?,?,?,?)",
-		data.id, data.caption, data.createdAt, data.userId, data.subforumId,
+		"INSERT INTO posts (id, caption, status, created_at, user_id, subforum_id) VALUES (?,?,?,?,?,?)",
+		data.id, data.caption, status, data.createdAt, data.userId, data.subforumId,
 	)
 	if err != nil {
 		return createPostResult{}, fmt.Errorf("repository: fail to create new posts %w", err)
@@ -110,7 +130,7 @@ func (repo *RepositoryImpl) create(
 	rows, err := tx.QueryContext(
 		ctx,
 		`
-		SELECT p.id, p.caption, p.updated_at, pm.media_url, u.id AS user_id, u.fullname, sf.id AS subforum_id, sf.name AS subforum_name
+		SELECT p.id, p.caption, p.updated_at, pm.media_url, u.id AS user_id, u.fullname, u.handle, COALESCE(u.avatar, '') AS avatar, sf.id AS subforum_id, sf.name AS subforum_name
 		FROM posts p
 		JOIN users u
 		ON p.user_id = u.id
@@ -138,6 +158,8 @@ func (repo *RepositoryImpl) create(
 			&mediaURL,
 			&np.user.Id,
 			&np.user.Fullname,
+			&np.user.Handle,
+			&np.user.Avatar,
 			&np.subforum.Id,
 			&np.subforum.Name,
 		); err != nil {
@@ -158,12 +180,10 @@ func (repo *RepositoryImpl) create(
 		post: newPost{
 			id:        data.id,
 			caption:   data.caption,
+			status:    status,
 			mediaUrl:  np.mediaUrl,
 			createdAt: data.createdAt,
-			user: user.User{
-				Id:       np.user.Id,
-				Fullname: np.user.Fullname,
-			},
+			user:      np.user,
 			subforum: subforum.Subforum{
 				Id:   np.subforum.Id,
 				Name: np.subforum.Name,
@@ -191,19 +211,95 @@ func (repo *RepositoryImpl) takeDown(ctx context.Context, postId string, updated
 	return nil
 }
 
-type newLike struct {
+const (
+	VOTE_UP      = 1
+	VOTE_DOWN    = -1
+	VOTE_RETRACT = 0
+)
+
+// a like is an upvote, likes and votes share the likes table
+type newVote struct {
 	userId    string
 	postId    string
+	value     int
 	createdAt int64
 }
 
-func (repo *RepositoryImpl) like(
-	ctx context.Context,
-	data newLike,
-) (int, error) {
+// voteTally is stored on the post so ranking doesn't count votes on every feed request
+type voteTally struct {
+	upvotes   int
+	downvotes int
+	// upvotes - downvotes
+	score int
+}
+
+// voteState is the tally of a post after the change, the viewer vote and whether the change did anything
+type voteState struct {
+	voteTally
+	value   int
+	changed bool
+}
+
+// lockVotablePost make sure the post can be voted and keep it that way until tx is done
+func lockVotablePost(ctx context.Context, tx *sql.Tx, postId string) error {
+	var status string
+	err := tx.QueryRowContext(
+		ctx,
+		"SELECT status FROM posts WHERE id = ? FOR UPDATE",
+		postId,
+	).Scan(&status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return apperror.New(http.StatusNotFound, "post not found", err)
+		}
+		return fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	switch status {
+	case POST_STATUS_TAKE_DOWN:
+		return apperror.New(http.StatusUnavailableForLegalReasons, "this post has been removed by moderators", nil)
+	case POST_STATUS_PENDING, POST_STATUS_REJECTED:
+		return apperror.New(http.StatusNotFound, "post not found", nil)
+	}
+	return nil
+}
+
+// refreshPostScore recount the votes instead of incrementing, so a missed update never stick.
+// the rank columns the feed sort by are generated from the tally, so they are refreshed by the same update
+func refreshPostScore(ctx context.Context, tx *sql.Tx, postId string) (voteTally, error) {
+	_, err := tx.ExecContext(
+		ctx,
+		`
+		UPDATE posts
+		SET upvotes = (SELECT COUNT(post_id) FROM likes WHERE post_id = ? AND value = ?),
+		downvotes = (SELECT COUNT(post_id) FROM likes WHERE post_id = ? AND value = ?),
+		score = upvotes - downvotes
+		WHERE id = ?`,
+		postId,
+		VOTE_UP,
+		postId,
+		VOTE_DOWN,
+		postId,
+	)
+	if err != nil {
+		return voteTally{}, fmt.Errorf("repository: failed to update post score %w", err)
+	}
+	tally := voteTally{}
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT upvotes, downvotes, score FROM posts WHERE id = ?",
+		postId,
+	).Scan(&tally.upvotes, &tally.downvotes, &tally.score)
+	if err != nil {
+		return voteTally{}, fmt.Errorf("repository: failed to get post score, %w", err)
+	}
+	return tally, nil
+}
+
+// changeVote run query against the likes of the post and return the post tally after it
+func (repo *RepositoryImpl) changeVote(ctx context.Context, postId string, userId string, query string, args ...interface{}) (voteState, error) {
 	tx, err := repo.DB.BeginTx(ctx, &sql.TxOptions{})
 	if err != nil {
-		return 0, fmt.Errorf("repository: failed to begin transaction %w", err)
+		return voteState{}, fmt.Errorf("repository: failed to begin transaction %w", err)
 	}
 	defer func() {
 		// handle panic for extream case like driver fails
@@ -215,32 +311,998 @@ func (repo *RepositoryImpl) like(
 		}
 	}()
 
-	rows, err := tx.ExecContext(
+	err = lockVotablePost(ctx, tx, postId)
+	if err != nil {
+		return voteState{}, err
+	}
+	rows, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return voteState{}, fmt.Errorf("repository: failed to change vote of post %w", err)
+	}
+	rowsAffected, err := rows.RowsAffected()
+	if err != nil {
+		return voteState{}, fmt.Errorf("repository: failed to get affected rows %w", err)
+	}
+	state := voteState{
+		changed: rowsAffected > 0,
+	}
+	state.voteTally, err = refreshPostScore(ctx, tx, postId)
+	if err != nil {
+		return voteState{}, err
+	}
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT COALESCE((SELECT value FROM likes WHERE post_id = ? AND user_id = ?), 0)",
+		postId,
+		userId,
+	).Scan(&state.value)
+	if err != nil {
+		return voteState{}, fmt.Errorf("repository: failed to get vote, %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return voteState{}, fmt.Errorf("repository: failed to commit transaction %w", err)
+	}
+	return state, nil
+}
+
+// vote is idempotent, voting the same value twice keep one vote and VOTE_RETRACT remove any vote
+func (repo *RepositoryImpl) vote(ctx context.Context, data newVote) (voteState, error) {
+	if data.value == VOTE_RETRACT {
+		return repo.changeVote(
+			ctx,
+			data.postId,
+			data.userId,
+			"DELETE FROM likes WHERE post_id = ? AND user_id = ?",
+			data.postId,
+			data.userId,
+		)
+	}
+	return repo.changeVote(
 		ctx,
-		"INSERT INTO likes (post_id, user_id, created_at)  VALUES (?,?,?)",
 		data.postId,
 		data.userId,
+		"INSERT INTO likes (post_id, user_id, value, created_at) VALUES (?,?,?,?) ON DUPLICATE KEY UPDATE value = VALUES(value)",
+		data.postId,
+		data.userId,
+		data.value,
 		data.createdAt,
 	)
+}
+
+// unlike only remove an upvote, a downvote is left alone
+func (repo *RepositoryImpl) unlike(ctx context.Context, postId string, userId string) (voteState, error) {
+	return repo.changeVote(
+		ctx,
+		postId,
+		userId,
+		"DELETE FROM likes WHERE post_id = ? AND user_id = ? AND value = ?",
+		postId,
+		userId,
+		VOTE_UP,
+	)
+}
+
+type newReaction struct {
+	postId    string
+	userId    string
+	reaction  string
+	createdAt int64
+}
+
+// reactions of many posts in one query, keyed by post id then reaction key
+func (repo *RepositoryImpl) findReactions(ctx context.Context, postIds []interface{}) (map[string]map[string]int, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(postIds)), ",")
+	rows, err := repo.DB.QueryContext(
+		ctx,
+		fmt.Sprintf("SELECT post_id, reaction, COUNT(user_id) FROM post_reactions WHERE post_id IN (%s) GROUP BY post_id, reaction", placeholders),
+		postIds...,
+	)
 	if err != nil {
-		return 0, fmt.Errorf("repository: failed to add new like to post %w", err)
+		return nil, fmt.Errorf("repository: failed to get post reactions %w", err)
 	}
-	rowsAffected, err := rows.RowsAffected()
-	if err != nil || rowsAffected == 0 {
-		return 0, fmt.Errorf("repository: failed to add new like (rows affected 0) %w", err)
+	defer rows.Close()
+
+	reactions := map[string]map[string]int{}
+	for rows.Next() {
+		var postId, reaction string
+		var count int
+		if err := rows.Scan(&postId, &reaction, &count); err != nil {
+			return nil, fmt.Errorf("repository: failed to scan post reactions %w", err)
+		}
+		if reactions[postId] == nil {
+			reactions[postId] = map[string]int{}
+		}
+		reactions[postId][reaction] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository: failed to read post reactions %w", err)
+	}
+	return reactions, nil
+}
+
+// changeReaction run query against the reactions of the post and return its reaction counts after it
+func (repo *RepositoryImpl) changeReaction(ctx context.Context, postId string, query string, args ...interface{}) (map[string]int, error) {
+	tx, err := repo.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to begin transaction %w", err)
+	}
+	defer func() {
+		// handle panic for extream case like driver fails
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// reacting follow the same rule as voting, only published posts
+	err = lockVotablePost(ctx, tx, postId)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to change reaction to post %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to commit transaction %w", err)
 	}
-	type newLike struct {
-		count int
+	reactions, err := repo.findReactions(ctx, []interface{}{postId})
+	if err != nil {
+		return nil, err
 	}
-	likeCount := &newLike{}
+	return reactions[postId], nil
+}
+
+// react replace the reaction the user already put on the post, one reaction per user per post
+func (repo *RepositoryImpl) react(ctx context.Context, data newReaction) (map[string]int, error) {
+	return repo.changeReaction(
+		ctx,
+		data.postId,
+		"INSERT INTO post_reactions (post_id, user_id, reaction, created_at) VALUES (?,?,?,?) ON DUPLICATE KEY UPDATE reaction = VALUES(reaction), created_at = VALUES(created_at)",
+		data.postId,
+		data.userId,
+		data.reaction,
+		data.createdAt,
+	)
+}
+
+func (repo *RepositoryImpl) unreact(ctx context.Context, postId string, userId string) (map[string]int, error) {
+	return repo.changeReaction(
+		ctx,
+		postId,
+		"DELETE FROM post_reactions WHERE post_id = ? AND user_id = ?",
+		postId,
+		userId,
+	)
+}
+
+const (
+	FEED_SORT_NEW           = "new"
+	FEED_SORT_TOP           = "top"
+	FEED_SORT_HOT           = "hot"
+	FEED_SORT_CONTROVERSIAL = "controversial"
+	FEED_SORT_BEST          = "best"
+)
+
+type feedPost struct {
+	id        string
+	caption   string
+	createdAt int64
+	updatedAt sql.NullInt64
+	// set by the last edit of the author, take down only touch updatedAt
+	editedAt sql.NullInt64
+	mediaUrl []string
+	user     user.Author
+	subforum subforum.Subforum
+	votes    voteTally
+	// reaction key to count, keys out of the catalog are included
+	reactions map[string]int
+	// soft deleted comments are kept as placeholders but not counted
+	commentCount int
+	// the value the feed is sorted by, put in the cursor of the next page
+	rank int64
+}
+
+// feedQuery is one page of the feed, after is empty for the first page
+type feedQuery struct {
+	subforumId string
+	sort       string
+	after      feedCursor
+	limit      int
+	// only posts created at or after it, 0 is all time
+	since int64
+}
+
+// rankedOrder sort by column, keyset condition compare the ranking of the previous page last post
+func rankedOrder(column string) (string, string, string) {
+	return column, column + " DESC, p.id DESC", "(" + column + " < ? OR (" + column + " = ? AND p.id < ?))"
+}
+
+// every sort is keyed on the post id as tie breaker, uuid v7 grow with time so id order is age order.
+// the rank columns are generated by the database from the tally (see db.sql), scaled by a million
+// and rounded so the keyset compare exact integers and every sort walk its (status, rank) index:
+// hot is reddit style, 10x the score is worth 12.5 hours of freshness and negative score sink,
+// controversial rank many votes split evenly first, post voted only one way is not controversial at all,
+// best is the lower bound of the wilson score interval at 95% confidence, a few upvotes can't beat many good votes
+func feedOrder(sort string) (ranking string, order string, condition string) {
+	switch sort {
+	case FEED_SORT_TOP:
+		return rankedOrder("p.score")
+	case FEED_SORT_HOT:
+		return rankedOrder("p.hot_rank")
+	case FEED_SORT_CONTROVERSIAL:
+		return rankedOrder("p.controversial_rank")
+	case FEED_SORT_BEST:
+		return rankedOrder("p.best_rank")
+	default:
+		return "0", "p.id DESC", "p.id < ?"
+	}
+}
+
+func (repo *RepositoryImpl) feed(ctx context.Context, query feedQuery) ([]feedPost, error) {
+	ranking, order, condition := feedOrder(query.sort)
+	where := "p.status = ?"
+	args := []interface{}{POST_STATUS_PUBLISHED}
+	if query.subforumId != "" {
+		where += " AND p.subforum_id = ?"
+		args = append(args, query.subforumId)
+	}
+	if query.since > 0 {
+		where += " AND p.created_at >= ?"
+		args = append(args, query.since)
+	}
+	if query.after.Id != "" {
+		where += " AND " + condition
+		if query.sort == FEED_SORT_NEW {
+			args = append(args, query.after.Id)
+		} else {
+			args = append(args, query.after.Rank, query.after.Rank, query.after.Id)
+		}
+	}
+	args = append(args, query.limit)
+
+	rows, err := repo.DB.QueryContext(
+		ctx,
+		fmt.Sprintf(`
+		SELECT p.id, p.caption, p.created_at, p.updated_at, p.edited_at, u.id AS user_id, u.fullname, u.handle, COALESCE(u.avatar, '') AS avatar,
+		sf.id AS subforum_id, sf.name AS subforum_name, p.upvotes, p.downvotes, p.score, p.comment_count, %s AS ranking
+		FROM posts p
+		JOIN users u
+		ON p.user_id = u.id
+		JOIN subforums sf
+		ON p.subforum_id = sf.id
+		WHERE %s
+		ORDER BY %s
+		LIMIT ?`, ranking, where, order),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to get feed %w", err)
+	}
+	defer rows.Close()
+
+	posts := []feedPost{}
+	postIds := []interface{}{}
+	for rows.Next() {
+		fp := feedPost{}
+		if err := rows.Scan(
+			&fp.id,
+			&fp.caption,
+			&fp.createdAt,
+			&fp.updatedAt,
+			&fp.editedAt,
+			&fp.user.Id,
+			&fp.user.Fullname,
+			&fp.user.Handle,
+			&fp.user.Avatar,
+			&fp.subforum.Id,
+			&fp.subforum.Name,
+			&fp.votes.upvotes,
+			&fp.votes.downvotes,
+			&fp.votes.score,
+			&fp.commentCount,
+			&fp.rank,
+		); err != nil {
+			return nil, fmt.Errorf("repository: failed to scan feed %w", err)
+		}
+		posts = append(posts, fp)
+		postIds = append(postIds, fp.id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository: failed to read feed %w", err)
+	}
+	if len(posts) == 0 {
+		return posts, nil
+	}
+
+	media, err := repo.findMedia(ctx, postIds)
+	if err != nil {
+		return nil, err
+	}
+	reactions, err := repo.findReactions(ctx, postIds)
+	if err != nil {
+		return nil, err
+	}
+	for i := range posts {
+		posts[i].mediaUrl = media[posts[i].id]
+		posts[i].reactions = reactions[posts[i].id]
+	}
+	return posts, nil
+}
+
+// media of many posts in one query, keyed by post id
+func (repo *RepositoryImpl) findMedia(ctx context.Context, postIds []interface{}) (map[string][]string, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(postIds)), ",")
+	rows, err := repo.DB.QueryContext(
+		ctx,
+		fmt.Sprintf("SELECT post_id, media_url FROM post_media WHERE post_id IN (%s) ORDER BY id", placeholders),
+		postIds...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to get post media %w", err)
+	}
+	defer rows.Close()
+
+	media := map[string][]string{}
+	for rows.Next() {
+		var postId, mediaUrl string
+		if err := rows.Scan(&postId, &mediaUrl); err != nil {
+			return nil, fmt.Errorf("repository: failed to scan post media %w", err)
+		}
+		media[postId] = append(media[postId], mediaUrl)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository: failed to read post media %w", err)
+	}
+	return media, nil
+}
+
+type postWithViewer struct {
+	feedPost
+	status string
+	// VOTE_RETRACT when the viewer hasn't voted
+	myVote int
+	// empty when the viewer hasn't reacted
+	myReaction string
+}
+
+// findById return the post whatever its status, the caller decide what the viewer may see.
+// viewerId is empty for anonymous viewer
+func (repo *RepositoryImpl) findById(ctx context.Context, postId string, viewerId string) (postWithViewer, error) {
+	result := postWithViewer{}
+	err := repo.DB.QueryRowContext(
+		ctx,
+		`
+		SELECT p.id, p.caption, p.created_at, p.updated_at, p.edited_at, p.status, u.id AS user_id, u.fullname, u.handle, COALESCE(u.avatar, '') AS avatar,
+		sf.id AS subforum_id, sf.name AS subforum_name, p.upvotes, p.downvotes, p.score, p.comment_count,
+		COALESCE((SELECT l.value FROM likes l WHERE l.post_id = p.id AND l.user_id = ?), 0) AS my_vote,
+		COALESCE((SELECT r.reaction FROM post_reactions r WHERE r.post_id = p.id AND r.user_id = ?), '') AS my_reaction
+		FROM posts p
+		JOIN users u
+		ON p.user_id = u.id
+		JOIN subforums sf
+		ON p.subforum_id = sf.id
+		WHERE p.id = ?`,
+		viewerId,
+		viewerId,
+		postId,
+	).Scan(
+		&result.id,
+		&result.caption,
+		&result.createdAt,
+		&result.updatedAt,
+		&result.editedAt,
+		&result.status,
+		&result.user.Id,
+		&result.user.Fullname,
+		&result.user.Handle,
+		&result.user.Avatar,
+		&result.subforum.Id,
+		&result.subforum.Name,
+		&result.votes.upvotes,
+		&result.votes.downvotes,
+		&result.votes.score,
+		&result.commentCount,
+		&result.myVote,
+		&result.myReaction,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return postWithViewer{}, apperror.New(http.StatusNotFound, "post not found", err)
+		}
+		return postWithViewer{}, fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	media, err := repo.findMedia(ctx, []interface{}{result.id})
+	if err != nil {
+		return postWithViewer{}, err
+	}
+	result.mediaUrl = media[result.id]
+	reactions, err := repo.findReactions(ctx, []interface{}{result.id})
+	if err != nil {
+		return postWithViewer{}, err
+	}
+	result.reactions = reactions[result.id]
+	return result, nil
+}
+
+const (
+	MAX_POST_MEDIA = 10
+)
+
+// postEdit is what the author change, nil caption keep the current one
+type postEdit struct {
+	postId      string
+	userId      string
+	caption     *string
+	addMedia    []postMedia
+	removeMedia []string
+	editedAt    int64
+}
+
+// postRevision is a version of the post before an edit replaced it, revision 1 is the original post
+type postRevision struct {
+	revision int
+	caption  string
+	mediaUrl []string
+	// when this version was published, created_at of the post or the edit that made it
+	createdAt int64
+}
+
+// editablePost is what decide if an edit is allowed, the author, the status and the current media
+type editablePost struct {
+	userId string
+	status string
+	media  []string
+}
+
+// allowEdit check the edit against the post, addCount is how many media the edit add
+func (post editablePost) allowEdit(userId string, removeMedia []string, addCount int) error {
+	if post.userId != userId {
+		return apperror.New(http.StatusForbidden, "you can only edit your own post", nil)
+	}
+	if post.status == POST_STATUS_TAKE_DOWN {
+		return apperror.New(http.StatusUnavailableForLegalReasons, "this post has been removed by moderators", nil)
+	}
+	for _, url := range removeMedia {
+		if !slices.Contains(post.media, url) {
+			return apperror.New(http.StatusBadRequest, "media you want to remove is not in this post", nil)
+		}
+	}
+	mediaCount := len(post.media) - len(removeMedia) + addCount
+	if mediaCount < 1 || mediaCount > MAX_POST_MEDIA {
+		return apperror.New(http.StatusBadRequest, fmt.Sprintf("post must keep between 1 and %d media", MAX_POST_MEDIA), nil)
+	}
+	return nil
+}
+
+// editable load the post without locking it, so an edit can be refused before anything is uploaded
+func (repo *RepositoryImpl) editable(ctx context.Context, postId string) (editablePost, error) {
+	post := editablePost{media: []string{}}
+	err := repo.DB.QueryRowContext(ctx, "SELECT user_id, status FROM posts WHERE id = ?", postId).Scan(&post.userId, &post.status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return post, apperror.New(http.StatusNotFound, "post not found", err)
+		}
+		return post, fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	rows, err := repo.DB.QueryContext(ctx, "SELECT media_url FROM post_media WHERE post_id = ? ORDER BY id", postId)
+	if err != nil {
+		return post, fmt.Errorf("repository: failed to get post media %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var mediaUrl string
+		if err := rows.Scan(&mediaUrl); err != nil {
+			return post, fmt.Errorf("repository: failed to scan post media %w", err)
+		}
+		post.media = append(post.media, mediaUrl)
+	}
+	if err := rows.Err(); err != nil {
+		return post, fmt.Errorf("repository: failed to read post media %w", err)
+	}
+	return post, nil
+}
+
+// queueMediaDeletions hand media that never made it into a post to MediaCleaner
+func (repo *RepositoryImpl) queueMediaDeletions(ctx context.Context, mediaUrl []string, queuedAt int64) error {
+	if len(mediaUrl) == 0 {
+		return nil
+	}
+	values := []string{}
+	args := []interface{}{}
+	for _, url := range mediaUrl {
+		values = append(values, "(?,?,?)")
+		args = append(args, url, queuedAt, queuedAt)
+	}
+	_, err := repo.DB.ExecContext(
+		ctx,
+		fmt.Sprintf("INSERT IGNORE INTO media_deletions (media_url, next_attempt_at, created_at) VALUES %s", strings.Join(values, ",")),
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to queue media deletions %w", err)
+	}
+	return nil
+}
+
+// edit save the current version as a revision and apply the change, both or neither.
+// removed media stay on the media backend, old revisions still show them
+func (repo *RepositoryImpl) edit(ctx context.Context, data postEdit) error {
+	tx, err := repo.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("repository: failed to begin transaction %w", err)
+	}
+	defer func() {
+		// handle panic for extream case like driver fails
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	current := editablePost{media: []string{}}
+	var caption string
+	var createdAt int64
+	var editedAt sql.NullInt64
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT user_id, status, caption, created_at, edited_at FROM posts WHERE id = ? FOR UPDATE",
+		data.postId,
+	).Scan(&current.userId, &current.status, &caption, &createdAt, &editedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = apperror.New(http.StatusNotFound, "post not found", err)
+			return err
+		}
+		return fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT media_url FROM post_media WHERE post_id = ? ORDER BY id", data.postId)
+	if err != nil {
+		return fmt.Errorf("repository: failed to get post media %w", err)
+	}
+	for rows.Next() {
+		var mediaUrl string
+		if err = rows.Scan(&mediaUrl); err != nil {
+			rows.Close()
+			return fmt.Errorf("repository: failed to scan post media %w", err)
+		}
+		current.media = append(current.media, mediaUrl)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("repository: failed to read post media %w", err)
+	}
+
+	// checked again under the lock, the post can change between editable and here
+	err = current.allowEdit(data.userId, data.removeMedia, len(data.addMedia))
+	if err != nil {
+		return err
+	}
+	removeArgs := []interface{}{data.postId}
+	for _, url := range data.removeMedia {
+		removeArgs = append(removeArgs, url)
+	}
+
+	mediaJson, err := json.Marshal(current.media)
+	if err != nil {
+		return fmt.Errorf("repository: failed to encode revision media %w", err)
+	}
+	var revision int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(post_id) FROM post_revisions WHERE post_id = ?", data.postId).Scan(&revision)
+	if err != nil {
+		return fmt.Errorf("repository: failed to count revisions, %w", err)
+	}
+	publishedAt := createdAt
+	if editedAt.Valid {
+		publishedAt = editedAt.Int64
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO post_revisions (post_id, revision, caption, media, created_at) VALUES (?,?,?,?,?)",
+		data.postId,
+		revision+1,
+		caption,
+		string(mediaJson),
+		publishedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to save revision %w", err)
+	}
+
+	if data.caption != nil {
+		caption = *data.caption
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE posts SET caption = ?, edited_at = ?, updated_at = ? WHERE id = ?",
+		caption,
+		data.editedAt,
+		data.editedAt,
+		data.postId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to update post %w", err)
+	}
+	if len(data.removeMedia) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(data.removeMedia)), ",")
+		_, err = tx.ExecContext(
+			ctx,
+			fmt.Sprintf("DELETE FROM post_media WHERE post_id = ? AND media_url IN (%s)", placeholders),
+			removeArgs...,
+		)
+		if err != nil {
+			return fmt.Errorf("repository: failed to remove post media %w", err)
+		}
+	}
+	if len(data.addMedia) > 0 {
+		values := []string{}
+		args := []interface{}{}
+		for _, item := range data.addMedia {
+			values = append(values, "(?,?,?,?)")
+			args = append(args, item.Id, item.MediaUrl, data.postId, item.CreatedAt)
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			fmt.Sprintf("INSERT INTO post_media (id, media_url, post_id, created_at) VALUES %s", strings.Join(values, ",")),
+			args...,
+		)
+		if err != nil {
+			return fmt.Errorf("repository: fail to add post media %w", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("repository: failed to commit transaction %w", err)
+	}
+	return nil
+}
+
+// revisions of the post oldest first, the current version is not included
+func (repo *RepositoryImpl) revisions(ctx context.Context, postId string) ([]postRevision, error) {
+	rows, err := repo.DB.QueryContext(
+		ctx,
+		"SELECT revision, caption, media, created_at FROM post_revisions WHERE post_id = ? ORDER BY revision",
+		postId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to get revisions %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []postRevision{}
+	for rows.Next() {
+		revision := postRevision{}
+		var media string
+		if err := rows.Scan(&revision.revision, &revision.caption, &media, &revision.createdAt); err != nil {
+			return nil, fmt.Errorf("repository: failed to scan revision %w", err)
+		}
+		if err := json.Unmarshal([]byte(media), &revision.mediaUrl); err != nil {
+			return nil, fmt.Errorf("repository: failed to decode revision media %w", err)
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository: failed to read revisions %w", err)
+	}
+	return revisions, nil
+}
+
+type postDeletion struct {
+	postId string
+	userId string
+	// holders of ROLE_ID_DELETE_POST can delete posts of other people
+	canDeleteAny bool
+	deletedAt    int64
+}
+
+// delete remove the post with everything attached to it, its media and the media of its revisions
+// are queued for MediaCleaner in the same transaction so no asset is forgotten if cloudinary is down
+func (repo *RepositoryImpl) delete(ctx context.Context, data postDeletion) error {
+	tx, err := repo.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("repository: failed to begin transaction %w", err)
+	}
+	defer func() {
+		// handle panic for extream case like driver fails
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var userId string
+	err = tx.QueryRowContext(ctx, "SELECT user_id FROM posts WHERE id = ? FOR UPDATE", data.postId).Scan(&userId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = apperror.New(http.StatusNotFound, "post not found", err)
+			return err
+		}
+		return fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	if userId != data.userId && !data.canDeleteAny {
+		err = apperror.New(http.StatusForbidden, "you can only delete your own post", nil)
+		return err
+	}
+
+	steps := []struct {
+		name  string
+		query string
+		args  []interface{}
+	}{
+		{
+			name:  "queue post media",
+			query: "INSERT IGNORE INTO media_deletions (media_url, next_attempt_at, created_at) SELECT media_url, ?, ? FROM post_media WHERE post_id = ?",
+			args:  []interface{}{data.deletedAt, data.deletedAt, data.postId},
+		},
+		{
+			name: "queue revision media",
+			query: `
+			INSERT IGNORE INTO media_deletions (media_url, next_attempt_at, created_at)
+			SELECT m.media_url, ?, ?
+			FROM post_revisions r, JSON_TABLE(r.media, '$[*]' COLUMNS (media_url varchar(512) PATH '$')) m
+			WHERE r.post_id = ?`,
+			args: []interface{}{data.deletedAt, data.deletedAt, data.postId},
+		},
+		{
+			name:  "comment reactions",
+			query: "DELETE FROM comment_reactions WHERE comment_id IN (SELECT id FROM comments WHERE post_id = ?)",
+			args:  []interface{}{data.postId},
+		},
+		{
+			name:  "comment votes",
+			query: "DELETE FROM comment_votes WHERE comment_id IN (SELECT id FROM comments WHERE post_id = ?)",
+			args:  []interface{}{data.postId},
+		},
+		{name: "comments", query: "DELETE FROM comments WHERE post_id = ?", args: []interface{}{data.postId}},
+		{name: "reactions", query: "DELETE FROM post_reactions WHERE post_id = ?", args: []interface{}{data.postId}},
+		{name: "likes", query: "DELETE FROM likes WHERE post_id = ?", args: []interface{}{data.postId}},
+		{name: "revisions", query: "DELETE FROM post_revisions WHERE post_id = ?", args: []interface{}{data.postId}},
+		{name: "reviews", query: "DELETE FROM post_reviews WHERE post_id = ?", args: []interface{}{data.postId}},
+		{name: "media", query: "DELETE FROM post_media WHERE post_id = ?", args: []interface{}{data.postId}},
+		{name: "post", query: "DELETE FROM posts WHERE id = ?", args: []interface{}{data.postId}},
+	}
+	for _, step := range steps {
+		_, err = tx.ExecContext(ctx, step.query, step.args...)
+		if err != nil {
+			return fmt.Errorf("repository: failed to delete post, %s step %w", step.name, err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("repository: failed to commit transaction %w", err)
+	}
+	return nil
+}
+
+// mediaDeletion is a cloudinary asset waiting to be deleted
+type mediaDeletion struct {
+	id       int64
+	mediaUrl string
+	attempts int
+}
+
+// dueMediaDeletions return at most limit deletions whose next attempt is at or before now, oldest first
+func (repo *RepositoryImpl) dueMediaDeletions(ctx context.Context, now int64, limit int) ([]mediaDeletion, error) {
+	rows, err := repo.DB.QueryContext(
+		ctx,
+		"SELECT id, media_url, attempts FROM media_deletions WHERE next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?",
+		now,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to get media deletions %w", err)
+	}
+	defer rows.Close()
+
+	deletions := []mediaDeletion{}
+	for rows.Next() {
+		deletion := mediaDeletion{}
+		if err := rows.Scan(&deletion.id, &deletion.mediaUrl, &deletion.attempts); err != nil {
+			return nil, fmt.Errorf("repository: failed to scan media deletion %w", err)
+		}
+		deletions = append(deletions, deletion)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository: failed to read media deletions %w", err)
+	}
+	return deletions, nil
+}
+
+func (repo *RepositoryImpl) finishMediaDeletion(ctx context.Context, id int64) error {
+	_, err := repo.DB.ExecContext(ctx, "DELETE FROM media_deletions WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("repository: failed to finish media deletion %w", err)
+	}
+	return nil
+}
+
+func (repo *RepositoryImpl) retryMediaDeletion(ctx context.Context, id int64, nextAttemptAt int64, lastError string) error {
+	_, err := repo.DB.ExecContext(
+		ctx,
+		"UPDATE media_deletions SET attempts = attempts + 1, last_error = ?, next_attempt_at = ? WHERE id = ?",
+		lastError,
+		nextAttemptAt,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: failed to reschedule media deletion %w", err)
+	}
+	return nil
+}
+
+// queueQuery is one page of the moderation queue, after is the id of the previous page last post
+type queueQuery struct {
+	subforumId string
+	after      string
+	limit      int
+}
+
+// queue return pending posts oldest first, uuid v7 grow with time so id order is age order
+func (repo *RepositoryImpl) queue(ctx context.Context, query queueQuery) ([]feedPost, error) {
+	condition := "p.status = ?"
+	args := []interface{}{POST_STATUS_PENDING}
+	if query.subforumId != "" {
+		condition += " AND p.subforum_id = ?"
+		args = append(args, query.subforumId)
+	}
+	if query.after != "" {
+		condition += " AND p.id > ?"
+		args = append(args, query.after)
+	}
+	args = append(args, query.limit)
+
+	rows, err := repo.DB.QueryContext(
+		ctx,
+		fmt.Sprintf(`
+		SELECT p.id, p.caption, p.created_at, p.updated_at, p.edited_at, u.id AS user_id, u.fullname, u.handle, COALESCE(u.avatar, '') AS avatar,
+		sf.id AS subforum_id, sf.name AS subforum_name
+		FROM posts p
+		JOIN users u
+		ON p.user_id = u.id
+		JOIN subforums sf
+		ON p.subforum_id = sf.id
+		WHERE %s
+		ORDER BY p.id
+		LIMIT ?`, condition),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to get moderation queue %w", err)
+	}
+	defer rows.Close()
+
+	posts := []feedPost{}
+	postIds := []interface{}{}
+	for rows.Next() {
+		fp := feedPost{}
+		if err := rows.Scan(
+			&fp.id,
+			&fp.caption,
+			&fp.createdAt,
+			&fp.updatedAt,
+			&fp.editedAt,
+			&fp.user.Id,
+			&fp.user.Fullname,
+			&fp.user.Handle,
+			&fp.user.Avatar,
+			&fp.subforum.Id,
+			&fp.subforum.Name,
+		); err != nil {
+			return nil, fmt.Errorf("repository: failed to scan moderation queue %w", err)
+		}
+		posts = append(posts, fp)
+		postIds = append(postIds, fp.id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository: failed to read moderation queue %w", err)
+	}
+	if len(posts) == 0 {
+		return posts, nil
+	}
+
+	media, err := repo.findMedia(ctx, postIds)
+	if err != nil {
+		return nil, err
+	}
+	for i := range posts {
+		posts[i].mediaUrl = media[posts[i].id]
+	}
+	return posts, nil
+}
+
+// postReview is the decision of a moderator on a pending post
+type postReview struct {
+	postId      string
+	moderatorId string
+	// POST_STATUS_PUBLISHED or POST_STATUS_REJECTED
+	status     string
+	reason     string
+	reviewedAt int64
+}
+
+// reviewedPost is what the author need to be told about the decision
+type reviewedPost struct {
+	authorEmail    string
+	authorFullname string
+	subforumName   string
+}
+
+func (repo *RepositoryImpl) review(ctx context.Context, data postReview) (reviewedPost, error) {
+	tx, err := repo.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return reviewedPost{}, fmt.Errorf("repository: failed to begin transaction %w", err)
+	}
+	defer func() {
+		// handle panic for extream case like driver fails
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var status string
+	result := reviewedPost{}
 	err = tx.QueryRowContext(
 		ctx,
-		"SELECT COUNT(post_id) FROM likes WHERE post_id = ?",
+		`
+		SELECT p.status, u.email, u.fullname, sf.name
+		FROM posts p
+		JOIN users u
+		ON p.user_id = u.id
+		JOIN subforums sf
+		ON p.subforum_id = sf.id
+		WHERE p.id = ?
+		FOR UPDATE`,
+		data.postId,
+	).Scan(&status, &result.authorEmail, &result.authorFullname, &result.subforumName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = apperror.New(http.StatusNotFound, "post not found", err)
+			return reviewedPost{}, err
+		}
+		return reviewedPost{}, fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	if status != POST_STATUS_PENDING {
+		err = apperror.New(http.StatusConflict, "this post is not waiting for approval", nil)
+		return reviewedPost{}, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE posts SET status = ?, updated_at = ? WHERE id = ?",
+		data.status,
+		data.reviewedAt,
+		data.postId,
+	)
+	if err != nil {
+		return reviewedPost{}, fmt.Errorf("repository: failed to update post status %w", err)
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO post_reviews (post_id, moderator_id, decision, reason, created_at) VALUES (?,?,?,?,?)",
 		data.postId,
-	).Scan(&likeCount.count)
+		data.moderatorId,
+		data.status,
+		data.reason,
+		data.reviewedAt,
+	)
+	if err != nil {
+		return reviewedPost{}, fmt.Errorf("repository: failed to save post review %w", err)
+	}
+	err = tx.Commit()
 	if err != nil {
-		return 0, fmt.Errorf("repository: failed to get likes count, %w", err)
+		return reviewedPost{}, fmt.Errorf("repository: failed to commit transaction %w", err)
 	}
-	fmt.Println(*likeCount)
-	return likeCount.count, nil
+	return result, nil
 }
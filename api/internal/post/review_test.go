@@ -0,0 +1,209 @@
+package post
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apperror "github.com/zulfikarrosadi/code_roast/internal/app-error"
+	"github.com/zulfikarrosadi/code_roast/internal/mailer"
+)
+
+const selectReviewedPost = "SELECT p.status, u.email, u.fullname, sf.name FROM posts p JOIN users u ON p.user_id = u.id JOIN subforums sf ON p.subforum_id = sf.id WHERE p.id = ? FOR UPDATE"
+
+func TestRepositoryImpl_review(t *testing.T) {
+	tests := []struct {
+		name       string
+		current    string
+		decision   string
+		expectCode int
+	}{
+		{name: "Pending post is published", current: POST_STATUS_PENDING, decision: POST_STATUS_PUBLISHED},
+		{name: "Pending post is rejected", current: POST_STATUS_PENDING, decision: POST_STATUS_REJECTED},
+		{name: "Published post is not reviewed again", current: POST_STATUS_PUBLISHED, decision: POST_STATUS_REJECTED, expectCode: http.StatusConflict},
+		{name: "Rejected post is not reviewed again", current: POST_STATUS_REJECTED, decision: POST_STATUS_PUBLISHED, expectCode: http.StatusConflict},
+		{name: "Taken down post is not reviewed", current: POST_STATUS_TAKE_DOWN, decision: POST_STATUS_PUBLISHED, expectCode: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, sqlMock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+			repo := NewRepository(db)
+
+			sqlMock.ExpectBegin()
+			sqlMock.ExpectQuery(regexp.QuoteMeta(selectReviewedPost)).
+				WithArgs("post-1").
+				WillReturnRows(sqlmock.NewRows([]string{"status", "email", "fullname", "name"}).AddRow(tt.current, "author@example.com", "Author", "golang"))
+			if tt.expectCode != 0 {
+				sqlMock.ExpectRollback()
+			} else {
+				sqlMock.ExpectExec(regexp.QuoteMeta("UPDATE posts SET status = ?, updated_at = ? WHERE id = ?")).
+					WithArgs(tt.decision, int64(1_700_000_000), "post-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO post_reviews (post_id, moderator_id, decision, reason, created_at) VALUES (?,?,?,?,?)")).
+					WithArgs("post-1", "moderator-1", tt.decision, "reason", int64(1_700_000_000)).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				sqlMock.ExpectCommit()
+			}
+
+			result, err := repo.review(context.Background(), postReview{
+				postId:      "post-1",
+				moderatorId: "moderator-1",
+				status:      tt.decision,
+				reason:      "reason",
+				reviewedAt:  1_700_000_000,
+			})
+			if tt.expectCode != 0 {
+				var appError *apperror.AppError
+				require.ErrorAs(t, err, &appError)
+				assert.Equal(t, tt.expectCode, appError.Code)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, reviewedPost{authorEmail: "author@example.com", authorFullname: "Author", subforumName: "golang"}, result)
+			}
+			assert.NoError(t, sqlMock.ExpectationsWereMet())
+		})
+	}
+}
+
+// reviewRepository only answer queue and review, any other repository call panic on the nil interface
+type reviewRepository struct {
+	repository
+	pending  []feedPost
+	query    queueQuery
+	reviewed postReview
+	err      error
+}
+
+func (repo *reviewRepository) queue(ctx context.Context, query queueQuery) ([]feedPost, error) {
+	repo.query = query
+	if len(repo.pending) > query.limit {
+		return repo.pending[:query.limit], nil
+	}
+	return repo.pending, nil
+}
+
+func (repo *reviewRepository) review(ctx context.Context, data postReview) (reviewedPost, error) {
+	repo.reviewed = data
+	if repo.err != nil {
+		return reviewedPost{}, repo.err
+	}
+	return reviewedPost{authorEmail: "author@example.com", authorFullname: "Author", subforumName: "golang"}, nil
+}
+
+func TestServiceImpl_queue(t *testing.T) {
+	repo := &reviewRepository{pending: []feedPost{{id: "post-1"}, {id: "post-2"}, {id: "post-3"}}}
+	service := NewService(repo, validator.New(), nil, DEFAULT_REACTIONS, nil, "")
+
+	resp, err := service.queue(context.Background(), queueRequest{SubforumId: "subforum-1", Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, queueQuery{subforumId: "subforum-1", limit: 3}, repo.query)
+	assert.Len(t, resp.Data.Posts, 2)
+	assert.Equal(t, "post-2", resp.Data.NextCursor)
+
+	resp, err = service.queue(context.Background(), queueRequest{Cursor: "0190b6f2-7c8a-7000-8000-000000000002", Limit: 5})
+	require.NoError(t, err)
+	assert.Equal(t, "0190b6f2-7c8a-7000-8000-000000000002", repo.query.after)
+	assert.Len(t, resp.Data.Posts, 3)
+	assert.Empty(t, resp.Data.NextCursor)
+}
+
+// failingMailer never deliver anything
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, message mailer.Message) error {
+	return errors.New("smtp: connection refused")
+}
+
+func TestServiceImpl_review(t *testing.T) {
+	tests := []struct {
+		name           string
+		request        reviewRequest
+		repoErr        error
+		failMail       bool
+		expectCode     int
+		expectReason   string
+		expectSubject  string
+		expectNotified bool
+	}{
+		{
+			name:           "Approved",
+			request:        reviewRequest{PostId: "post-1", Decision: POST_STATUS_PUBLISHED},
+			expectCode:     http.StatusOK,
+			expectSubject:  "Your post in golang was approved",
+			expectNotified: true,
+		},
+		{
+			name:           "Rejected with reason",
+			request:        reviewRequest{PostId: "post-1", Decision: POST_STATUS_REJECTED, Reason: " off topic "},
+			expectCode:     http.StatusOK,
+			expectReason:   "off topic",
+			expectSubject:  "Your post in golang was not approved",
+			expectNotified: true,
+		},
+		{
+			name:       "Rejected without reason",
+			request:    reviewRequest{PostId: "post-1", Decision: POST_STATUS_REJECTED, Reason: "  "},
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Post no longer pending",
+			request:    reviewRequest{PostId: "post-1", Decision: POST_STATUS_PUBLISHED},
+			repoErr:    apperror.New(http.StatusConflict, "this post is not waiting for approval", nil),
+			expectCode: http.StatusConflict,
+		},
+		{
+			name:       "Failed email keep the decision",
+			request:    reviewRequest{PostId: "post-1", Decision: POST_STATUS_PUBLISHED},
+			failMail:   true,
+			expectCode: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &reviewRepository{err: tt.repoErr}
+			memoryMailer := mailer.NewMemoryMailer()
+			var postMailer mailer.Mailer = memoryMailer
+			if tt.failMail {
+				postMailer = failingMailer{}
+			}
+			service := NewService(repo, validator.New(), nil, DEFAULT_REACTIONS, postMailer, "https://roast.example")
+
+			tt.request.moderatorId = "moderator-1"
+			resp, err := service.review(context.Background(), tt.request)
+			assert.Equal(t, tt.expectCode, resp.Code)
+			if tt.expectCode != http.StatusOK {
+				assert.Error(t, err)
+				assert.Empty(t, memoryMailer.Messages())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, postReview{
+				postId:      "post-1",
+				moderatorId: "moderator-1",
+				status:      tt.request.Decision,
+				reason:      tt.expectReason,
+				reviewedAt:  repo.reviewed.reviewedAt,
+			}, repo.reviewed)
+			assert.Equal(t, tt.request.Decision, resp.Data.Status)
+			assert.Equal(t, tt.expectReason, resp.Data.Reason)
+			assert.Equal(t, tt.expectNotified, resp.Data.AuthorNotified)
+			if !tt.expectNotified {
+				return
+			}
+			messages := memoryMailer.Messages()
+			require.Len(t, messages, 1)
+			assert.Equal(t, "author@example.com", messages[0].To)
+			assert.Equal(t, tt.expectSubject, messages[0].Subject)
+			assert.Contains(t, messages[0].Body, "https://roast.example/posts/post-1")
+			assert.Contains(t, messages[0].Body, tt.expectReason)
+		})
+	}
+}
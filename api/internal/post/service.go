@@ -3,10 +3,14 @@ package post
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"mime/multipart"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/cloudinary/cloudinary-go/v2"
@@ -15,6 +19,7 @@ import (
 	"github.com/google/uuid"
 	apperror "github.com/zulfikarrosadi/code_roast/internal/app-error"
 	imagehelper "github.com/zulfikarrosadi/code_roast/internal/image-helper"
+	"github.com/zulfikarrosadi/code_roast/internal/mailer"
 	"github.com/zulfikarrosadi/code_roast/internal/subforum"
 	"github.com/zulfikarrosadi/code_roast/internal/user"
 	"github.com/zulfikarrosadi/code_roast/pkg/schema"
@@ -23,26 +28,56 @@ import (
 type repository interface {
 	create(context.Context, post) (createPostResult, error)
 	takeDown(context.Context, string, sql.NullInt64) error
-	like(context.Context, newLike) (int, error)
+	vote(context.Context, newVote) (voteState, error)
+	unlike(context.Context, string, string) (voteState, error)
+	feed(context.Context, feedQuery) ([]feedPost, error)
+	findById(context.Context, string, string) (postWithViewer, error)
+	react(context.Context, newReaction) (map[string]int, error)
+	unreact(context.Context, string, string) (map[string]int, error)
+	editable(context.Context, string) (editablePost, error)
+	queueMediaDeletions(context.Context, []string, int64) error
+	edit(context.Context, postEdit) error
+	revisions(context.Context, string) ([]postRevision, error)
+	delete(context.Context, postDeletion) error
+	dueMediaDeletions(context.Context, int64, int) ([]mediaDeletion, error)
+	finishMediaDeletion(context.Context, int64) error
+	retryMediaDeletion(context.Context, int64, int64, string) error
+	queue(context.Context, queueQuery) ([]feedPost, error)
+	review(context.Context, postReview) (reviewedPost, error)
 }
 
 type serviceImpl struct {
-	repo repository
-	v    *validator.Validate
-	cld  *cloudinary.Cloudinary
+	repo      repository
+	v         *validator.Validate
+	cld       *cloudinary.Cloudinary
+	reactions ReactionCatalog
+	mailer    mailer.Mailer
+	// base url of the web app, links in emails point there
+	appURL string
 }
 
-func NewService(repo repository, v *validator.Validate, cld *cloudinary.Cloudinary) *serviceImpl {
+func NewService(
+	repo repository,
+	v *validator.Validate,
+	cld *cloudinary.Cloudinary,
+	reactions ReactionCatalog,
+	mailer mailer.Mailer,
+	appURL string,
+) *serviceImpl {
+	RegisterReactionCatalog(v, reactions)
 	return &serviceImpl{
-		repo: repo,
-		v:    v,
-		cld:  cld,
+		repo:      repo,
+		v:         v,
+		cld:       cld,
+		reactions: reactions,
+		mailer:    mailer,
+		appURL:    appURL,
 	}
 }
 
 type postCreateRequest struct {
 	userId     string
-	Caption    string                  `validate:"required"`
+	Caption    string                  `validate:"required,max=5000"`
 	SubforumId string                  `validate:"required"`
 	Media      []*multipart.FileHeader `validate:"required,min=1,max=10"`
 }
@@ -54,7 +89,9 @@ type postCreateResponse struct {
 	CreatedAt int64             `json:"created_at"`
 	UpdatedAt int64             `json:"updated_at"`
 	Subforum  subforum.Subforum `json:"subforum"`
-	User      user.User         `json:"user"`
+	User      user.Author       `json:"user"`
+	// pending until a moderator approve it when the subforum require approval
+	Status string `json:"status"`
 }
 
 type postResponse struct {
@@ -85,59 +122,26 @@ func (service *serviceImpl) create(ctx context.Context, data postCreateRequest)
 		}, fmt.Errorf("service: fail to generate post uuid %w", err)
 	}
 
-	var media []postMedia
-	for _, item := range data.Media {
-		mediaId, err := uuid.NewV7()
-		if err != nil {
-			return schema.Response[postResponse]{
-				Status: "fail",
-				Code:   http.StatusInternalServerError,
-				Error: schema.Error{
-					Message: "something went wrong, please try again later",
-				},
-			}, fmt.Errorf("service: fail to generate post media uuid %w", err)
-		}
-		postMediaSrc, err := item.Open()
-		if err != nil {
-			return schema.Response[postResponse]{
-				Status: "fail",
-				Code:   http.StatusInternalServerError,
-				Error: schema.Error{
-					Message: "fail to create new post, failed to open media file",
-				},
-			}, fmt.Errorf("service: failed to open media file %w", err)
-		}
-		defer postMediaSrc.Close()
-		if _, err := imagehelper.IsImage(postMediaSrc); err != nil {
+	media, err := service.uploadMedia(ctx, data.Media)
+	if err != nil {
+		err = service.discardMedia(ctx, media, err)
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
 			return schema.Response[postResponse]{
 				Status: "fail",
-				Code:   http.StatusBadRequest,
+				Code:   appError.Code,
 				Error: schema.Error{
-					Message: "fail to create new post, unsupported media file type. Only upload jpg or png file",
+					Message: "fail to create new post, " + appError.Message,
 				},
-			}, fmt.Errorf("media is not image %w", err)
+			}, err
 		}
-		mediaUpload, err := service.cld.Upload.Upload(
-			ctx,
-			postMediaSrc,
-			uploader.UploadParams{
-				ResourceType: "image",
+		return schema.Response[postResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "something went wrong, please try again later",
 			},
-		)
-		if err != nil {
-			return schema.Response[postResponse]{
-				Status: "fail",
-				Code:   http.StatusInternalServerError,
-				Error: schema.Error{
-					Message: "fail to create new post, failed to upload media file",
-				},
-			}, fmt.Errorf("service: failed to upload media file %w", err)
-		}
-
-		media = append(media, postMedia{
-			Id:       mediaId.String(),
-			MediaUrl: mediaUpload.SecureURL,
-		})
+		}, err
 	}
 
 	result, err := service.repo.create(ctx, post{
@@ -150,6 +154,17 @@ func (service *serviceImpl) create(ctx context.Context, data postCreateRequest)
 		subforumId: data.SubforumId,
 	})
 	if err != nil {
+		err = service.discardMedia(ctx, media, err)
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[postResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
 		return schema.Response[postResponse]{
 			Status: "fail",
 			Code:   http.StatusInternalServerError,
@@ -165,6 +180,7 @@ func (service *serviceImpl) create(ctx context.Context, data postCreateRequest)
 			Post: postCreateResponse{
 				Id:        result.post.id,
 				Caption:   result.post.caption,
+				Status:    result.post.status,
 				Media:     result.post.mediaUrl,
 				CreatedAt: result.post.createdAt,
 				UpdatedAt: result.post.updatedAt.Int64,
@@ -172,10 +188,7 @@ func (service *serviceImpl) create(ctx context.Context, data postCreateRequest)
 					Id:   result.post.subforum.Id,
 					Name: result.post.subforum.Name,
 				},
-				User: user.User{
-					Id:       result.post.user.Id,
-					Fullname: result.post.user.Fullname,
-				},
+				User: result.post.user,
 			},
 		},
 	}, nil
@@ -214,23 +227,25 @@ func (service *serviceImpl) takeDown(ctx context.Context, postId string, updated
 	}, nil
 }
 
-type likeCreateResponse struct {
+type likeDetail struct {
 	PostId    string `json:"id"`
 	LikeCount int    `json:"like_count"`
+	LikedByMe bool   `json:"liked_by_me"`
 }
 
-type likeCreateRequest struct {
+// postActionRequest is the user acting on a post with nothing more to say e.g like or clear reaction
+type postActionRequest struct {
 	UserId string
 	PostId string `param:"id" validate:"required"`
 }
 
 type likeResponse struct {
-	Post likeCreateResponse `json:"post"`
+	Post likeDetail `json:"post"`
 }
 
 func (service *serviceImpl) like(
 	ctx context.Context,
-	data likeCreateRequest,
+	data postActionRequest,
 ) (schema.Response[likeResponse], error) {
 	err := service.v.Struct(data)
 	if err != nil {
@@ -242,14 +257,25 @@ func (service *serviceImpl) like(
 				Message: apperror.VALIDATION_ERROR,
 				Details: validationError,
 			},
-		}, fmt.Errorf("service: error input")
+		}, fmt.Errorf("service: like validation error %w", err)
 	}
-	likeCount, err := service.repo.like(ctx, newLike{
+	state, err := service.repo.vote(ctx, newVote{
 		userId:    data.UserId,
 		postId:    data.PostId,
+		value:     VOTE_UP,
 		createdAt: time.Now().Unix(),
 	})
 	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[likeResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
 		return schema.Response[likeResponse]{
 			Status: "fail",
 			Code:   http.StatusInternalServerError,
@@ -258,14 +284,1163 @@ func (service *serviceImpl) like(
 			},
 		}, err
 	}
+	// liking again is not an error, it just doesn't create anything. like over a downvote flip it
+	code := http.StatusOK
+	if state.changed {
+		code = http.StatusCreated
+	}
+	return schema.Response[likeResponse]{
+		Status: "success",
+		Code:   code,
+		Data: likeResponse{
+			Post: likeDetail{
+				PostId:    data.PostId,
+				LikeCount: state.upvotes,
+				LikedByMe: state.value == VOTE_UP,
+			},
+		},
+	}, nil
+}
+
+func (service *serviceImpl) unlike(ctx context.Context, data postActionRequest) (schema.Response[likeResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[likeResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationError,
+			},
+		}, fmt.Errorf("service: unlike validation error %w", err)
+	}
+	state, err := service.repo.unlike(ctx, data.PostId, data.UserId)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[likeResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[likeResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "failed to unlike this post, please try again later",
+			},
+		}, err
+	}
 	return schema.Response[likeResponse]{
 		Status: "success",
-		Code:   http.StatusCreated,
+		Code:   http.StatusOK,
 		Data: likeResponse{
-			Post: likeCreateResponse{
+			Post: likeDetail{
+				PostId:    data.PostId,
+				LikeCount: state.upvotes,
+				LikedByMe: state.value == VOTE_UP,
+			},
+		},
+	}, nil
+}
+
+type voteRequest struct {
+	UserId string
+	PostId string `param:"id" validate:"required"`
+	// pointer so a missing value isn't mistaken for VOTE_RETRACT
+	Value *int `json:"value" validate:"required,oneof=-1 0 1"`
+}
+
+type voteDetail struct {
+	PostId    string `json:"id"`
+	Upvotes   int    `json:"upvotes"`
+	Downvotes int    `json:"downvotes"`
+	Score     int    `json:"score"`
+	MyVote    int    `json:"my_vote"`
+}
+
+type voteResponse struct {
+	Post voteDetail `json:"post"`
+}
+
+// vote set the vote of the user on a post, 1 is upvote, -1 is downvote and 0 retract the vote
+func (service *serviceImpl) vote(ctx context.Context, data voteRequest) (schema.Response[voteResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[voteResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationError,
+			},
+		}, fmt.Errorf("service: vote validation error %w", err)
+	}
+	state, err := service.repo.vote(ctx, newVote{
+		userId:    data.UserId,
+		postId:    data.PostId,
+		value:     *data.Value,
+		createdAt: time.Now().Unix(),
+	})
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[voteResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[voteResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "failed to vote this post, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[voteResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: voteResponse{
+			Post: voteDetail{
 				PostId:    data.PostId,
-				LikeCount: likeCount,
+				Upvotes:   state.upvotes,
+				Downvotes: state.downvotes,
+				Score:     state.score,
+				MyVote:    state.value,
+			},
+		},
+	}, nil
+}
+
+const (
+	DEFAULT_FEED_LIMIT = 20
+)
+
+// how far back each top window reach, in seconds
+var FEED_WINDOWS = map[string]int64{
+	"hour":  60 * 60,
+	"day":   24 * 60 * 60,
+	"week":  7 * 24 * 60 * 60,
+	"month": 30 * 24 * 60 * 60,
+	"year":  365 * 24 * 60 * 60,
+	"all":   0,
+}
+
+// feedCursor point at the last post of a page, client only see it as an opaque string
+type feedCursor struct {
+	Sort   string `json:"o"`
+	Window string `json:"w,omitempty"`
+	Id     string `json:"i"`
+	// the stored rank of the post in the sort, exact integer so the keyset never skip or repeat a post
+	Rank int64 `json:"r,omitempty"`
+}
+
+func encodeFeedCursor(cursor feedCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeFeedCursor(value string) (feedCursor, error) {
+	cursor := feedCursor{}
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return feedCursor{}, fmt.Errorf("cursor is not base64 %w", err)
+	}
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return feedCursor{}, fmt.Errorf("cursor is not json %w", err)
+	}
+	if cursor.Id == "" {
+		return feedCursor{}, errors.New("cursor has no id")
+	}
+	return cursor, nil
+}
+
+type feedRequest struct {
+	SubforumId string `param:"id"`
+	Sort       string `query:"sort" validate:"omitempty,oneof=new top hot controversial best"`
+	// limit the feed to posts of the last hour, day, week, month or year
+	Window string `query:"t" validate:"omitempty,oneof=hour day week month year all"`
+	Cursor string `query:"cursor"`
+	Limit  int    `query:"limit" validate:"omitempty,min=1,max=50"`
+}
+
+type postDetail struct {
+	Id        string            `json:"id"`
+	Caption   string            `json:"caption"`
+	Media     []string          `json:"media"`
+	CreatedAt int64             `json:"created_at"`
+	UpdatedAt int64             `json:"updated_at"`
+	Subforum  subforum.Subforum `json:"subforum"`
+	User      user.Author       `json:"user"`
+	// upvotes, kept from the time likes were the only vote
+	LikeCount    int   `json:"like_count"`
+	Downvotes    int   `json:"downvotes"`
+	Score        int   `json:"score"`
+	CommentCount int   `json:"comment_count"`
+	Edited       bool  `json:"edited"`
+	EditedAt     int64 `json:"edited_at"`
+	// reaction key to count, every reaction of the catalog is present
+	Reactions map[string]int `json:"reactions"`
+}
+
+type feedResponse struct {
+	Posts []postDetail `json:"posts"`
+	// empty on the last page
+	NextCursor string `json:"next_cursor"`
+}
+
+func (service *serviceImpl) feed(ctx context.Context, data feedRequest) (schema.Response[feedResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[feedResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationError,
+			},
+		}, fmt.Errorf("service: feed validation error %w", err)
+	}
+	query := feedQuery{
+		subforumId: data.SubforumId,
+		sort:       data.Sort,
+		limit:      data.Limit,
+	}
+	if query.sort == "" {
+		query.sort = FEED_SORT_NEW
+	}
+	if query.limit == 0 {
+		query.limit = DEFAULT_FEED_LIMIT
+	}
+	if window := FEED_WINDOWS[data.Window]; window > 0 {
+		query.since = time.Now().Unix() - window
+	}
+	if data.Cursor != "" {
+		query.after, err = decodeFeedCursor(data.Cursor)
+		// cursor of other sort or window points somewhere meaningless in this one
+		if err == nil && (query.after.Sort != query.sort || query.after.Window != data.Window) {
+			err = fmt.Errorf("cursor is made for sort %s window %s", query.after.Sort, query.after.Window)
+		}
+		if err != nil {
+			return schema.Response[feedResponse]{
+				Status: "fail",
+				Code:   http.StatusBadRequest,
+				Error: schema.Error{
+					Message: "invalid cursor, start again from the first page",
+				},
+			}, fmt.Errorf("service: %w", err)
+		}
+	}
+
+	// one extra post tell us whether there is a next page
+	query.limit++
+	result, err := service.repo.feed(ctx, query)
+	if err != nil {
+		return schema.Response[feedResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "something went wrong, please try again later",
+			},
+		}, err
+	}
+	nextCursor := ""
+	if len(result) == query.limit {
+		result = result[:len(result)-1]
+		last := result[len(result)-1]
+		nextCursor = encodeFeedCursor(feedCursor{
+			Sort:   query.sort,
+			Window: data.Window,
+			Id:     last.id,
+			Rank:   last.rank,
+		})
+	}
+
+	posts := []postDetail{}
+	for _, fp := range result {
+		posts = append(posts, postDetail{
+			Id:        fp.id,
+			Caption:   fp.caption,
+			Media:     fp.mediaUrl,
+			CreatedAt: fp.createdAt,
+			UpdatedAt: fp.updatedAt.Int64,
+			Subforum: subforum.Subforum{
+				Id:   fp.subforum.Id,
+				Name: fp.subforum.Name,
+			},
+			User:         fp.user,
+			LikeCount:    fp.votes.upvotes,
+			Downvotes:    fp.votes.downvotes,
+			Score:        fp.votes.score,
+			Reactions:    service.reactions.Counts(fp.reactions),
+			Edited:       fp.editedAt.Valid,
+			EditedAt:     fp.editedAt.Int64,
+			CommentCount: fp.commentCount,
+		})
+	}
+	return schema.Response[feedResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: feedResponse{
+			Posts:      posts,
+			NextCursor: nextCursor,
+		},
+	}, nil
+}
+
+// roles that can act on posts of other people
+var MODERATE_POST_ROLE_IDS = []int{
+	user.ROLE_ID_DELETE_POST,
+	user.ROLE_ID_APPROVE_POST,
+	user.ROLE_ID_TAKE_DOWN_POST,
+}
+
+// postDetailRequest carry who is looking, viewer is empty when the request has no access token
+type postDetailRequest struct {
+	PostId      string `param:"id" validate:"required"`
+	viewerId    string
+	viewerRoles []user.Roles
+}
+
+type viewerState struct {
+	LikedByMe bool `json:"liked_by_me"`
+	MyVote    int  `json:"my_vote"`
+	// empty when the viewer hasn't reacted
+	MyReaction  string `json:"my_reaction"`
+	IsAuthor    bool   `json:"is_author"`
+	CanModerate bool   `json:"can_moderate"`
+}
+
+type postDetailResponse struct {
+	Post   postDetail  `json:"post"`
+	Viewer viewerState `json:"viewer"`
+}
+
+// CanModerate report whether one of roles let the user act on content of other people
+func CanModerate(roles []user.Roles) bool {
+	for _, role := range roles {
+		for _, roleId := range MODERATE_POST_ROLE_IDS {
+			if role.Id == roleId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (service *serviceImpl) findById(ctx context.Context, data postDetailRequest) (schema.Response[postDetailResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[postDetailResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationError,
 			},
+		}, fmt.Errorf("service: post detail validation error %w", err)
+	}
+	result, err := service.repo.findById(ctx, data.PostId, data.viewerId)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[postDetailResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[postDetailResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "something went wrong, please try again later",
+			},
+		}, err
+	}
+
+	viewer := viewerState{
+		LikedByMe:   result.myVote == VOTE_UP,
+		MyVote:      result.myVote,
+		MyReaction:  result.myReaction,
+		IsAuthor:    data.viewerId != "" && data.viewerId == result.user.Id,
+		CanModerate: CanModerate(data.viewerRoles),
+	}
+	switch result.status {
+	case POST_STATUS_TAKE_DOWN:
+		// nothing of the post is sent, not even to its author
+		return schema.Response[postDetailResponse]{
+			Status: "fail",
+			Code:   http.StatusUnavailableForLegalReasons,
+			Error: schema.Error{
+				Message: "this post has been removed by moderators",
+			},
+		}, fmt.Errorf("service: post %s is taken down", result.id)
+	case POST_STATUS_PENDING, POST_STATUS_REJECTED:
+		// waiting for approval or turned down, only the author and moderators know it exists
+		if !viewer.IsAuthor && !viewer.CanModerate {
+			return schema.Response[postDetailResponse]{
+				Status: "fail",
+				Code:   http.StatusNotFound,
+				Error: schema.Error{
+					Message: "post not found",
+				},
+			}, fmt.Errorf("service: post %s is pending", result.id)
+		}
+	}
+
+	return schema.Response[postDetailResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: postDetailResponse{
+			Post: postDetail{
+				Id:        result.id,
+				Caption:   result.caption,
+				Media:     result.mediaUrl,
+				CreatedAt: result.createdAt,
+				UpdatedAt: result.updatedAt.Int64,
+				Subforum: subforum.Subforum{
+					Id:   result.subforum.Id,
+					Name: result.subforum.Name,
+				},
+				User:         result.user,
+				LikeCount:    result.votes.upvotes,
+				Downvotes:    result.votes.downvotes,
+				Score:        result.votes.score,
+				Reactions:    service.reactions.Counts(result.reactions),
+				Edited:       result.editedAt.Valid,
+				EditedAt:     result.editedAt.Int64,
+				CommentCount: result.commentCount,
+			},
+			Viewer: viewer,
+		},
+	}, nil
+}
+
+type reactionRequest struct {
+	UserId   string
+	PostId   string `param:"id" validate:"required"`
+	Reaction string `json:"reaction" validate:"required,reaction"`
+}
+
+type reactionDetail struct {
+	PostId    string         `json:"id"`
+	Reactions map[string]int `json:"reactions"`
+	// empty after the reaction is cleared
+	MyReaction string `json:"my_reaction"`
+}
+
+type reactionResponse struct {
+	Post reactionDetail `json:"post"`
+}
+
+type reactionCatalogResponse struct {
+	Reactions ReactionCatalog `json:"reactions"`
+}
+
+func (service *serviceImpl) reactionCatalog() schema.Response[reactionCatalogResponse] {
+	return schema.Response[reactionCatalogResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: reactionCatalogResponse{
+			Reactions: service.reactions,
+		},
+	}
+}
+
+// react set the reaction of the user on a post, replacing the one they put before
+func (service *serviceImpl) react(ctx context.Context, data reactionRequest) (schema.Response[reactionResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[reactionResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationError,
+			},
+		}, fmt.Errorf("service: react validation error %w", err)
+	}
+	reactions, err := service.repo.react(ctx, newReaction{
+		postId:    data.PostId,
+		userId:    data.UserId,
+		reaction:  data.Reaction,
+		createdAt: time.Now().Unix(),
+	})
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[reactionResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[reactionResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "failed to react to this post, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[reactionResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: reactionResponse{
+			Post: reactionDetail{
+				PostId:     data.PostId,
+				Reactions:  service.reactions.Counts(reactions),
+				MyReaction: data.Reaction,
+			},
+		},
+	}, nil
+}
+
+// unreact is idempotent, clearing a reaction that isn't there change nothing
+func (service *serviceImpl) unreact(ctx context.Context, data postActionRequest) (schema.Response[reactionResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[reactionResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationError,
+			},
+		}, fmt.Errorf("service: unreact validation error %w", err)
+	}
+	reactions, err := service.repo.unreact(ctx, data.PostId, data.UserId)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[reactionResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[reactionResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "failed to clear your reaction, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[reactionResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: reactionResponse{
+			Post: reactionDetail{
+				PostId:    data.PostId,
+				Reactions: service.reactions.Counts(reactions),
+			},
+		},
+	}, nil
+}
+
+// postEditRequest only change what is sent, nil caption keep the current caption
+type postEditRequest struct {
+	userId      string
+	PostId      string                  `validate:"required"`
+	Caption     *string                 `validate:"omitnil,min=1,max=5000"`
+	Media       []*multipart.FileHeader `validate:"max=10"`
+	RemoveMedia []string                `validate:"max=10"`
+}
+
+// uploadMedia check and upload every file, errors are already apperror ready for the client.
+// on error the media uploaded before it are still returned so the caller can clean them up
+func (service *serviceImpl) uploadMedia(ctx context.Context, files []*multipart.FileHeader) ([]postMedia, error) {
+	media := []postMedia{}
+	for _, item := range files {
+		mediaId, err := uuid.NewV7()
+		if err != nil {
+			return media, fmt.Errorf("service: fail to generate post media uuid %w", err)
+		}
+		postMediaSrc, err := item.Open()
+		if err != nil {
+			return media, apperror.New(http.StatusInternalServerError, "failed to open media file", err)
+		}
+		defer postMediaSrc.Close()
+		if _, err := imagehelper.IsImage(postMediaSrc); err != nil {
+			return media, apperror.New(http.StatusBadRequest, "unsupported media file type. Only upload jpg or png file", err)
+		}
+		mediaUpload, err := service.cld.Upload.Upload(
+			ctx,
+			postMediaSrc,
+			uploader.UploadParams{
+				ResourceType: "image",
+			},
+		)
+		if err != nil {
+			return media, apperror.New(http.StatusInternalServerError, "failed to upload media file", err)
+		}
+		media = append(media, postMedia{
+			Id:        mediaId.String(),
+			MediaUrl:  mediaUpload.SecureURL,
+			CreatedAt: time.Now().Unix(),
+		})
+	}
+	return media, nil
+}
+
+// discardMedia queue uploaded media that didn't end up in a post for deletion, cause is returned with any queueing error
+func (service *serviceImpl) discardMedia(ctx context.Context, media []postMedia, cause error) error {
+	mediaUrl := []string{}
+	for _, item := range media {
+		mediaUrl = append(mediaUrl, item.MediaUrl)
+	}
+	return errors.Join(cause, service.repo.queueMediaDeletions(ctx, mediaUrl, time.Now().Unix()))
+}
+
+// edit let the author change the caption and media, the version before it is kept as a revision
+func (service *serviceImpl) edit(ctx context.Context, data postEditRequest) (schema.Response[postDetailResponse], error) {
+	if data.Caption != nil {
+		caption := strings.TrimSpace(*data.Caption)
+		data.Caption = &caption
+	}
+	err := service.v.Struct(data)
+	if err != nil {
+		validationError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[postDetailResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationError,
+			},
+		}, fmt.Errorf("service: edit post validation error %w", err)
+	}
+	if data.Caption == nil && len(data.Media) == 0 && len(data.RemoveMedia) == 0 {
+		return schema.Response[postDetailResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: "nothing to edit, send at least one of caption, post_media or remove_media",
+			},
+		}, errors.New("service: empty post edit")
+	}
+	removeMedia := []string{}
+	for _, url := range data.RemoveMedia {
+		if !slices.Contains(removeMedia, url) {
+			removeMedia = append(removeMedia, url)
+		}
+	}
+	data.RemoveMedia = removeMedia
+
+	// refuse the edit before uploading, otherwise a rejected edit leave its files on cloudinary
+	current, err := service.repo.editable(ctx, data.PostId)
+	if err == nil {
+		err = current.allowEdit(data.userId, data.RemoveMedia, len(data.Media))
+	}
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[postDetailResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[postDetailResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "failed to edit this post, please try again later",
+			},
+		}, err
+	}
+	media, err := service.uploadMedia(ctx, data.Media)
+	if err != nil {
+		err = service.discardMedia(ctx, media, err)
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[postDetailResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[postDetailResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "failed to edit this post, please try again later",
+			},
+		}, err
+	}
+	err = service.repo.edit(ctx, postEdit{
+		postId:      data.PostId,
+		userId:      data.userId,
+		caption:     data.Caption,
+		addMedia:    media,
+		removeMedia: data.RemoveMedia,
+		editedAt:    time.Now().Unix(),
+	})
+	if err != nil {
+		err = service.discardMedia(ctx, media, err)
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[postDetailResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[postDetailResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "failed to edit this post, please try again later",
+			},
+		}, err
+	}
+	return service.findById(ctx, postDetailRequest{
+		PostId:   data.PostId,
+		viewerId: data.userId,
+	})
+}
+
+type revisionDetail struct {
+	Revision  int      `json:"revision"`
+	Caption   string   `json:"caption"`
+	Media     []string `json:"media"`
+	CreatedAt int64    `json:"created_at"`
+	// the version people see now, always the last one
+	Current bool `json:"current"`
+}
+
+type revisionsResponse struct {
+	Revisions []revisionDetail `json:"revisions"`
+}
+
+type revisionDiffRequest struct {
+	postDetailRequest
+	From int `query:"from" validate:"required,min=1"`
+	To   int `query:"to" validate:"required,min=1"`
+}
+
+type revisionDiffResponse struct {
+	From         int         `json:"from"`
+	To           int         `json:"to"`
+	Caption      []diffChunk `json:"caption"`
+	MediaAdded   []string    `json:"media_added"`
+	MediaRemoved []string    `json:"media_removed"`
+}
+
+// allRevisions return every version of the post oldest first, the current one last.
+// revisions follow the post visibility, except moderators can still read them after a take down
+func (service *serviceImpl) allRevisions(ctx context.Context, data postDetailRequest) ([]revisionDetail, error) {
+	result, err := service.repo.findById(ctx, data.PostId, data.viewerId)
+	if err != nil {
+		return nil, err
+	}
+	isAuthor := data.viewerId != "" && data.viewerId == result.user.Id
+	canModerate := CanModerate(data.viewerRoles)
+	switch result.status {
+	case POST_STATUS_TAKE_DOWN:
+		if !canModerate {
+			return nil, apperror.New(http.StatusUnavailableForLegalReasons, "this post has been removed by moderators", nil)
+		}
+	case POST_STATUS_PENDING, POST_STATUS_REJECTED:
+		if !isAuthor && !canModerate {
+			return nil, apperror.New(http.StatusNotFound, "post not found", nil)
+		}
+	}
+
+	revisions, err := service.repo.revisions(ctx, data.PostId)
+	if err != nil {
+		return nil, err
+	}
+	details := []revisionDetail{}
+	for _, revision := range revisions {
+		details = append(details, revisionDetail{
+			Revision:  revision.revision,
+			Caption:   revision.caption,
+			Media:     revision.mediaUrl,
+			CreatedAt: revision.createdAt,
+		})
+	}
+	current := revisionDetail{
+		Revision:  len(revisions) + 1,
+		Caption:   result.caption,
+		Media:     result.mediaUrl,
+		CreatedAt: result.createdAt,
+		Current:   true,
+	}
+	if result.editedAt.Valid {
+		current.CreatedAt = result.editedAt.Int64
+	}
+	return append(details, current), nil
+}
+
+func (service *serviceImpl) revisions(ctx context.Context, data postDetailRequest) (schema.Response[revisionsResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[revisionsResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationError,
+			},
+		}, fmt.Errorf("service: post revisions validation error %w", err)
+	}
+	revisions, err := service.allRevisions(ctx, data)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[revisionsResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[revisionsResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "something went wrong, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[revisionsResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: revisionsResponse{
+			Revisions: revisions,
+		},
+	}, nil
+}
+
+// diff compare two revisions, from doesn't have to be older than to
+func (service *serviceImpl) diff(ctx context.Context, data revisionDiffRequest) (schema.Response[revisionDiffResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[revisionDiffResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationError,
+			},
+		}, fmt.Errorf("service: post revision diff validation error %w", err)
+	}
+	revisions, err := service.allRevisions(ctx, data.postDetailRequest)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[revisionDiffResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[revisionDiffResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "something went wrong, please try again later",
+			},
+		}, err
+	}
+	if data.From > len(revisions) || data.To > len(revisions) {
+		return schema.Response[revisionDiffResponse]{
+			Status: "fail",
+			Code:   http.StatusNotFound,
+			Error: schema.Error{
+				Message: fmt.Sprintf("revision not found, this post has %d revisions", len(revisions)),
+			},
+		}, fmt.Errorf("service: revision %d or %d out of %d", data.From, data.To, len(revisions))
+	}
+	from, to := revisions[data.From-1], revisions[data.To-1]
+	added, removed := diffMedia(from.Media, to.Media)
+	return schema.Response[revisionDiffResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: revisionDiffResponse{
+			From:         data.From,
+			To:           data.To,
+			Caption:      diffText(from.Caption, to.Caption),
+			MediaAdded:   added,
+			MediaRemoved: removed,
+		},
+	}, nil
+}
+
+type postDeleteRequest struct {
+	userId string
+	roles  []user.Roles
+	PostId string `param:"id" validate:"required"`
+}
+
+type postDeleteResponse struct {
+	PostId string `json:"post_id"`
+}
+
+// delete is allowed to the author and holders of ROLE_ID_DELETE_POST, media are deleted from cloudinary later by MediaCleaner
+func (service *serviceImpl) delete(ctx context.Context, data postDeleteRequest) (schema.Response[postDeleteResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[postDeleteResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationError,
+			},
+		}, fmt.Errorf("service: delete post validation error %w", err)
+	}
+	canDeleteAny := false
+	for _, role := range data.roles {
+		if role.Id == user.ROLE_ID_DELETE_POST {
+			canDeleteAny = true
+		}
+	}
+	err = service.repo.delete(ctx, postDeletion{
+		postId:       data.PostId,
+		userId:       data.userId,
+		canDeleteAny: canDeleteAny,
+		deletedAt:    time.Now().Unix(),
+	})
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[postDeleteResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[postDeleteResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to delete post, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[postDeleteResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: postDeleteResponse{
+			PostId: data.PostId,
+		},
+	}, nil
+}
+
+const (
+	DEFAULT_QUEUE_LIMIT = 20
+)
+
+type queueRequest struct {
+	SubforumId string `query:"subforum_id"`
+	Cursor     string `query:"cursor" validate:"omitempty,uuid"`
+	Limit      int    `query:"limit" validate:"omitempty,min=1,max=50"`
+}
+
+type queueResponse struct {
+	Posts []postDetail `json:"posts"`
+	// empty on the last page
+	NextCursor string `json:"next_cursor"`
+}
+
+// queue list posts waiting for approval, the one waiting the longest first
+func (service *serviceImpl) queue(ctx context.Context, data queueRequest) (schema.Response[queueResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validationError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[queueResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationError,
+			},
+		}, fmt.Errorf("service: moderation queue validation error %w", err)
+	}
+	query := queueQuery{
+		subforumId: data.SubforumId,
+		after:      data.Cursor,
+		limit:      data.Limit,
+	}
+	if query.limit == 0 {
+		query.limit = DEFAULT_QUEUE_LIMIT
+	}
+	// one extra post tell us whether there is a next page
+	query.limit++
+	result, err := service.repo.queue(ctx, query)
+	if err != nil {
+		return schema.Response[queueResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "something went wrong, please try again later",
+			},
+		}, err
+	}
+	nextCursor := ""
+	if len(result) == query.limit {
+		result = result[:len(result)-1]
+		nextCursor = result[len(result)-1].id
+	}
+
+	posts := []postDetail{}
+	for _, fp := range result {
+		posts = append(posts, postDetail{
+			Id:        fp.id,
+			Caption:   fp.caption,
+			Media:     fp.mediaUrl,
+			CreatedAt: fp.createdAt,
+			UpdatedAt: fp.updatedAt.Int64,
+			Subforum: subforum.Subforum{
+				Id:   fp.subforum.Id,
+				Name: fp.subforum.Name,
+			},
+			User:      fp.user,
+			Reactions: service.reactions.Counts(nil),
+			Edited:    fp.editedAt.Valid,
+			EditedAt:  fp.editedAt.Int64,
+		})
+	}
+	return schema.Response[queueResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: queueResponse{
+			Posts:      posts,
+			NextCursor: nextCursor,
+		},
+	}, nil
+}
+
+// reviewRequest approve or reject a pending post, the reason is sent to the author and is required to reject
+type reviewRequest struct {
+	moderatorId string
+	PostId      string `param:"id" validate:"required"`
+	// POST_STATUS_PUBLISHED or POST_STATUS_REJECTED, set by the endpoint not the client
+	Decision string `json:"-" validate:"oneof=published rejected"`
+	Reason   string `json:"reason" validate:"required_if=Decision rejected,max=1000"`
+}
+
+type reviewResponse struct {
+	PostId string `json:"post_id"`
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+	// false when the email to the author failed, the decision is kept anyway
+	AuthorNotified bool `json:"author_notified"`
+}
+
+func (service *serviceImpl) review(ctx context.Context, data reviewRequest) (schema.Response[reviewResponse], error) {
+	data.Reason = strings.TrimSpace(data.Reason)
+	err := service.v.Struct(data)
+	if err != nil {
+		validationError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[reviewResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationError,
+			},
+		}, fmt.Errorf("service: review post validation error %w", err)
+	}
+	result, err := service.repo.review(ctx, postReview{
+		postId:      data.PostId,
+		moderatorId: data.moderatorId,
+		status:      data.Decision,
+		reason:      data.Reason,
+		reviewedAt:  time.Now().Unix(),
+	})
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[reviewResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[reviewResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to review post, please try again later",
+			},
+		}, err
+	}
+
+	message := mailer.Message{
+		To:      result.authorEmail,
+		Subject: fmt.Sprintf("Your post in %s was approved", result.subforumName),
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nYour post in %s was approved by the moderators and everyone can see it now:\n\n%s/posts/%s\n",
+			result.authorFullname,
+			result.subforumName,
+			service.appURL,
+			data.PostId,
+		),
+	}
+	if data.Decision == POST_STATUS_REJECTED {
+		message.Subject = fmt.Sprintf("Your post in %s was not approved", result.subforumName)
+		message.Body = fmt.Sprintf(
+			"Hi %s,\n\nYour post in %s was not approved by the moderators.\n\nReason: %s\n\nOnly you can still see it:\n\n%s/posts/%s\n",
+			result.authorFullname,
+			result.subforumName,
+			data.Reason,
+			service.appURL,
+			data.PostId,
+		)
+	} else if data.Reason != "" {
+		message.Body += fmt.Sprintf("\nNote from the moderators: %s\n", data.Reason)
+	}
+	// the decision is already saved, a failed email must not make the moderator review again
+	notified := service.mailer.Send(ctx, message) == nil
+
+	return schema.Response[reviewResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: reviewResponse{
+			PostId:         data.PostId,
+			Status:         data.Decision,
+			Reason:         data.Reason,
+			AuthorNotified: notified,
 		},
 	}, nil
 }
@@ -0,0 +1,169 @@
+package profile
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	apperror "github.com/zulfikarrosadi/code_roast/internal/app-error"
+	"github.com/zulfikarrosadi/code_roast/internal/post"
+)
+
+const (
+	DUPLICATE_CONSTRAINT_ERROR = 1062
+)
+
+type RepositoryImpl struct {
+	DB *sql.DB
+}
+
+func NewRepository(db *sql.DB) *RepositoryImpl {
+	return &RepositoryImpl{
+		DB: db,
+	}
+}
+
+type profile struct {
+	id        string
+	handle    string
+	fullname  string
+	bio       string
+	avatar    string
+	createdAt int64
+	postCount int
+	// net score of published posts
+	karma int
+}
+
+// nil field is left untouched
+type profileUpdate struct {
+	handle   *string
+	fullname *string
+	bio      *string
+	avatar   *string
+	// the replaced avatar is queued for deletion at this time
+	updatedAt int64
+}
+
+func (repo *RepositoryImpl) findProfile(ctx context.Context, column string, value string) (profile, error) {
+	result := profile{}
+	var bio, avatar sql.NullString
+	err := repo.DB.QueryRowContext(
+		ctx,
+		fmt.Sprintf(`
+		SELECT u.id, u.handle, u.fullname, u.bio, u.avatar, u.created_at,
+		(SELECT COUNT(p.id) FROM posts p WHERE p.user_id = u.id AND p.status = ?) AS post_count,
+		(SELECT COALESCE(SUM(p.score), 0) FROM posts p WHERE p.user_id = u.id AND p.status = ?) AS karma
+		FROM users u
+		WHERE u.%s = ? AND u.deleted_at IS NULL`, column),
+		post.POST_STATUS_PUBLISHED,
+		post.POST_STATUS_PUBLISHED,
+		value,
+	).Scan(&result.id, &result.handle, &result.fullname, &bio, &avatar, &result.createdAt, &result.postCount, &result.karma)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return profile{}, apperror.New(http.StatusNotFound, "user not found", err)
+		}
+		return profile{}, fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	result.bio = bio.String
+	result.avatar = avatar.String
+	return result, nil
+}
+
+func (repo *RepositoryImpl) findByHandle(ctx context.Context, handle string) (profile, error) {
+	return repo.findProfile(ctx, "handle", handle)
+}
+
+func (repo *RepositoryImpl) update(ctx context.Context, userId string, data profileUpdate) (profile, error) {
+	columns := []string{}
+	args := []interface{}{}
+	if data.handle != nil {
+		columns = append(columns, "handle = ?")
+		args = append(args, *data.handle)
+	}
+	if data.fullname != nil {
+		columns = append(columns, "fullname = ?")
+		args = append(args, *data.fullname)
+	}
+	if data.bio != nil {
+		columns = append(columns, "bio = ?")
+		args = append(args, *data.bio)
+	}
+	if data.avatar != nil {
+		columns = append(columns, "avatar = ?")
+		args = append(args, *data.avatar)
+	}
+	if len(columns) > 0 {
+		err := repo.save(ctx, userId, columns, args, data)
+		if err != nil {
+			return profile{}, err
+		}
+	}
+	return repo.findProfile(ctx, "id", userId)
+}
+
+// save update the columns and hand the replaced avatar to post.MediaCleaner in the same transaction
+func (repo *RepositoryImpl) save(ctx context.Context, userId string, columns []string, args []interface{}, data profileUpdate) error {
+	tx, err := repo.DB.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("repository: failed to begin transaction %w", err)
+	}
+	defer func() {
+		// handle panic for extream case like driver fails
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var oldAvatar sql.NullString
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT avatar FROM users WHERE id = ? AND deleted_at IS NULL FOR UPDATE",
+		userId,
+	).Scan(&oldAvatar)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = apperror.New(http.StatusNotFound, "user not found", err)
+			return err
+		}
+		return fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		fmt.Sprintf("UPDATE users SET %s WHERE id = ?", strings.Join(columns, ", ")),
+		append(args, userId)...,
+	)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == DUPLICATE_CONSTRAINT_ERROR {
+			err = apperror.New(http.StatusConflict, "this handle is already taken", err)
+			return err
+		}
+		return fmt.Errorf("repository: failed to update profile %w", err)
+	}
+	if data.avatar != nil && oldAvatar.String != "" && oldAvatar.String != *data.avatar {
+		_, err = tx.ExecContext(
+			ctx,
+			"INSERT IGNORE INTO media_deletions (media_url, next_attempt_at, created_at) VALUES (?,?,?)",
+			oldAvatar.String,
+			data.updatedAt,
+			data.updatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("repository: failed to queue old avatar deletion %w", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("repository: failed to commit transaction %w", err)
+	}
+	return nil
+}
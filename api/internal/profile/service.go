@@ -0,0 +1,218 @@
+package profile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloudinary/cloudinary-go/v2"
+	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
+	"github.com/go-playground/validator/v10"
+	apperror "github.com/zulfikarrosadi/code_roast/internal/app-error"
+	imagehelper "github.com/zulfikarrosadi/code_roast/internal/image-helper"
+	"github.com/zulfikarrosadi/code_roast/pkg/schema"
+)
+
+type repository interface {
+	findByHandle(context.Context, string) (profile, error)
+	update(context.Context, string, profileUpdate) (profile, error)
+}
+
+type ServiceImpl struct {
+	repo repository
+	v    *validator.Validate
+	cld  *cloudinary.Cloudinary
+}
+
+// lowercase so handles stay unambiguous in urls and mentions
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+func NewService(repo repository, v *validator.Validate, cloudinaryInstance *cloudinary.Cloudinary) *ServiceImpl {
+	v.RegisterValidation("handle", func(fl validator.FieldLevel) bool {
+		return handlePattern.MatchString(fl.Field().String())
+	})
+	return &ServiceImpl{
+		repo: repo,
+		v:    v,
+		cld:  cloudinaryInstance,
+	}
+}
+
+// publicProfile is everything anyone can see about a user, never add email or anything private here
+type publicProfile struct {
+	Id        string `json:"id"`
+	Handle    string `json:"handle"`
+	Fullname  string `json:"fullname"`
+	Bio       string `json:"bio"`
+	Avatar    string `json:"avatar"`
+	CreatedAt int64  `json:"created_at"`
+	PostCount int    `json:"post_count"`
+	Karma     int    `json:"karma"`
+}
+
+type profileResponse struct {
+	Profile publicProfile `json:"profile"`
+}
+
+// nil field is not sent by the client and is left untouched
+type profileUpdateRequest struct {
+	userId   string
+	Handle   *string `validate:"omitnil,min=3,max=30,handle"`
+	Fullname *string `validate:"omitnil,min=1,max=255"`
+	Bio      *string `validate:"omitnil,max=500"`
+	Avatar   *multipart.FileHeader
+}
+
+func toPublicProfile(result profile) publicProfile {
+	return publicProfile{
+		Id:        result.id,
+		Handle:    result.handle,
+		Fullname:  result.fullname,
+		Bio:       result.bio,
+		Avatar:    result.avatar,
+		CreatedAt: result.createdAt,
+		PostCount: result.postCount,
+		Karma:     result.karma,
+	}
+}
+
+func (service *ServiceImpl) findByHandle(ctx context.Context, handle string) (schema.Response[profileResponse], error) {
+	result, err := service.repo.findByHandle(ctx, strings.ToLower(handle))
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[profileResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[profileResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "something went wrong, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[profileResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: profileResponse{
+			Profile: toPublicProfile(result),
+		},
+	}, nil
+}
+
+func (service *ServiceImpl) update(ctx context.Context, data profileUpdateRequest) (schema.Response[profileResponse], error) {
+	if data.Handle != nil {
+		handle := strings.ToLower(strings.TrimSpace(*data.Handle))
+		data.Handle = &handle
+	}
+	if data.Fullname != nil {
+		fullname := strings.TrimSpace(*data.Fullname)
+		data.Fullname = &fullname
+	}
+	err := service.v.Struct(data)
+	if err != nil {
+		validationErrorDetail := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[profileResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validationErrorDetail,
+			},
+		}, fmt.Errorf("service: update profile validation error %w", err)
+	}
+	if data.Handle == nil && data.Fullname == nil && data.Bio == nil && data.Avatar == nil {
+		return schema.Response[profileResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: "nothing to update, send at least one of handle, fullname, bio or avatar",
+			},
+		}, errors.New("service: empty profile update")
+	}
+
+	update := profileUpdate{
+		handle:    data.Handle,
+		fullname:  data.Fullname,
+		bio:       data.Bio,
+		updatedAt: time.Now().Unix(),
+	}
+	if data.Avatar != nil {
+		avatarSrc, err := data.Avatar.Open()
+		if err != nil {
+			return schema.Response[profileResponse]{
+				Status: "fail",
+				Code:   http.StatusInternalServerError,
+				Error: schema.Error{
+					Message: "fail to update your profile, failed to open avatar file",
+				},
+			}, fmt.Errorf("service: failed to open avatar file %w", err)
+		}
+		defer avatarSrc.Close()
+		if _, err := imagehelper.IsImage(avatarSrc); err != nil {
+			return schema.Response[profileResponse]{
+				Status: "fail",
+				Code:   http.StatusBadRequest,
+				Error: schema.Error{
+					Message: "fail to update your profile, unsupported avatar file type. Only upload jpg or png file",
+				},
+			}, fmt.Errorf("service: avatar not image %w", err)
+		}
+		avatarUpload, err := service.cld.Upload.Upload(
+			ctx,
+			avatarSrc,
+			uploader.UploadParams{
+				ResourceType: "image",
+			},
+		)
+		if err != nil {
+			return schema.Response[profileResponse]{
+				Status: "fail",
+				Code:   http.StatusInternalServerError,
+				Error: schema.Error{
+					Message: "fail to update your profile, failed to upload avatar file",
+				},
+			}, fmt.Errorf("service: failed to upload avatar file %w", err)
+		}
+		update.avatar = &avatarUpload.SecureURL
+	}
+
+	result, err := service.repo.update(ctx, data.userId, update)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[profileResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[profileResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to update your profile, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[profileResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: profileResponse{
+			Profile: toPublicProfile(result),
+		},
+	}, nil
+}
@@ -3,7 +3,11 @@ package subforum
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"net/http"
+
+	apperror "github.com/zulfikarrosadi/code_roast/internal/app-error"
 )
 
 type RepositoryImpl struct {
@@ -18,6 +22,8 @@ type Subforum struct {
 	CreatedAt   int64  `json:"created_at"`
 	Icon        string `json:"icon"`
 	Banner      string `json:"banner"`
+	// new posts wait in the moderation queue until a moderator approve them
+	RequireApproval bool `json:"require_approval"`
 }
 
 func NewRepository(db *sql.DB) *RepositoryImpl {
@@ -29,13 +35,14 @@ func NewRepository(db *sql.DB) *RepositoryImpl {
 func (repo *RepositoryImpl) create(ctx context.Context, data Subforum) (Subforum, error) {
 	_, err := repo.DB.ExecContext(
 		ctx,
-		"INSERT INTO subforums (id, name, description, user_id, icon, banner, created_at) VALUES (?,?,?,?,?,?,?)",
+		"INSERT INTO subforums (id, name, description, user_id, icon, banner, require_approval, created_at) VALUES (?,?,?,?,?,?,?,?)",
 		data.Id,
 		data.Name,
 		data.Description,
 		data.UserId,
 		data.Icon,
 		data.Banner,
+		data.RequireApproval,
 		data.CreatedAt,
 	)
 	if err != nil {
@@ -116,3 +123,24 @@ func (repo *RepositoryImpl) findById(ctx context.Context, forumId string) (Subfo
 	}
 	return *sf, nil
 }
+
+func (repo *RepositoryImpl) setRequireApproval(ctx context.Context, forumId string, requireApproval bool) error {
+	var id string
+	err := repo.DB.QueryRowContext(ctx, "SELECT id FROM subforums WHERE id = ?", forumId).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return apperror.New(http.StatusNotFound, "subforum not found", err)
+		}
+		return fmt.Errorf("repository: db query scan failed, %w", err)
+	}
+	_, err = repo.DB.ExecContext(
+		ctx,
+		"UPDATE subforums SET require_approval = ? WHERE id = ?",
+		requireApproval,
+		forumId,
+	)
+	if err != nil {
+		return fmt.Errorf("repository: fail to update subforum approval mode %w", err)
+	}
+	return nil
+}
@@ -2,9 +2,12 @@ package subforum
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/cloudinary/cloudinary-go/v2"
 	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
@@ -19,6 +22,7 @@ type repository interface {
 	create(context.Context, Subforum) (Subforum, error)
 	findByName(context.Context, string) ([]Subforum, error)
 	deleteById(context.Context, string, string) error
+	setRequireApproval(context.Context, string, bool) error
 }
 
 type ServiceImpl struct {
@@ -33,11 +37,12 @@ type SubforumMedia struct {
 }
 
 type subforumDetail struct {
-	Id            string `json:"id"`
-	Name          string `json:"name"`
-	Description   string `json:"description"`
-	CreatedAt     int64  `json:"created_at"`
-	SubforumMedia `json:"media"`
+	Id              string `json:"id"`
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	CreatedAt       int64  `json:"created_at"`
+	RequireApproval bool   `json:"require_approval"`
+	SubforumMedia   `json:"media"`
 }
 
 type subforumResponse struct {
@@ -45,6 +50,10 @@ type subforumResponse struct {
 }
 
 func NewService(repo repository, v *validator.Validate, cloudinaryInstance *cloudinary.Cloudinary) *ServiceImpl {
+	// names end up in email subjects and page titles, they must stay on one line
+	v.RegisterValidation("single_line", func(fl validator.FieldLevel) bool {
+		return !strings.ContainsFunc(fl.Field().String(), unicode.IsControl)
+	})
 	return &ServiceImpl{
 		repo: repo,
 		v:    v,
@@ -149,13 +158,14 @@ func (service *ServiceImpl) create(ctx context.Context, data subforumCreateReque
 	}
 
 	result, err := service.repo.create(ctx, Subforum{
-		Id:          subForumId.String(),
-		Name:        data.Name,
-		Description: data.Description,
-		Icon:        iconSecureUrl,
-		Banner:      bannerSecureUrl,
-		UserId:      data.UserId,
-		CreatedAt:   time.Now().Unix(),
+		Id:              subForumId.String(),
+		Name:            data.Name,
+		Description:     data.Description,
+		Icon:            iconSecureUrl,
+		Banner:          bannerSecureUrl,
+		UserId:          data.UserId,
+		RequireApproval: data.RequireApproval,
+		CreatedAt:       time.Now().Unix(),
 	})
 	if err != nil {
 		return schema.Response[subforumResponse]{}, err
@@ -166,10 +176,11 @@ func (service *ServiceImpl) create(ctx context.Context, data subforumCreateReque
 		Code:   http.StatusCreated,
 		Data: subforumResponse{
 			Subforum: subforumDetail{
-				Id:          result.Id,
-				Name:        result.Name,
-				Description: result.Description,
-				CreatedAt:   result.CreatedAt,
+				Id:              result.Id,
+				Name:            result.Name,
+				Description:     result.Description,
+				CreatedAt:       result.CreatedAt,
+				RequireApproval: result.RequireApproval,
 				SubforumMedia: SubforumMedia{
 					Icon:   iconSecureUrl,
 					Banner: bannerSecureUrl,
@@ -179,4 +190,58 @@ func (service *ServiceImpl) create(ctx context.Context, data subforumCreateReque
 	}, nil
 }
 
+type subforumApprovalRequest struct {
+	Id              string `param:"id" validate:"required"`
+	RequireApproval *bool  `json:"require_approval" validate:"required"`
+}
+
+type subforumApprovalResponse struct {
+	Id              string `json:"id"`
+	RequireApproval bool   `json:"require_approval"`
+}
+
+// updateApproval turn the approval mode on or off, posts already waiting stay in the queue when it is turned off
+func (service *ServiceImpl) updateApproval(ctx context.Context, data subforumApprovalRequest) (schema.Response[subforumApprovalResponse], error) {
+	err := service.v.Struct(data)
+	if err != nil {
+		validatorError := apperror.HandlerValidatorError(err.(validator.ValidationErrors))
+		return schema.Response[subforumApprovalResponse]{
+			Status: "fail",
+			Code:   http.StatusBadRequest,
+			Error: schema.Error{
+				Message: apperror.VALIDATION_ERROR,
+				Details: validatorError,
+			},
+		}, fmt.Errorf("service: update subforum approval validation error %w", err)
+	}
+	err = service.repo.setRequireApproval(ctx, data.Id, *data.RequireApproval)
+	if err != nil {
+		var appError *apperror.AppError
+		if errors.As(err, &appError) {
+			return schema.Response[subforumApprovalResponse]{
+				Status: "fail",
+				Code:   appError.Code,
+				Error: schema.Error{
+					Message: appError.Message,
+				},
+			}, err
+		}
+		return schema.Response[subforumApprovalResponse]{
+			Status: "fail",
+			Code:   http.StatusInternalServerError,
+			Error: schema.Error{
+				Message: "fail to update subforum, please try again later",
+			},
+		}, err
+	}
+	return schema.Response[subforumApprovalResponse]{
+		Status: "success",
+		Code:   http.StatusOK,
+		Data: subforumApprovalResponse{
+			Id:              data.Id,
+			RequireApproval: *data.RequireApproval,
+		},
+	}, nil
+}
+
 // func (service *ServiceImpl) takeDown(ctx context.Context){}
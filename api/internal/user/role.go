@@ -9,4 +9,14 @@ const (
 	ROLE_ID_DELETE_POST     = 5
 	ROLE_ID_APPROVE_POST    = 6
 	ROLE_ID_TAKE_DOWN_POST  = 7
+	ROLE_ID_MANAGE_USERS    = 8
 )
+
+// roles that can wipe other people content, accounts holding them can be required to use two-factor authentication
+var PRIVILEGED_ROLE_IDS = map[int]bool{
+	ROLE_ID_DELETE_SUBFORUM: true,
+	ROLE_ID_DELETE_POST:     true,
+	ROLE_ID_APPROVE_POST:    true,
+	ROLE_ID_TAKE_DOWN_POST:  true,
+	ROLE_ID_MANAGE_USERS:    true,
+}
@@ -1,15 +1,42 @@
 package user
 
+import "strings"
+
+// anonymized account keep its row so posts and likes still point to it, only the name is shown
+const DELETED_USER_FULLNAME = "[deleted]"
+
 type User struct {
-	Id        string  `json:"id"`
-	Fullname  string  `json:"fullname"`
-	Email     string  `json:"email"`
-	Password  string  `json:"password"`
-	CreatedAt int64   `json:"created_at"`
-	Roles     []Roles `json:"roles"`
+	Id               string  `json:"id"`
+	Fullname         string  `json:"fullname"`
+	Email            string  `json:"email"`
+	Handle           string  `json:"handle"`
+	Password         string  `json:"-"`
+	CreatedAt        int64   `json:"created_at"`
+	EmailVerifiedAt  int64   `json:"email_verified_at"`
+	TwoFactorEnabled bool    `json:"two_factor_enabled"`
+	TokenVersion     int64   `json:"-"`
+	Roles            []Roles `json:"roles"`
+}
+
+// Author is what posts and comments show about the person who wrote them, never add anything private here
+type Author struct {
+	Id       string `json:"id"`
+	Handle   string `json:"handle"`
+	Fullname string `json:"fullname"`
+	Avatar   string `json:"avatar"`
 }
 
 type Roles struct {
 	Id   int    `json:"id"`
 	Name string `json:"name"`
 }
+
+// DefaultHandle is given to new account until the owner pick one, the tail of uuid v7 is random
+// so it doesn't collide like the timestamp head would
+func DefaultHandle(userId string) string {
+	id := strings.ReplaceAll(userId, "-", "")
+	if len(id) > 12 {
+		id = id[len(id)-12:]
+	}
+	return "user_" + id
+}